@@ -10,7 +10,7 @@ import (
 // each command gets its own set of args,
 // defines its own entry point, and provides its own help
 type Command struct {
-	Run  func(cmd *Command, args ...string)
+	Run  func(cmd *Command, args ...string) int
 	Flag flag.FlagSet
 
 	Name  string
@@ -20,14 +20,15 @@ type Command struct {
 	Help    string
 }
 
-func (c *Command) Exec(args []string) {
+// Exec parses the command's flags and runs it, returning the exit status.
+func (c *Command) Exec(args []string) int {
 	name := os.Args[0] + " " + c.Name
 	c.Flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [args...] %s\n", name, c.Usage)
 		c.Flag.PrintDefaults()
 	}
 	if err := c.Flag.Parse(args); err != nil {
-		os.Exit(1)
+		return 1
 	}
-	c.Run(c, c.Flag.Args()...)
+	return c.Run(c, c.Flag.Args()...)
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var auditCmd = &Command{
+	Name:    "audit",
+	Usage:   "",
+	Summary: "Compare the applied migrations with their files, without running anything",
+	Help:    `audit extended help here...`,
+	Run:     auditRun,
+}
+
+func auditRun(cmd *Command, args ...string) int {
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	problems, err := goose.AuditMigrations(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("goose: found %d discrepancies\n", len(problems))
+		return 1
+	}
+
+	fmt.Println("goose: applied migrations match their files")
+	return 0
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationAudit(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	sql := []byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n")
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name), sql, 0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err := run([]string{"audit"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: applied migrations match their files\n")
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "001_one.sql"), append(sql, "SELECT 2;\n"...), 0600)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(migrationsDir, "002_two.sql"))
+	require.NoError(t, err)
+
+	status, out, err = run([]string{"audit"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, out, "001_one.sql: modified since it was applied\n")
+	assert.Contains(t, out, "version 2: applied, but its migration file (002_two.sql) is missing\n")
+	assert.Contains(t, out, "goose: found 2 discrepancies\n")
+
+	// nothing was run
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 2\n")
+}
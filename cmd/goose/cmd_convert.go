@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var convertCmd = &Command{
+	Name:    "convert",
+	Usage:   "-to sequential -yes",
+	Summary: "Renumber timestamped migrations sequentially, rewriting the versions recorded in the DB",
+	Help:    `convert extended help here...`,
+	Run:     convertRun,
+}
+
+var convertTo string
+var convertYes bool
+
+func init() {
+	convertCmd.Flag.StringVar(&convertTo, "to", "", "the numbering to convert the migrations to, only sequential is supported")
+	convertCmd.Flag.BoolVar(&convertYes, "yes", false, "confirm renaming the migrations and rewriting the version table of the environment's DB")
+}
+
+func convertRun(cmd *Command, args ...string) int {
+	if len(args) != 0 {
+		cmd.Flag.Usage()
+		return 1
+	}
+	if convertTo != "sequential" {
+		log.Printf("goose: invalid numbering %q, only -to sequential is supported", convertTo)
+		return 1
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !convertYes {
+		log.Printf("goose: convert renames the migrations in %s and rewrites the versions recorded in the DB, use -yes to confirm", conf.MigrationsDir)
+		return 1
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	if err := goose.ConvertMigrations(conf, db); err != nil {
+		log.Printf("goose: %s", err)
+		return 1
+	}
+
+	fmt.Printf("goose: converted the migrations to sequential numbering\n")
+	return 0
+}
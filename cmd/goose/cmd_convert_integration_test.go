@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationConvert(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "20010203040506_one.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE one(id INT);\n\n-- +goose Down\nDROP TABLE one;\n"),
+		0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "20010203040507_two.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE two(id INT);\n\n-- +goose Down\nDROP TABLE two;\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	defer func() { convertTo, convertYes = "", false }()
+
+	// the numbering must be given, and the conversion confirmed
+	for _, args := range [][]string{{"convert", "-yes"}, {"convert", "-to", "timestamp", "-yes"}, {"convert", "-to", "sequential"}} {
+		convertTo, convertYes = "", false
+		status, _, err = run(args, env)
+		require.NoError(t, err)
+		assert.Equal(t, 1, status, "%v", args)
+	}
+	assert.FileExists(t, filepath.Join(migrationsDir, "20010203040506_one.sql"))
+
+	status, out, err := run([]string{"convert", "-to", "sequential", "-yes"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: converted the migrations to sequential numbering")
+	assert.FileExists(t, filepath.Join(migrationsDir, "00001_one.sql"))
+	assert.FileExists(t, filepath.Join(migrationsDir, "00002_two.sql"))
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 2\n")
+
+	// nothing is pending after the conversion
+	status, out, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "00001_one.sql")
+	assert.NotContains(t, out, "00002_two.sql")
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/CloudCom/goose/lib/goose"
@@ -12,22 +14,42 @@ import (
 
 var createCmd = &Command{
 	Name:    "create",
-	Usage:   "<migration_name>",
+	Usage:   "<migration name>",
 	Summary: "Create the scaffolding for a new migration",
 	Help:    `create extended help here...`,
 	Run:     createRun,
 }
 
 var migrationType string
+var sequential bool
+var templatesDir string
+var createEdit bool
+var createTemplate string
+var createVersionFormat string
+var createTimezone string
+var createSplit bool
 
 func init() {
 	createCmd.Flag.StringVar(&migrationType, "type", "sql", "type of migration to create [sql,go]")
+	createCmd.Flag.BoolVar(&sequential, "sequential", false, "number the migration sequentially instead of with a timestamp")
+	createCmd.Flag.StringVar(&templatesDir, "templates", "", "folder containing migration templates, overrides the config")
+	createCmd.Flag.BoolVar(&createEdit, "edit", false, "open the new migration in $VISUAL or $EDITOR")
+	createCmd.Flag.StringVar(&createVersionFormat, "version-format", "", "version the migration with a `timestamp`, or unix or unixmilli time, overrides the config")
+	createCmd.Flag.StringVar(&createTimezone, "timezone", "", "`name` of the timezone of timestamp versions, e.g. Local, overrides the config, default UTC")
+	createCmd.Flag.StringVar(&createTemplate, "template", "default", "`name` of the template to create the migration from, e.g. index or data")
+	createCmd.Flag.BoolVar(&createSplit, "split", false, "create a sql migration as a folder holding up.sql and down.sql files")
 }
 
-func createRun(cmd *Command, args ...string) {
-	if len(args) != 1 {
+func createRun(cmd *Command, args ...string) int {
+	if len(args) == 0 {
 		cmd.Flag.Usage()
-		os.Exit(1)
+		return 1
+	}
+	// a name of several words needn't be quoted
+	name := strings.Join(args, " ")
+	if createSplit && migrationType != "sql" {
+		log.Printf("goose: only sql migrations can be split")
+		return 1
 	}
 
 	conf, err := dbConfFromFlags()
@@ -35,19 +57,75 @@ func createRun(cmd *Command, args ...string) {
 		log.Fatal(err)
 	}
 
-	if err = os.MkdirAll(conf.MigrationsDir, 0750); err != nil {
+	// new migrations go in the first of the migrations dirs
+	if err = os.MkdirAll(goose.CreateMigrationsDir(conf.MigrationsDir), 0750); err != nil {
 		log.Fatal(err)
 	}
 
-	n, err := goose.CreateMigration(args[0], migrationType, conf.MigrationsDir, time.Now())
+	if templatesDir != "" {
+		conf.TemplatesDir = templatesDir
+	}
+	if createVersionFormat != "" {
+		conf.VersionFormat = createVersionFormat
+	}
+	if createTimezone != "" {
+		conf.VersionTimezone = createTimezone
+	}
+
+	var n string
+	var version int64
+	if sequential {
+		n, version, err = goose.CreateSequentialMigrationFromNamedTemplate(name, migrationType, conf.MigrationsDir, conf.TemplatesDir, createTemplate)
+	} else {
+		var now time.Time
+		if now, err = conf.VersionTime(time.Now()); err != nil {
+			log.Fatal(err)
+		}
+		n, version, err = goose.CreateMigrationWithVersionFormat(name, migrationType, conf.MigrationsDir, conf.TemplatesDir, createTemplate, conf.VersionFormat, now)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	if createSplit {
+		if n, err = goose.SplitSQLMigration(n); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	a, e := filepath.Abs(n)
 	if e != nil {
 		log.Fatal(e)
 	}
 
-	fmt.Println("goose: created", a)
+	fmt.Printf("goose: created %s (version %d)\n", a, version)
+
+	if createEdit {
+		files := []string{a}
+		if createSplit {
+			files = []string{filepath.Join(a, "up.sql"), filepath.Join(a, "down.sql")}
+		}
+		if err := editFile(files...); err != nil {
+			log.Printf("goose: editing %s: %s", a, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// editFile opens the files at paths in the editor given by $VISUAL or
+// $EDITOR, which may include arguments, waiting for it to exit. Nothing is
+// done if neither is set.
+func editFile(paths ...string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		return nil
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], paths...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
 }
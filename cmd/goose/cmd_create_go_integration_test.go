@@ -0,0 +1,118 @@
+// +build !nogomigrations
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationCreate_go(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go migrations need the go tool")
+	}
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	defer func() { migrationType = "sql" }()
+	status, out, err := run([]string{"create", "-type", "go", "mymigration"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	require.Contains(t, out, migrationsDir)
+	// before it's applied, which records its checksum
+	implementGoDown(t, migrationsDir)
+
+	status, out, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status, out)
+
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "Pending")
+	assert.Contains(t, out, "_mymigration.go")
+
+	status, out, err = run([]string{"down"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status, out)
+
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `Pending +-- \d+_mymigration.go`, out)
+}
+
+func TestIntegrationCreate_goCompiled(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go migrations need the go tool")
+	}
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	defer func() { migrationType = "sql" }()
+	status, _, err := run([]string{"create", "-type", "go", "mymigration"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	implementGoDown(t, migrationsDir)
+
+	defer func(compile bool) { *flagCompileGo = compile }(*flagCompileGo)
+
+	status, out, err := run([]string{"-compile-go", "up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status, out)
+
+	status, out, err = run([]string{"-compile-go", "redo"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status, out)
+
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "Pending")
+}
+
+// implementGoDown replaces the Down stub of the created Go migration in dir,
+// which fails until it's implemented, with one which succeeds.
+func implementGoDown(t *testing.T, dir string) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*_mymigration.go"))
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+
+	bs, err := ioutil.ReadFile(paths[0])
+	require.NoError(t, err)
+	src := strings.Replace(string(bs), "\t\"errors\"\n", "", 1)
+	src = strings.Replace(src, `return errors.New("down migration not implemented")`, "return nil", 1)
+	err = ioutil.WriteFile(paths[0], []byte(src), 0600)
+	require.NoError(t, err)
+}
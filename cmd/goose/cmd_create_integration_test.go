@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
@@ -44,3 +45,169 @@ func TestIntegrationCreate_sql(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, string(tmplBS), string(fBS))
 }
+
+func TestIntegrationCreate_name(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_MIGRATIONS_DIR": td,
+	}
+
+	for _, args := range [][]string{
+		{"create", "add user table"},
+		{"create", "Add", "User", "Table"},
+	} {
+		status, out, err := run(args, env)
+		require.NoError(t, err)
+		assert.Equal(t, 0, status)
+		assert.Regexp(t, `goose: created .*/[0-9]{14}_add_user_table\.sql \(version [0-9]{14}\)\n`, out)
+	}
+
+	status, _, err := run([]string{"create", "--"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+}
+
+func TestIntegrationCreate_template(t *testing.T) {
+	defer func() { createTemplate = "default" }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	status, out, err := run([]string{"create", "-template", "index", "add email index"}, map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_MIGRATIONS_DIR": td,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	i := strings.Index(out, td)
+	require.NotEqual(t, -1, i, out)
+	fn := strings.Fields(out[i:])[0]
+	assert.True(t, strings.HasSuffix(fn, "_add_email_index.sql"), fn)
+
+	bs, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	tmplBS, err := goose.Asset("templates/migration.index.sql.tmpl")
+	require.NoError(t, err)
+	assert.Equal(t, string(tmplBS), string(bs))
+	assert.Contains(t, string(bs), "-- +goose NO TRANSACTION\n")
+}
+
+func TestIntegrationCreate_split(t *testing.T) {
+	defer func() { createSplit, migrationType = false, "sql" }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": td,
+	}
+
+	status, out, err := run([]string{"create", "-split", "add users"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	i := strings.Index(out, td)
+	require.NotEqual(t, -1, i, out)
+	dir := strings.Fields(out[i:])[0]
+	assert.Regexp(t, `/[0-9]{14}_add_users$`, dir)
+
+	up, err := ioutil.ReadFile(filepath.Join(dir, "up.sql"))
+	require.NoError(t, err)
+	assert.Contains(t, string(up), "executed when this migration is applied")
+	assert.NotContains(t, string(up), "+goose")
+	down, err := ioutil.ReadFile(filepath.Join(dir, "down.sql"))
+	require.NoError(t, err)
+	assert.Contains(t, string(down), "executed when this migration is rolled back")
+
+	err = ioutil.WriteFile(filepath.Join(dir, "up.sql"), []byte("CREATE TABLE users(id INT);\n"), 0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "down.sql"), []byte("DROP TABLE users;\n"), 0600)
+	require.NoError(t, err)
+
+	status, out, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, filepath.Base(dir))
+
+	status, _, err = run([]string{"down"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	// go migrations can't be split
+	status, _, err = run([]string{"create", "-split", "-type", "go", "add users"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+}
+
+// The templates are compiled in with go-bindata, so creating migrations
+// doesn't depend on the source tree being around.
+func TestIntegrationCreate_otherWorkingDir(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+	require.NoError(t, os.Chdir(td))
+
+	migrationsDir := filepath.Join(td, "migrations")
+	status, out, err := run(
+		[]string{"create", "-type", "sql", "mymigration"},
+		map[string]string{
+			"DB_DRIVER":         "sqlite3",
+			"DB_MIGRATIONS_DIR": migrationsDir,
+		},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, migrationsDir)
+}
+
+func TestIntegrationCreate_edit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test editor is a shell script")
+	}
+	defer func() { createEdit = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	edited := filepath.Join(td, "edited")
+	editor := filepath.Join(td, "editor.sh")
+	err = ioutil.WriteFile(editor, []byte("#!/bin/sh\necho \"$@\" > "+edited+"\n"), 0700)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_MIGRATIONS_DIR": migrationsDir,
+		"VISUAL":            "",
+		"EDITOR":            editor + " -w",
+	}
+	status, out, err := run([]string{"create", "-edit", "mymigration"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	fn := strings.Fields(strings.TrimPrefix(out, "goose: created"))[0]
+	bs, err := ioutil.ReadFile(edited)
+	require.NoError(t, err)
+	assert.Equal(t, "-w "+fn+"\n", string(bs))
+
+	// without an editor the migration is still created
+	env["EDITOR"] = ""
+	status, out, err = run([]string{"create", "-edit", "othermigration"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "othermigration.sql")
+}
@@ -15,7 +15,7 @@ var dbVersionCmd = &Command{
 	Run:     dbVersionRun,
 }
 
-func dbVersionRun(cmd *Command, args ...string) {
+func dbVersionRun(cmd *Command, args ...string) int {
 	conf, err := dbConfFromFlags()
 	if err != nil {
 		log.Fatal(err)
@@ -27,4 +27,5 @@ func dbVersionRun(cmd *Command, args ...string) {
 	}
 
 	fmt.Printf("goose: dbversion %v\n", current)
+	return 0
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/CloudCom/goose/lib/goose"
@@ -14,24 +15,92 @@ var downCmd = &Command{
 	Run:     downRun,
 }
 
-func downRun(cmd *Command, args ...string) {
+var (
+	downVersionOrder        string
+	downTargetLatestApplied bool
+	downJSON                bool
+	downForce               int64
+	downYes                 bool
+)
+
+func init() {
+	downCmd.Flag.StringVar(&downVersionOrder, "version-order", "filename", "roll back the latest migration by `filename`, or the last applied")
+	downCmd.Flag.BoolVar(&downTargetLatestApplied, "target-latest-applied", false, "roll back to the highest applied version below the current one")
+	downCmd.Flag.BoolVar(&downJSON, "json", false, "report the migration, and a summary, as JSON objects instead of text")
+	downCmd.Flag.Int64Var(&downForce, "force", 0, "roll back the migration with this `version`, even if it's recorded as rolled back")
+	downCmd.Flag.BoolVar(&downYes, "yes", false, "confirm rolling back a destructive migration in a protected environment")
+}
+
+// validVersionOrder reports whether order is a valid -version-order.
+func validVersionOrder(order string) bool {
+	return order == "filename" || order == "applied"
+}
+
+func downRun(cmd *Command, args ...string) int {
+	if !validVersionOrder(downVersionOrder) {
+		log.Printf("-version-order must be filename or applied")
+		return 1
+	}
+	if downTargetLatestApplied && downVersionOrder == "applied" {
+		log.Printf("-target-latest-applied can't be used with -version-order applied")
+		return 1
+	}
 
 	conf, err := dbConfFromFlags()
 	if err != nil {
 		log.Fatal(err)
 	}
+	conf.JSON = downJSON
+	conf.ConfirmDestructive = downYes
+
+	if downForce != 0 {
+		return forceRun(conf, downForce, goose.DirectionDown)
+	}
+
+	if downVersionOrder == "applied" {
+		db, err := goose.OpenDBFromDBConf(conf)
+		if err != nil {
+			log.Fatal("couldn't open DB:", err)
+		}
+		defer db.Close()
+
+		if err := goose.RollbackLastApplied(conf, db); err != nil {
+			log.Fatal(err)
+		}
+		return 0
+	}
 
 	current, err := goose.GetDBVersion(conf)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	previous, err := goose.GetPreviousDBVersion(conf.MigrationsDir, current)
+	var previous int64
+	if downTargetLatestApplied {
+		previous, err = previousAppliedVersion(conf, current)
+	} else {
+		previous, err = goose.GetPreviousDBVersion(conf.MigrationsDir, current)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if err = goose.RunMigrations(conf, conf.MigrationsDir, previous); err != nil {
+	if err = runMigrations(conf, previous); err == errInterrupted {
+		return interruptedStatus
+	} else if err != nil {
 		log.Fatal(err)
 	}
+	return 0
+}
+
+// previousAppliedVersion returns the highest version below current which is
+// applied in the DB.
+func previousAppliedVersion(conf *goose.DBConf, current int64) (int64, error) {
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		return -1, fmt.Errorf("couldn't open DB: %s", err)
+	}
+	defer db.Close()
+
+	return goose.GetPreviousAppliedVersion(conf, db, current)
 }
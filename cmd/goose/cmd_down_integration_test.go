@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationDown_appliedOrder(t *testing.T) {
+	defer func(allowMissing bool) { *flagAllowMissing = allowMissing }(*flagAllowMissing)
+	defer func() { statusVersionOrder, downVersionOrder = "filename", "filename" }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	writeMigration := func(name string) {
+		err := ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	writeMigration("001_one.sql")
+	writeMigration("003_three.sql")
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	writeMigration("002_two.sql")
+	writeMigration("004_four.sql")
+	status, _, err = run([]string{"-allow-missing", "up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err := run([]string{"status", "-version-order", "applied"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	one := strings.Index(out, "001_one.sql")
+	two := strings.Index(out, "002_two.sql")
+	three := strings.Index(out, "003_three.sql")
+	four := strings.Index(out, "004_four.sql")
+	assert.True(t, one < three && three < two && two < four, out)
+
+	// 004 and then 002 were applied last
+	for _, name := range []string{"004_four.sql", "002_two.sql"} {
+		status, out, err = run([]string{"down", "-version-order", "applied"}, env)
+		require.NoError(t, err)
+		assert.Equal(t, 0, status)
+		assert.Contains(t, out, "OK    "+name)
+	}
+
+	status, out, err = run([]string{"status", "-version-order", "applied"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "Pending                  -- 002_two.sql\n")
+	assert.NotContains(t, out, "Pending                  -- 003_three.sql\n")
+
+	status, _, err = run([]string{"down", "-version-order", "latest"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+}
+
+func TestIntegrationDown_targetLatestApplied(t *testing.T) {
+	defer func() { downTargetLatestApplied, downVersionOrder = false, "filename" }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	writeMigration := func(name string) {
+		err := ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	writeMigration("001_one.sql")
+	writeMigration("003_three.sql")
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// 002 is never applied, so the target skips over it
+	writeMigration("002_two.sql")
+	status, out, err := run([]string{"down", "-target-latest-applied"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "current version: 3, target: 1")
+	assert.Contains(t, out, "OK    003_three.sql")
+
+	status, _, err = run([]string{"down", "-target-latest-applied", "-version-order", "applied"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var downToCmd = &Command{
+	Name:    "down-to",
+	Usage:   "<version>",
+	Summary: "Roll back every migration newer than the given version",
+	Help:    `down-to extended help here...`,
+	Run:     downToRun,
+}
+
+var downToYes bool
+var downToContinueOnError bool
+
+func init() {
+	downToCmd.Flag.BoolVar(&downToYes, "yes", false, "confirm rolling back every migration, for a version of 0, and destructive migrations in a protected environment")
+	downToCmd.Flag.BoolVar(&downToContinueOnError, "continue-on-error", false, "carry on rolling back the other migrations when one fails, exiting with status 1 at the end")
+}
+
+func downToRun(cmd *Command, args ...string) int {
+	if len(args) != 1 {
+		cmd.Flag.Usage()
+		return 1
+	}
+
+	target, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || target < 0 {
+		log.Printf("goose: invalid version %q", args[0])
+		return 1
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+	conf.ContinueOnError = downToContinueOnError
+	conf.ConfirmDestructive = downToYes
+
+	if target != 0 {
+		migrations, err := goose.CollectMigrations(conf.MigrationsDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		found := false
+		for _, m := range migrations {
+			if m.Version == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Printf("goose: version %d not found in %s", target, conf.MigrationsDir)
+			return 1
+		}
+	}
+
+	current, err := goose.GetDBVersion(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if target == current {
+		fmt.Printf("goose: already at version %d, nothing to roll back\n", current)
+		return 0
+	}
+	if target > current {
+		log.Printf("goose: version %d is newer than the current version %d, use up to apply it", target, current)
+		return 1
+	}
+	// e.g. a script passing an unset variable as the version
+	if target == 0 && !downToYes {
+		log.Printf("goose: version 0 rolls back every migration, use -yes to confirm")
+		return 1
+	}
+
+	if err = runMigrations(conf, target); err == errInterrupted {
+		return interruptedStatus
+	} else if _, ok := err.(goose.MigrationErrors); ok {
+		// the other migrations were rolled back, and each failure reported
+		log.Printf("goose: %s", err)
+		return 1
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationDownTo(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql", "003_three.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, _, err = run([]string{"down-to", "1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	status, out, err := run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 1\n")
+
+	status, out, err = run([]string{"down-to", "1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "already at version 1")
+
+	// newer than the current version, or not a migration
+	for _, version := range []string{"2", "4", "abc"} {
+		status, _, err = run([]string{"down-to", version}, env)
+		require.NoError(t, err)
+		assert.Equal(t, 1, status, version)
+	}
+
+	// rolling back every migration needs confirming
+	status, _, err = run([]string{"down-to", "0"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 1\n")
+
+	defer func() { downToYes = false }()
+	status, _, err = run([]string{"down-to", "-yes", "0"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 0\n")
+}
+
+func TestIntegrationDownTo_continueOnError(t *testing.T) {
+	defer func() { downToYes, downToContinueOnError, *flagSkipVerify = false, false, false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one", "002_two", "003_three"} {
+		table := name[4:]
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name+".sql"),
+			[]byte("-- +goose Up\nCREATE TABLE "+table+" (id INTEGER);\n\n-- +goose Down\nDROP TABLE "+table+";\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// the second migration's table is already gone, so rolling it back fails
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "002_two.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE two (id INTEGER);\n\n-- +goose Down\nDROP TABLE missing;\n"),
+		0600)
+	require.NoError(t, err)
+
+	status, out, err := run([]string{"-skip-verify", "down-to", "-yes", "-continue-on-error", "0"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, out, "003_three.sql")
+	assert.Contains(t, out, "001_one.sql")
+
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `Pending +-- 001_one.sql`, out)
+	assert.NotRegexp(t, `Pending +-- 002_two.sql`, out)
+	assert.Regexp(t, `Pending +-- 003_three.sql`, out)
+}
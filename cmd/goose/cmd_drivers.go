@@ -1,6 +1,13 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
 
 var driversCmd = &Command{
 	Name:    "drivers",
@@ -10,9 +17,24 @@ var driversCmd = &Command{
 	Run:     driversRun,
 }
 
-func driversRun(cmd *Command, args ...string) {
+func driversRun(cmd *Command, args ...string) int {
 	fmt.Println("Drivers:")
-	for _, d := range drivers {
-		fmt.Printf("\t%s\n", d)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\tDriver\tDialect\tImport")
+	for _, name := range drivers {
+		d := goose.DriverDefaults(name)
+		fmt.Fprintf(w, "\t%s\t%s\t%s\n", name, dialectName(d.Dialect), d.Import)
+	}
+	w.Flush()
+	return 0
+}
+
+// dialectName is the type name of the dialect, without its package.
+func dialectName(dialect goose.SqlDialect) string {
+	if dialect == nil {
+		return "-"
 	}
+	name := fmt.Sprintf("%T", dialect)
+	return name[strings.LastIndex(name, ".")+1:]
 }
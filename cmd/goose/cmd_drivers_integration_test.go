@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationDrivers(t *testing.T) {
+	status, out, err := run([]string{"drivers"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `sqlite3 +Sqlite3Dialect +github.com/mattn/go-sqlite3\n`, out)
+	assert.Regexp(t, `redshift +RedshiftDialect +github.com/lib/pq\n`, out)
+}
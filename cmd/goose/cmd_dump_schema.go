@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var dumpSchemaCmd = &Command{
+	Name:    "dump-schema",
+	Usage:   "",
+	Summary: "Print the SQL creating the goose_db_version table, without connecting to the DB",
+	Help:    `dump-schema extended help here...`,
+	Run:     dumpSchemaRun,
+}
+
+func dumpSchemaRun(cmd *Command, args ...string) int {
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(goose.CreateVersionTableSql(conf))
+	return 0
+}
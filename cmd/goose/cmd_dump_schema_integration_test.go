@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationDumpSchema(t *testing.T) {
+	// the DSN points nowhere, as no connection should be made
+	env := map[string]string{
+		"DB_DRIVER": "postgres",
+		"DB_DSN":    "host=/nonexistent",
+	}
+
+	status, out, err := run([]string{"dump-schema"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "CREATE TABLE IF NOT EXISTS \"goose_db_version\" (")
+
+	defer func(schema string) { *flagPgSchema = schema }(*flagPgSchema)
+	status, out, err = run([]string{"-pgschema", "tenant", "dump-schema"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "CREATE TABLE IF NOT EXISTS \"tenant\".\"goose_db_version\" (")
+}
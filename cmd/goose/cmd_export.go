@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"math"
+	"os"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var exportCmd = &Command{
+	Name:    "export",
+	Usage:   "",
+	Summary: "Print the Up statements of the SQL migrations as a single script, without connecting to the DB",
+	Help:    `export extended help here...`,
+	Run:     exportRun,
+}
+
+var exportFrom int64
+var exportTo int64
+var exportOutput string
+
+func init() {
+	exportCmd.Flag.Int64Var(&exportFrom, "from", 0, "only export migrations from this `version` on")
+	exportCmd.Flag.Int64Var(&exportTo, "to", math.MaxInt64, "only export migrations up to this `version`")
+	exportCmd.Flag.StringVar(&exportOutput, "o", "", "write the script to `file` rather than stdout")
+}
+
+func exportRun(cmd *Command, args ...string) int {
+	if len(args) != 0 {
+		cmd.Flag.Usage()
+		return 1
+	}
+	if exportFrom > exportTo {
+		log.Printf("goose: -from %d is after -to %d", exportFrom, exportTo)
+		return 1
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if exportOutput == "" {
+		if err := goose.ExportMigrations(os.Stdout, conf.MigrationsDir, exportFrom, exportTo); err != nil {
+			log.Fatal(err)
+		}
+		return 0
+	}
+
+	f, err := os.Create(exportOutput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = goose.ExportMigrations(f, conf.MigrationsDir, exportFrom, exportTo)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationExport(t *testing.T) {
+	defer func() { exportFrom, exportTo, exportOutput = 0, math.MaxInt64, "" }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	migrations := map[string]string{
+		"001_one.sql":  "-- +goose Up\nCREATE TABLE one(value TEXT);\n\n-- +goose Down\nDROP TABLE one;\n",
+		"002_two.sql":  "-- +goose Up\n-- +goose StatementBegin\nCREATE FUNCTION two() RETURNS int AS $$ BEGIN RETURN 2; END; $$ LANGUAGE plpgsql;\n-- +goose StatementEnd\n\n-- +goose Down\nDROP FUNCTION two();\n",
+		"003_three.go": "package main\n\nimport \"database/sql\"\n\nfunc Up_003(txn *sql.Tx) {}\nfunc Down_003(txn *sql.Tx) {}\n",
+	}
+	for name, src := range migrations {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name), []byte(src), 0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"export"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Equal(t, `-- version 1: 001_one.sql
+CREATE TABLE one(value TEXT);
+
+-- version 2: 002_two.sql
+CREATE FUNCTION two() RETURNS int AS $$ BEGIN RETURN 2; END; $$ LANGUAGE plpgsql;
+
+-- version 3: 003_three.go skipped, go migrations can't be exported
+
+`, out)
+
+	bundle := filepath.Join(td, "bundle.sql")
+	status, out, err = run([]string{"export", "-from", "2", "-to", "2", "-o", bundle}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Empty(t, out)
+
+	bs, err := ioutil.ReadFile(bundle)
+	require.NoError(t, err)
+	assert.NotContains(t, string(bs), "001_one.sql")
+	assert.Contains(t, string(bs), "-- version 2: 002_two.sql\n")
+	assert.NotContains(t, string(bs), "003_three.go")
+	assert.NotContains(t, string(bs), "+goose")
+
+	// nothing is run against the DB
+	_, err = os.Stat(filepath.Join(td, "goose.db"))
+	assert.True(t, os.IsNotExist(err))
+}
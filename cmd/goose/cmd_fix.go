@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var fixCmd = &Command{
+	Name:    "fix",
+	Usage:   "",
+	Summary: "Renumber timestamped migrations sequentially",
+	Help:    `fix extended help here...`,
+	Run:     fixRun,
+}
+
+func fixRun(cmd *Command, args ...string) int {
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := goose.FixMigrations(conf.MigrationsDir); err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
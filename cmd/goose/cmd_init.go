@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var initCmd = &Command{
+	Name:    "init",
+	Usage:   "",
+	Summary: "Create the goose_db_version table, optionally at a baseline version",
+	Help:    `init extended help here...`,
+	Run:     initRun,
+}
+
+var initBaseline int64
+
+func init() {
+	initCmd.Flag.Int64Var(&initBaseline, "baseline", 0, "record the migrations up to this `version` as applied, without running them")
+}
+
+func initRun(cmd *Command, args ...string) int {
+	if len(args) != 0 {
+		cmd.Flag.Usage()
+		return 1
+	}
+	if initBaseline < 0 {
+		log.Printf("goose: invalid baseline %d", initBaseline)
+		return 1
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	if initBaseline == 0 {
+		if _, err := goose.EnsureDBVersion(conf, db); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("goose: initialized the version table")
+		return 0
+	}
+
+	if err := goose.BaselineDBVersion(conf, db, initBaseline); err != nil {
+		log.Printf("goose: %s", err)
+		return 1
+	}
+	fmt.Printf("goose: initialized the version table at baseline %d\n", initBaseline)
+	return 0
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationInit_baseline(t *testing.T) {
+	defer func() { initBaseline = 0 }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql", "003_three.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	// not a migration
+	status, _, err := run([]string{"init", "-baseline", "4"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+
+	status, out, err := run([]string{"init", "-baseline", "2"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "baseline 2")
+
+	status, out, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "001_one.sql")
+	assert.NotContains(t, out, "002_two.sql")
+	assert.Contains(t, out, "003_three.sql")
+
+	// the db has been migrated now
+	status, _, err = run([]string{"init", "-baseline", "2"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+
+	status, out, err = run([]string{"init", "-baseline", "0"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "initialized the version table")
+}
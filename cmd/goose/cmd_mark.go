@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var markCmd = &Command{
+	Name:    "mark",
+	Usage:   "<version> [up|down]",
+	Summary: "Record a migration as applied, or rolled back, without running it",
+	Help:    `mark extended help here...`,
+	Run:     markRun,
+}
+
+func markRun(cmd *Command, args ...string) int {
+	if len(args) != 1 && len(args) != 2 {
+		cmd.Flag.Usage()
+		return 1
+	}
+
+	version, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || version <= 0 {
+		log.Printf("goose: invalid version %q", args[0])
+		return 1
+	}
+
+	direction := goose.DirectionUp
+	if len(args) == 2 {
+		switch args[1] {
+		case "up":
+		case "down":
+			direction = goose.DirectionDown
+		default:
+			log.Printf("goose: invalid direction %q, must be up or down", args[1])
+			return 1
+		}
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	log.Printf("goose: WARNING: only recording version %d as %s, the migration itself is NOT run", version, direction)
+
+	if err := goose.MarkMigration(conf, db, version, direction); err != nil {
+		log.Printf("goose: %s", err)
+		return 1
+	}
+
+	fmt.Printf("goose: marked version %d %s\n", version, direction)
+	return 0
+}
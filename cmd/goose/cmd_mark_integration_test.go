@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationMark(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "001_one.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE one(id INT);\n\n-- +goose Down\nDROP TABLE one;\n"),
+		0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "002_two.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE two(id INT);\n\n-- +goose Down\nDROP TABLE two;\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"mark", "1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: marked version 1 up")
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 1\n")
+
+	// only the unmarked migration is run
+	status, out, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "001_one.sql")
+	assert.Contains(t, out, "002_two.sql")
+
+	status, _, err = run([]string{"mark", "2", "down"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 1\n")
+
+	// not a migration, or not a direction
+	for _, args := range [][]string{{"mark", "3"}, {"mark", "abc"}, {"mark", "1", "sideways"}} {
+		status, _, err = run(args, env)
+		require.NoError(t, err)
+		assert.Equal(t, 1, status, "%v", args)
+	}
+}
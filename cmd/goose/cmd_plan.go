@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var planCmd = &Command{
+	Name:    "plan",
+	Usage:   "<version>",
+	Summary: "Print the migrations which would run to migrate to the given version",
+	Help:    `plan extended help here...`,
+	Run:     planRun,
+}
+
+func planRun(cmd *Command, args ...string) int {
+	if len(args) != 1 {
+		cmd.Flag.Usage()
+		return 1
+	}
+
+	target, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || target < 0 {
+		log.Printf("goose: invalid version %q", args[0])
+		return 1
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	plan, err := goose.PlanMigrations(conf, db, target)
+	if err != nil {
+		log.Printf("goose: %s", err)
+		return 1
+	}
+
+	if len(plan.Migrations) == 0 {
+		fmt.Printf("goose: no migrations to run. current version: %d, target: %d\n", plan.Current, plan.Target)
+		return 0
+	}
+	fmt.Printf("goose: plan, current version: %d, target: %d\n", plan.Current, plan.Target)
+	for _, m := range plan.Migrations {
+		fmt.Printf("    %-4s  %s\n", plan.Direction, filepath.Base(m.Source))
+	}
+	return 0
+}
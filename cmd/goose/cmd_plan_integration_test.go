@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationPlan(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one", "002_two", "003_three"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name+".sql"),
+			[]byte("-- +goose Up\nCREATE TABLE "+name[4:]+"(id INT);\n\n-- +goose Down\nDROP TABLE "+name[4:]+";\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"plan", "2"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: plan, current version: 0, target: 2\n    up    001_one.sql\n    up    002_two.sql\n")
+	assert.NotContains(t, out, "003_three.sql")
+
+	// nothing was applied
+	status, out, err = run([]string{"plan", "3"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "001_one.sql")
+
+	status, _, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	status, out, err = run([]string{"plan", "1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: plan, current version: 3, target: 1\n    down  003_three.sql\n    down  002_two.sql\n")
+
+	status, out, err = run([]string{"plan", "3"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: no migrations to run. current version: 3, target: 3")
+
+	for _, args := range [][]string{{"plan"}, {"plan", "abc"}, {"plan", "4"}} {
+		status, _, err = run(args, env)
+		require.NoError(t, err)
+		assert.Equal(t, 1, status, "%v", args)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var recreateVersionTableCmd = &Command{
+	Name:    "recreate-version-table",
+	Usage:   "-yes",
+	Summary: "Drop and recreate the version table with the current schema, keeping the applied versions",
+	Help:    `recreate-version-table extended help here...`,
+	Run:     recreateVersionTableRun,
+}
+
+var recreateVersionTableYes bool
+
+func init() {
+	recreateVersionTableCmd.Flag.BoolVar(&recreateVersionTableYes, "yes", false, "confirm dropping and recreating the version table of the environment's DB")
+}
+
+func recreateVersionTableRun(cmd *Command, args ...string) int {
+	if len(args) != 0 {
+		cmd.Flag.Usage()
+		return 1
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !recreateVersionTableYes {
+		log.Printf("goose: recreate-version-table drops the version table, losing its history, and records the applied versions in a new one, use -yes to confirm")
+		return 1
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	version, err := goose.RecreateVersionTable(conf, db)
+	if err != nil {
+		log.Printf("goose: %s", err)
+		return 1
+	}
+
+	fmt.Printf("goose: recreated the version table, at version %d\n", version)
+	return 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationRecreateVersionTable(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "20010203040506_one.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE one(id INT);\n\n-- +goose Down\nDROP TABLE one;\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	defer func() { recreateVersionTableYes = false }()
+
+	// it must be confirmed
+	status, _, err = run([]string{"recreate-version-table"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+
+	status, out, err := run([]string{"recreate-version-table", "-yes"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: recreated the version table, at version 20010203040506\n")
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 20010203040506\n")
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/CloudCom/goose/lib/goose"
@@ -14,27 +15,73 @@ var redoCmd = &Command{
 	Run:     redoRun,
 }
 
-func redoRun(cmd *Command, args ...string) {
+var redoTo int64
+var redoYes bool
+
+func init() {
+	redoCmd.Flag.Int64Var(&redoTo, "to", -1, "re-run every migration after this `version`, rather than only the latest")
+	redoCmd.Flag.BoolVar(&redoYes, "yes", false, "confirm rolling back destructive migrations in a protected environment")
+}
+
+func redoRun(cmd *Command, args ...string) int {
 	conf, err := dbConfFromFlags()
 	if err != nil {
 		log.Fatal("Error loading config file:", err)
 	}
+	conf.ConfirmDestructive = redoYes
 
 	current, err := goose.GetDBVersion(conf)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	previous, err := goose.GetPreviousDBVersion(conf.MigrationsDir, current)
-	if err != nil {
+	var previous int64
+	if redoTo >= 0 {
+		if err := validateRedoTarget(conf, redoTo, current); err != nil {
+			log.Printf("goose: %s", err)
+			return 1
+		}
+		previous = redoTo
+	} else if previous, err = goose.GetPreviousDBVersion(conf.MigrationsDir, current); err != nil {
 		log.Fatal(err)
 	}
 
-	if err := goose.RunMigrations(conf, conf.MigrationsDir, previous); err != nil {
+	if err := runMigrations(conf, previous); err == errInterrupted {
+		return interruptedStatus
+	} else if err != nil {
 		log.Fatal(err)
 	}
 
-	if err := goose.RunMigrations(conf, conf.MigrationsDir, current); err != nil {
+	if err := runMigrations(conf, current); err == errInterrupted {
+		return interruptedStatus
+	} else if err != nil {
 		log.Fatal(err)
 	}
+
+	if redoTo >= 0 {
+		fmt.Printf("goose: redone the migrations from version %d to %d\n", previous, current)
+	}
+	return 0
+}
+
+// validateRedoTarget checks the -to version is a migration, or 0, below the
+// current version.
+func validateRedoTarget(conf *goose.DBConf, target, current int64) error {
+	if target >= current {
+		return fmt.Errorf("version %d isn't below the current version %d, so there's nothing to redo", target, current)
+	}
+	if target == 0 {
+		return nil
+	}
+
+	migrations, err := goose.CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.Version == target {
+			return nil
+		}
+	}
+	return fmt.Errorf("version %d not found in %s", target, conf.MigrationsDir)
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationRedoTo(t *testing.T) {
+	defer func() { redoTo = -1 }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one", "002_two", "003_three"} {
+		table := name[4:]
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name+".sql"),
+			[]byte("-- +goose Up\nCREATE TABLE "+table+" (id INTEGER);\n\n-- +goose Down\nDROP TABLE "+table+";\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err := run([]string{"redo", "-to", "1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "current version: 3, target: 1")
+	assert.Contains(t, out, "current version: 1, target: 3")
+	assert.Contains(t, out, "goose: redone the migrations from version 1 to 3\n")
+
+	// back where it started
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 3\n")
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "Pending")
+
+	// not below the current version
+	for _, version := range []string{"3", "4"} {
+		status, _, err = run([]string{"redo", "-to", version}, env)
+		require.NoError(t, err)
+		assert.Equal(t, 1, status, version)
+	}
+}
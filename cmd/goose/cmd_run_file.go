@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var runFileCmd = &Command{
+	Name:    "run-file",
+	Usage:   "<path> [up|down]",
+	Summary: "Run a SQL migration file, wherever it is, regardless of the recorded versions",
+	Help:    `run-file extended help here...`,
+	Run:     runFileRun,
+}
+
+var runFileRecord bool
+
+func init() {
+	runFileCmd.Flag.BoolVar(&runFileRecord, "record", false, "record the migration's version in the version table, as a run would")
+}
+
+func runFileRun(cmd *Command, args ...string) int {
+	if len(args) != 1 && len(args) != 2 {
+		cmd.Flag.Usage()
+		return 1
+	}
+	path := args[0]
+
+	direction := goose.DirectionUp
+	if len(args) == 2 {
+		switch args[1] {
+		case "up":
+		case "down":
+			direction = goose.DirectionDown
+		default:
+			log.Printf("goose: invalid direction %q, must be up or down", args[1])
+			return 1
+		}
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	if err := goose.RunMigrationFile(conf, db, path, direction, runFileRecord); err != nil {
+		log.Printf("goose: %s", err)
+		return 1
+	}
+
+	if runFileRecord {
+		fmt.Printf("goose: ran %s %s, and recorded it\n", filepath.Base(path), direction)
+	} else {
+		fmt.Printf("goose: ran %s %s, without recording it\n", filepath.Base(path), direction)
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationRunFile(t *testing.T) {
+	defer func() { runFileRecord = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	// outside of the migrations dir
+	hotfix := filepath.Join(td, "20200101000000_hotfix.sql")
+	err = ioutil.WriteFile(hotfix,
+		[]byte("-- +goose Up\nCREATE TABLE hotfix(id INT);\n\n-- +goose Down\nDROP TABLE hotfix;\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"run-file", hotfix, "up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: ran 20200101000000_hotfix.sql up, without recording it")
+
+	// it's already applied, so can't be applied again
+	status, _, err = run([]string{"run-file", hotfix}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+
+	status, out, err = run([]string{"run-file", "-record", hotfix, "down"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: ran 20200101000000_hotfix.sql down, and recorded it")
+
+	for _, args := range [][]string{{"run-file"}, {"run-file", hotfix, "sideways"}, {"run-file", filepath.Join(td, "missing.sql")}} {
+		status, _, err = run(args, env)
+		require.NoError(t, err)
+		assert.Equal(t, 1, status, "%v", args)
+	}
+}
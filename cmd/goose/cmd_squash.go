@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var squashCmd = &Command{
+	Name:    "squash",
+	Usage:   "",
+	Summary: "Print a baseline migration recreating the DB's schema, to replace the migrations up to its version",
+	Help:    `squash extended help here...`,
+	Run:     squashRun,
+}
+
+var squashTo int64
+var squashOutput string
+
+func init() {
+	squashCmd.Flag.Int64Var(&squashTo, "to", 0, "squash the migrations up to this `version`, which the DB must be at")
+	squashCmd.Flag.StringVar(&squashOutput, "o", "", "write the migration to `file` rather than stdout")
+}
+
+func squashRun(cmd *Command, args ...string) int {
+	if len(args) != 0 || squashTo <= 0 {
+		cmd.Flag.Usage()
+		return 1
+	}
+
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	if squashOutput == "" {
+		if err := goose.SquashMigrations(os.Stdout, conf, db, squashTo); err != nil {
+			log.Printf("goose: %s", err)
+			return 1
+		}
+		return 0
+	}
+
+	f, err := os.Create(squashOutput)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = goose.SquashMigrations(f, conf, db, squashTo)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(squashOutput)
+		log.Printf("goose: %s", err)
+		return 1
+	}
+	fmt.Printf("goose: squashed the migrations up to version %d into %s\n", squashTo, squashOutput)
+	return 0
+}
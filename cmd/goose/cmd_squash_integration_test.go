@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationSquash(t *testing.T) {
+	defer func() { squashTo, squashOutput = 0, "" }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	migrations := map[string]string{
+		"001_one.sql": "-- +goose Up\nCREATE TABLE one(value TEXT);\n\n-- +goose Down\nDROP TABLE one;\n",
+		"002_two.sql": "-- +goose Up\nCREATE TABLE two(value TEXT);\n\n-- +goose Down\nDROP TABLE two;\n",
+	}
+	for name, src := range migrations {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name), []byte(src), 0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// the db isn't at version 1
+	status, _, err = run([]string{"squash", "-to", "1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+
+	status, out, err := run([]string{"squash", "-to", "2"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Contains(t, out, "-- +goose Up\nCREATE TABLE one(value TEXT);\nCREATE TABLE two(value TEXT);\n\n-- +goose Down\n")
+
+	baseline := filepath.Join(td, "002_squashed.sql")
+	status, out, err = run([]string{"squash", "-to", "2", "-o", baseline}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: squashed the migrations up to version 2 into "+baseline)
+
+	bs, err := ioutil.ReadFile(baseline)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "CREATE TABLE two(value TEXT);")
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
+	"text/template"
 	"time"
 
 	"github.com/CloudCom/goose/lib/goose"
@@ -18,59 +21,315 @@ var statusCmd = &Command{
 	Run:     statusRun,
 }
 
+var statusJSON bool
+var statusCheck bool
+var statusPending bool
+var statusOrphans bool
+var statusLimit int
+var statusVersionOrder string
+var statusFormat string
+var statusDBOnly bool
+var statusShort bool
+var statusShowType bool
+
+func init() {
+	statusCmd.Flag.BoolVar(&statusJSON, "json", false, "print the status as a JSON array instead of a table")
+	statusCmd.Flag.BoolVar(&statusCheck, "check", false, "exit with status 1 if any migrations are pending")
+	statusCmd.Flag.BoolVar(&statusPending, "pending", false, "only show pending migrations")
+	statusCmd.Flag.BoolVar(&statusOrphans, "orphans", false, "only show applied versions whose migration file no longer exists")
+	statusCmd.Flag.IntVar(&statusLimit, "limit", 0, "only show the last `N` migrations by version")
+	statusCmd.Flag.StringVar(&statusVersionOrder, "version-order", "filename", "list applied migrations in `filename` or applied order")
+	statusCmd.Flag.StringVar(&statusFormat, "format", "", "print each migration with the given Go `template`, e.g. '{{.Version}} {{.Status}} {{.Source}}'")
+	statusCmd.Flag.BoolVar(&statusShort, "short", false, "print only the current and latest versions, and how many migrations are pending, on one line")
+	statusCmd.Flag.BoolVar(&statusShowType, "show-type", false, "add a column with the type of each migration, sql or go")
+	statusCmd.Flag.BoolVar(&statusDBOnly, "db-only", false, "print every record in the version table as it is, ignoring the migration files")
+}
+
 type StatusData struct {
-	Source string
+	Version    int64      `json:"version"`
+	Source     string     `json:"source"`
+	Type       string     `json:"type"`
+	Applied    bool       `json:"applied"`
+	AppliedAt  *time.Time `json:"applied_at"`
+	OutOfOrder bool       `json:"out_of_order"`
+	Orphan     bool       `json:"orphan"`
+	Actor      string     `json:"actor,omitempty"`
+	ActorHost  string     `json:"actor_host,omitempty"`
+}
+
+// statusLine is what the -format template is executed with for each
+// migration: its StatusData, and Status, being "applied" or "pending".
+type statusLine struct {
+	StatusData
 	Status string
 }
 
-func statusRun(cmd *Command, args ...string) {
+func statusRun(cmd *Command, args ...string) int {
+	if statusLimit < 0 {
+		log.Printf("-limit must not be negative")
+		return 1
+	}
+	if !validVersionOrder(statusVersionOrder) {
+		log.Printf("-version-order must be filename or applied")
+		return 1
+	}
+	if statusShowType && (statusJSON || statusShort || statusDBOnly || statusFormat != "") {
+		log.Printf("-show-type can't be combined with -json, which always has the type, -short, -db-only or -format")
+		return 1
+	}
+	if statusShort && (statusJSON || statusDBOnly || statusFormat != "") {
+		log.Printf("-short can't be combined with -json, -db-only or -format")
+		return 1
+	}
+	var tmpl *template.Template
+	if statusFormat != "" {
+		if statusJSON || statusDBOnly {
+			log.Printf("-format can't be combined with -json or -db-only")
+			return 1
+		}
+		var err error
+		if tmpl, err = template.New("status").Parse(statusFormat); err != nil {
+			log.Printf("invalid -format: %s", err)
+			return 1
+		}
+	}
+	if statusDBOnly && (statusCheck || statusPending || statusOrphans) {
+		log.Printf("-db-only can't be combined with -check, -pending or -orphans, which depend on the migration files")
+		return 1
+	}
 
 	conf, err := dbConfFromFlags()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// collect all migrations
-	migrations, e := goose.CollectMigrations(conf.MigrationsDir)
-	if e != nil {
-		log.Fatal(e)
-	}
-
 	db, e := goose.OpenDBFromDBConf(conf)
 	if e != nil {
 		log.Fatal("couldn't open DB:", e)
 	}
 	defer db.Close()
 
+	if statusDBOnly {
+		return statusDBOnlyRun(conf, db)
+	}
+
 	// must ensure that the version table exists if we're running on a pristine DB
-	if _, e := goose.EnsureDBVersion(conf, db); e != nil {
+	current, e := goose.EnsureDBVersion(conf, db)
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	var migrations []*goose.Migration
+	if statusVersionOrder == "applied" {
+		migrations, e = goose.MigrationStatusInAppliedOrder(conf, db)
+	} else {
+		migrations, e = goose.MigrationStatus(conf, db)
+	}
+	if e != nil {
 		log.Fatal(e)
 	}
 
-	fmt.Printf("goose: status\n")
-	fmt.Println("    Applied At                  Migration")
-	fmt.Println("    =======================================")
+	shown := filterStatus(migrations, statusPending, statusOrphans, statusLimit)
+	if statusShort {
+		latest, e := goose.GetMostRecentDBVersion(conf.MigrationsDir)
+		if e != nil {
+			log.Fatal(e)
+		}
+		pending := 0
+		for _, m := range migrations {
+			if !m.IsApplied {
+				pending++
+			}
+		}
+		fmt.Printf("current: %d, latest: %d, pending: %d\n", current, latest, pending)
+	} else if statusJSON {
+		if e := printStatusJSON(shown); e != nil {
+			log.Fatal(e)
+		}
+	} else if tmpl != nil {
+		if e := printStatusTemplate(tmpl, shown); e != nil {
+			log.Printf("goose: %s", e)
+			return 1
+		}
+	} else {
+		fmt.Printf("goose: status\n")
+		if statusShowType {
+			fmt.Println("    Applied At                  Type     Migration")
+			fmt.Println("    ================================================")
+		} else {
+			fmt.Println("    Applied At                  Migration")
+			fmt.Println("    =======================================")
+		}
+		for _, m := range shown {
+			printMigrationStatus(m, migrationScript(m))
+		}
+	}
+
+	if statusCheck {
+		for _, m := range migrations {
+			if !m.IsApplied {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// statusDBOnlyRun prints the version table's records as they are, without
+// creating the table if it doesn't exist.
+func statusDBOnlyRun(conf *goose.DBConf, db *sql.DB) int {
+	records, err := goose.VersionRecords(conf, db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if statusLimit > 0 && len(records) > statusLimit {
+		records = records[len(records)-statusLimit:]
+	}
+
+	if statusJSON {
+		if err := printVersionRecordsJSON(records); err != nil {
+			log.Fatal(err)
+		}
+		return 0
+	}
+
+	fmt.Printf("goose: status -db-only\n")
+	fmt.Println("    Recorded At                 Version          Applied  Name")
+	fmt.Println("    ============================================================")
+	for _, r := range records {
+		fmt.Printf("    %-24s -- %-16d %-8v %s\n", r.TStamp.Format(time.ANSIC), r.Version, r.IsApplied, r.Name)
+	}
+	return 0
+}
+
+// filterStatus returns the migrations to print: only the pending ones if
+// pending is set, only the orphans if orphans is set, and then only the
+// last limit of them, if limit isn't 0.
+func filterStatus(migrations []*goose.Migration, pending, orphans bool, limit int) []*goose.Migration {
+	if pending || orphans {
+		var ms []*goose.Migration
+		for _, m := range migrations {
+			if (pending && !m.IsApplied) || (orphans && isOrphan(m)) {
+				ms = append(ms, m)
+			}
+		}
+		migrations = ms
+	}
+	if limit > 0 && len(migrations) > limit {
+		migrations = migrations[len(migrations)-limit:]
+	}
+	return migrations
+}
+
+// isOrphan reports whether m is applied in the DB, but its file no longer
+// exists, e.g. because it was deleted.
+func isOrphan(m *goose.Migration) bool {
+	return m.Source == ""
+}
+
+// the file name of the migration, falling back to the name recorded
+// in the DB when the file no longer exists
+func migrationScript(m *goose.Migration) string {
+	if m.Source != "" {
+		return filepath.Base(m.Source)
+	}
+	return m.Name
+}
+
+// statusData returns the StatusData of m.
+func statusData(m *goose.Migration) StatusData {
+	sd := StatusData{
+		Version:    m.Version,
+		Source:     migrationScript(m),
+		Type:       m.Type(),
+		Applied:    m.IsApplied,
+		OutOfOrder: m.OutOfOrder,
+		Orphan:     isOrphan(m),
+		Actor:      m.Actor,
+		ActorHost:  m.ActorHost,
+	}
+	if m.IsApplied {
+		tstamp := m.TStamp
+		sd.AppliedAt = &tstamp
+	}
+	return sd
+}
+
+func printStatusJSON(migrations []*goose.Migration) error {
+	data := make([]StatusData, 0, len(migrations))
 	for _, m := range migrations {
-		printMigrationStatus(db, m.Version, filepath.Base(m.Source))
+		data = append(data, statusData(m))
 	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
 }
 
-func printMigrationStatus(db *sql.DB, version int64, script string) {
-	var row goose.Migration
-	q := fmt.Sprintf("SELECT tstamp, is_applied FROM goose_db_version WHERE version_id=%d ORDER BY tstamp DESC LIMIT 1", version)
-	e := db.QueryRow(q).Scan(&row.TStamp, &row.IsApplied)
+// printStatusTemplate prints each migration on a line of its own, as
+// formatted by tmpl.
+func printStatusTemplate(tmpl *template.Template, migrations []*goose.Migration) error {
+	for _, m := range migrations {
+		line := statusLine{StatusData: statusData(m), Status: "pending"}
+		if m.IsApplied {
+			line.Status = "applied"
+		}
+		if err := tmpl.Execute(os.Stdout, line); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+	return nil
+}
 
-	if e != nil && e != sql.ErrNoRows {
-		log.Fatal(e)
+type VersionRecordData struct {
+	Version   int64     `json:"version"`
+	Applied   bool      `json:"applied"`
+	Tstamp    time.Time `json:"tstamp"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	Actor     string    `json:"actor"`
+	ActorHost string    `json:"actor_host"`
+}
+
+func printVersionRecordsJSON(records []*goose.Migration) error {
+	data := make([]VersionRecordData, 0, len(records))
+	for _, r := range records {
+		data = append(data, VersionRecordData{
+			Version:   r.Version,
+			Applied:   r.IsApplied,
+			Tstamp:    r.TStamp,
+			Name:      r.Name,
+			Checksum:  r.Checksum,
+			Actor:     r.Actor,
+			ActorHost: r.ActorHost,
+		})
 	}
 
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(data)
+}
+
+func printMigrationStatus(m *goose.Migration, script string) {
 	var appliedAt string
 
-	if row.IsApplied {
-		appliedAt = row.TStamp.Format(time.ANSIC)
+	if m.IsApplied {
+		appliedAt = m.TStamp.Format(time.ANSIC)
 	} else {
 		appliedAt = "Pending"
 	}
 
+	if m.OutOfOrder {
+		script += " (applied out of order)"
+	}
+	if isOrphan(m) {
+		script += " ORPHAN (no migration file)"
+	}
+
+	if statusShowType {
+		fmt.Printf("    %-24s -- %-8s %v\n", appliedAt, m.Type(), script)
+		return
+	}
 	fmt.Printf("    %-24s -- %v\n", appliedAt, script)
 }
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationStatus(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `Pending +-- 001_one.sql`, out)
+	assert.Regexp(t, `Pending +-- 002_two.sql`, out)
+
+	status, _, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "Pending")
+	assert.Contains(t, out, "-- 001_one.sql")
+	assert.Contains(t, out, "-- 002_two.sql")
+}
+
+func TestIntegrationStatus_json(t *testing.T) {
+	defer func() { statusJSON = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "003_three.sql"),
+		[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+		0600)
+	require.NoError(t, err)
+
+	status, out, err := run([]string{"status", "-json"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	var data []StatusData
+	require.NoError(t, json.Unmarshal([]byte(out), &data), out)
+	require.Len(t, data, 3)
+
+	assert.Equal(t, int64(1), data[0].Version)
+	assert.Equal(t, "001_one.sql", data[0].Source)
+	assert.True(t, data[0].Applied)
+	assert.NotNil(t, data[0].AppliedAt)
+
+	assert.Equal(t, int64(3), data[2].Version)
+	assert.Equal(t, "003_three.sql", data[2].Source)
+	assert.False(t, data[2].Applied)
+	assert.Nil(t, data[2].AppliedAt)
+	assert.Contains(t, out, `"applied_at": null`)
+}
+
+func TestIntegrationStatus_format(t *testing.T) {
+	defer func() { statusFormat, statusJSON = "", false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	// the first is applied, the second pending
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+		if name == "001_one.sql" {
+			status, _, err := run([]string{"up"}, env)
+			require.NoError(t, err)
+			require.Equal(t, 0, status)
+		}
+	}
+
+	status, out, err := run([]string{"status", "-format", "{{.Version}} {{.Status}} {{.Source}} {{if .AppliedAt}}at{{end}}"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "1 applied 001_one.sql at\n2 pending 002_two.sql \n")
+	assert.NotContains(t, out, "Applied At")
+
+	for _, args := range [][]string{
+		{"status", "-format", "{{.Version"},
+		{"status", "-format", "{{.Nope}}"},
+		{"status", "-json", "-format", "{{.Version}}"},
+	} {
+		statusFormat, statusJSON = "", false
+		status, _, err = run(args, env)
+		require.NoError(t, err)
+		assert.Equal(t, 1, status, "%v", args)
+	}
+}
+
+func TestIntegrationStatus_check(t *testing.T) {
+	defer func() { statusCheck = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "001_one.sql"),
+		[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"status", "-check"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+	assert.Regexp(t, `Pending +-- 001_one.sql`, out)
+
+	status, _, err = run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, _, err = run([]string{"status", "-check"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+}
+
+func TestIntegrationStatus_filter(t *testing.T) {
+	defer func() {
+		statusPending = false
+		statusLimit = 0
+	}()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	writeMigrations := func(names ...string) {
+		for _, name := range names {
+			err := ioutil.WriteFile(filepath.Join(migrationsDir, name),
+				[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+				0600)
+			require.NoError(t, err)
+		}
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	writeMigrations("001_one.sql", "002_two.sql")
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	writeMigrations("003_three.sql", "004_four.sql")
+
+	status, out, err := run([]string{"status", "-pending"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "001_one.sql")
+	assert.NotContains(t, out, "002_two.sql")
+	assert.Contains(t, out, "003_three.sql")
+	assert.Contains(t, out, "004_four.sql")
+
+	status, out, err = run([]string{"status", "-pending=false", "-limit", "3"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "001_one.sql")
+	assert.Contains(t, out, "002_two.sql")
+	assert.Contains(t, out, "004_four.sql")
+
+	status, out, err = run([]string{"status", "-pending", "-limit", "1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "003_three.sql")
+	assert.Contains(t, out, "004_four.sql")
+
+	status, _, err = run([]string{"status", "-limit", "-1"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+}
+
+func TestIntegrationStatus_outOfOrder(t *testing.T) {
+	defer func(allowMissing bool) { *flagAllowMissing = allowMissing }(*flagAllowMissing)
+	defer func() { statusJSON = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	writeMigration := func(name string) {
+		err := ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	writeMigration("001_one.sql")
+	writeMigration("003_three.sql")
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	writeMigration("002_two.sql")
+	status, _, err = run([]string{"-allow-missing", "up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err := run([]string{"-allow-missing=false", "status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "-- 002_two.sql (applied out of order)\n")
+	assert.Contains(t, out, "-- 003_three.sql\n")
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 3\n")
+
+	status, out, err = run([]string{"status", "-json"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	var data []StatusData
+	require.NoError(t, json.Unmarshal([]byte(out), &data), out)
+	require.Len(t, data, 3)
+	assert.False(t, data[0].OutOfOrder)
+	assert.True(t, data[1].OutOfOrder)
+	assert.False(t, data[2].OutOfOrder)
+}
+
+func TestIntegrationStatus_orphans(t *testing.T) {
+	defer func() { statusOrphans, statusJSON = false, false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	err = os.Remove(filepath.Join(migrationsDir, "002_two.sql"))
+	require.NoError(t, err)
+
+	status, out, err := run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "-- 001_one.sql\n")
+	assert.Contains(t, out, "-- 002_two.sql ORPHAN (no migration file)\n")
+
+	status, out, err = run([]string{"status", "-orphans", "-json"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	var data []StatusData
+	require.NoError(t, json.Unmarshal([]byte(out), &data), out)
+	require.Len(t, data, 1)
+	assert.EqualValues(t, 2, data[0].Version)
+	assert.True(t, data[0].Orphan)
+}
+
+func TestIntegrationStatus_dbOnly(t *testing.T) {
+	defer func() { statusDBOnly, statusJSON = false, false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	status, _, err = run([]string{"down"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// the records don't depend on the files
+	err = os.RemoveAll(migrationsDir)
+	require.NoError(t, err)
+
+	status, out, err := run([]string{"status", "-db-only"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `-- 2 +true +002_two.sql\n(.*\n)*.*-- 2 +false +002_two.sql\n`, out)
+
+	status, out, err = run([]string{"status", "-db-only", "-json"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	var data []VersionRecordData
+	require.NoError(t, json.Unmarshal([]byte(out), &data), out)
+	require.Len(t, data, 4)
+	assert.EqualValues(t, 0, data[0].Version)
+	assert.EqualValues(t, 1, data[1].Version)
+	assert.EqualValues(t, 2, data[2].Version)
+	assert.True(t, data[2].Applied)
+	assert.EqualValues(t, 2, data[3].Version)
+	assert.False(t, data[3].Applied)
+}
+
+func TestIntegrationStatus_short(t *testing.T) {
+	defer func() { statusShort = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql", "003_three.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"status", "-short"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "current: 0, latest: 3, pending: 3\n")
+
+	status, _, err = run([]string{"up-one"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err = run([]string{"status", "-short"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "current: 1, latest: 3, pending: 2\n")
+}
+
+func TestIntegrationStatus_showType(t *testing.T) {
+	defer func() { statusShowType, statusJSON = false, false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	// an orphan, and a pending go migration
+	err = os.Remove(filepath.Join(migrationsDir, "002_two.sql"))
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "003_three.go"),
+		[]byte("package main\n\nimport \"database/sql\"\n\nfunc Up_003(txn *sql.Tx) {}\nfunc Down_003(txn *sql.Tx) {}\n"),
+		0600)
+	require.NoError(t, err)
+
+	status, out, err := run([]string{"status", "-show-type"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `-- sql +001_one.sql\n`, out)
+	assert.Regexp(t, `-- unknown +002_two.sql ORPHAN \(no migration file\)\n`, out)
+	assert.Regexp(t, `Pending +-- go +003_three.go\n`, out)
+
+	// flags keep their values between runs
+	statusShowType = false
+	status, out, err = run([]string{"status", "-json"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+
+	var data []StatusData
+	require.NoError(t, json.Unmarshal([]byte(out), &data), out)
+	require.Len(t, data, 3)
+	assert.Equal(t, "sql", data[0].Type)
+	assert.Equal(t, "unknown", data[1].Type)
+	assert.Equal(t, "go", data[2].Type)
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"math"
+	"strings"
 
 	"github.com/CloudCom/goose/lib/goose"
 )
@@ -14,19 +17,203 @@ var upCmd = &Command{
 	Run:     upRun,
 }
 
-func upRun(cmd *Command, args ...string) {
+var upDryRun bool
+var upNoVersioning bool
+var upType string
+var upAllEnvs bool
+var upJSON bool
+var upForce int64
+var upOutOfOrder bool
+var upMin int64
+var upMax int64
+
+func init() {
+	upCmd.Flag.BoolVar(&upDryRun, "dry-run", false, "print the migrations which would run, without running them")
+	upCmd.Flag.BoolVar(&upNoVersioning, "no-versioning", false, "apply every migration without tracking versions, for throw away DBs")
+	upCmd.Flag.StringVar(&upType, "type", "", "only apply `sql` or `go` migrations, stopping at the first of the other type")
+	upCmd.Flag.BoolVar(&upAllEnvs, "all-envs", false, "migrate every environment in the config file in turn")
+	upCmd.Flag.BoolVar(&upJSON, "json", false, "report each migration, and a summary, as JSON objects instead of text")
+	upCmd.Flag.BoolVar(&upOutOfOrder, "out-of-order", false, "apply every pending migration, even those older than the current version")
+	upCmd.Flag.Int64Var(&upForce, "force", 0, "apply the migration with this `version`, even if it's recorded as applied")
+	upCmd.Flag.Int64Var(&upMin, "min", 0, "only apply the migrations from this `version` on")
+	upCmd.Flag.Int64Var(&upMax, "max", 0, "only apply the migrations up to this `version`")
+}
+
+// validateUpBounds checks the -min and -max flags.
+func validateUpBounds() error {
+	if upMin < 0 {
+		return fmt.Errorf("invalid -min version %d", upMin)
+	}
+	if upMax < 0 {
+		return fmt.Errorf("invalid -max version %d", upMax)
+	}
+	if upMax != 0 && upMin > upMax {
+		return fmt.Errorf("-min %d is after -max %d", upMin, upMax)
+	}
+	if upForce != 0 && (upMin != 0 || upMax != 0) {
+		return fmt.Errorf("-force can't be used with -min or -max")
+	}
+	return nil
+}
+
+func upRun(cmd *Command, args ...string) int {
+	if upForce != 0 && upAllEnvs {
+		log.Printf("-force can't be used with -all-envs")
+		return 1
+	}
+	if err := validateUpBounds(); err != nil {
+		log.Printf("%s", err)
+		return 1
+	}
+	if upAllEnvs {
+		return upAllEnvsRun()
+	}
 
 	conf, err := dbConfFromFlags()
 	if err != nil {
 		log.Fatal("Error loading config file:", err)
 	}
+	if upForce != 0 {
+		conf.DryRun = upDryRun
+		conf.JSON = upJSON
+		return forceRun(conf, upForce, goose.DirectionUp)
+	}
+	if err := runUp(conf); err == errInterrupted {
+		return interruptedStatus
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	return 0
+}
 
-	target, err := goose.GetMostRecentDBVersion(conf.MigrationsDir)
+// upAllEnvsRun migrates each environment in the config file, carrying on
+// past failures, and then reports which failed.
+func upAllEnvsRun() int {
+	if *flagEnv != "" {
+		log.Printf("-all-envs can't be used with -env")
+		return 1
+	}
+
+	var envs []string
+	var err error
+	if *flagConfig != "" {
+		envs, err = goose.DBConfFileEnvs(*flagConfig)
+	} else {
+		envs, err = goose.DBConfEnvs(*flagPath)
+	}
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("%s", err)
+		return 1
+	}
+	if len(envs) == 0 {
+		log.Printf("no environments in the config file")
+		return 1
 	}
 
-	if err := goose.RunMigrations(conf, conf.MigrationsDir, target); err != nil {
-		log.Fatal(err)
+	var failed []string
+	for _, env := range envs {
+		fmt.Printf("goose: migrating environment '%s'\n", env)
+		conf, err := dbConfForEnv(env)
+		if err == nil {
+			err = runUp(conf)
+		}
+		if err == errInterrupted {
+			return interruptedStatus
+		}
+		if err != nil {
+			fmt.Printf("goose: FAIL environment '%s': %s\n", env, err)
+			failed = append(failed, env)
+			continue
+		}
+		fmt.Printf("goose: OK    environment '%s'\n", env)
+	}
+
+	fmt.Printf("goose: migrated %d of %d environments\n", len(envs)-len(failed), len(envs))
+	if len(failed) > 0 {
+		fmt.Printf("goose: failed environments: %s\n", strings.Join(failed, ", "))
+		return 1
+	}
+	return 0
+}
+
+// runUp migrates the DB of conf to the most recent version, or to the most
+// recent within the -min and -max bounds.
+func runUp(conf *goose.DBConf) error {
+	conf.DryRun = upDryRun
+	conf.NoVersioning = upNoVersioning
+	conf.MigrationType = upType
+	conf.JSON = upJSON
+	conf.OutOfOrder = upOutOfOrder
+
+	if upMin == 0 && upMax == 0 {
+		target, err := goose.GetMostRecentDBVersion(conf.MigrationsDir)
+		if err != nil {
+			return err
+		}
+		return runMigrations(conf, target)
+	}
+
+	target, err := upBoundedTarget(conf)
+	if err != nil {
+		return err
+	}
+	conf.MinVersion = upMin
+	return runMigrations(conf, target)
+}
+
+// upBoundedTarget returns the most recent version from -min to -max, which
+// up migrates to. It's an error for it to be older than the current version,
+// as up never rolls migrations back.
+func upBoundedTarget(conf *goose.DBConf) (int64, error) {
+	max := upMax
+	if max == 0 {
+		max = math.MaxInt64
+	}
+
+	target := int64(-1)
+	err := goose.WalkMigrations(conf.MigrationsDir, upMin, max, func(m *goose.Migration) error {
+		target = m.Version
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if target < 0 {
+		return 0, fmt.Errorf("no migrations with versions from %d to %d", upMin, max)
+	}
+
+	if conf.NoVersioning {
+		return target, nil
+	}
+	current, err := goose.GetDBVersion(conf)
+	if err != nil {
+		return 0, err
+	}
+	if target < current && !conf.OutOfOrder {
+		return 0, fmt.Errorf("the DB is already at version %d, after the migrations from %d to %d; use -out-of-order to apply them", current, upMin, max)
+	}
+	return target, nil
+}
+
+// forceRun runs the migration with the given version in direction, whatever
+// state it's recorded in.
+func forceRun(conf *goose.DBConf, version int64, direction goose.Direction) int {
+	if version < 0 {
+		log.Printf("goose: invalid version %d", version)
+		return 1
+	}
+
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		log.Fatal("couldn't open DB:", err)
+	}
+	defer db.Close()
+
+	log.Printf("goose: WARNING: forcing version %d %s regardless of its recorded state, which can leave the DB in an inconsistent state", version, direction)
+
+	if err := goose.ForceMigration(conf, db, version, direction); err != nil {
+		log.Printf("goose: %s", err)
+		return 1
 	}
+	return 0
 }
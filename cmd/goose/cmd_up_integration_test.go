@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/CloudCom/goose/lib/goose"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationUp_type(t *testing.T) {
+	defer func() { upType = "" }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	sql := []byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n")
+	for _, name := range []string{"001_one.sql", "003_three.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name), sql, 0600)
+		require.NoError(t, err)
+	}
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "002_two.go"),
+		[]byte("package main\n\nimport \"database/sql\"\n\nfunc Up_002(txn *sql.Tx) {}\nfunc Down_002(txn *sql.Tx) {}\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"up", "-type", "sql"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Contains(t, out, "OK    001_one.sql")
+	assert.Contains(t, out, "skipping 002_two.go")
+	assert.Contains(t, out, "skipping 003_three.sql")
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 1\n")
+}
+
+func TestIntegrationUp_allEnvs(t *testing.T) {
+	defer func(path, env string) { *flagPath, *flagEnv = path, env }(*flagPath, *flagEnv)
+	defer func() { upAllEnvs = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	err = os.MkdirAll(filepath.Join(td, "migrations"), 0700)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(td, "migrations", "001_one.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE one(value TEXT);\n\n-- +goose Down\nDROP TABLE one;\n"),
+		0600)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(td, "dbconf.yml"), []byte(`
+driver: sqlite3
+
+broken:
+    open: `+filepath.Join(td, "missing", "broken.db")+`
+
+production:
+    open: `+filepath.Join(td, "production.db")+`
+
+staging:
+    open: `+filepath.Join(td, "staging.db")+`
+`), 0600)
+	require.NoError(t, err)
+
+	status, out, err := run([]string{"-path", td, "up", "-all-envs"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, out, "goose: FAIL environment 'broken'")
+	assert.Contains(t, out, "goose: OK    environment 'production'")
+	assert.Contains(t, out, "goose: OK    environment 'staging'")
+	assert.Contains(t, out, "goose: migrated 2 of 3 environments")
+	assert.Contains(t, out, "goose: failed environments: broken")
+
+	for _, name := range []string{"production.db", "staging.db"} {
+		_, err = os.Stat(filepath.Join(td, name))
+		assert.NoError(t, err, name)
+	}
+
+	status, _, err = run([]string{"-path", td, "-env", "staging", "up", "-all-envs"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+}
+
+func TestIntegrationUpDown_json(t *testing.T) {
+	defer func() { upJSON, downJSON = false, false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+	for _, name := range []string{"001_one.sql", "002_two.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"up", "-json"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 3, out)
+	for i, name := range []string{"001_one.sql", "002_two.sql"} {
+		var m goose.MigrationReport
+		require.NoError(t, json.Unmarshal([]byte(lines[i]), &m))
+		assert.Equal(t, filepath.Join(migrationsDir, name), m.Source)
+		assert.Equal(t, "up", m.Direction)
+		assert.True(t, m.OK)
+	}
+	var sum goose.SummaryReport
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &sum))
+	assert.Equal(t, "summary", sum.Type)
+	assert.Equal(t, 2, sum.Migrations)
+
+	status, out, err = run([]string{"down", "-json"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	require.Len(t, lines, 2, out)
+	var m goose.MigrationReport
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &m))
+	assert.EqualValues(t, 2, m.Version)
+	assert.Equal(t, "down", m.Direction)
+}
+
+func TestIntegrationUpDown_force(t *testing.T) {
+	defer func() { upForce, downForce = 0, 0 }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	err = ioutil.WriteFile(filepath.Join(td, "001_one.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE one(value TEXT);\n\n-- +goose Down\nDROP TABLE one;\n"),
+		0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(td, "002_two.sql"),
+		[]byte("-- +goose Up\nINSERT INTO one(value) VALUES('two');\n\n-- +goose Down\nDELETE FROM one;\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": td,
+	}
+
+	status, _, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err := run([]string{"up", "-force", "2"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: forcibly applying 002_two.sql")
+	assert.Contains(t, out, "OK    002_two.sql")
+
+	status, out, err = run([]string{"down", "-force", "2"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: forcibly rolling back 002_two.sql")
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 1\n")
+
+	// not a migration
+	status, _, err = run([]string{"up", "-force", "3"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+}
+
+func TestIntegrationUp_minMax(t *testing.T) {
+	defer func() { upMin, upMax = 0, 0 }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	sql := []byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n")
+	for _, name := range []string{"001_one.sql", "002_two.sql", "003_three.sql", "004_four.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name), sql, 0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"up", "-min", "3", "-max", "2"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+
+	status, out, err := run([]string{"up", "-min", "0", "-max", "1"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Contains(t, out, "OK    001_one.sql")
+
+	status, out, err = run([]string{"up", "-min", "3", "-max", "3"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Contains(t, out, "OK    003_three.sql")
+	assert.NotContains(t, out, "002_two.sql")
+	assert.NotContains(t, out, "004_four.sql")
+
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `Pending +-- 002_two\.sql`, out)
+	assert.Regexp(t, `Pending +-- 004_four\.sql`, out)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var upOneCmd = &Command{
+	Name:    "up-one",
+	Usage:   "",
+	Summary: "Apply only the next pending migration",
+	Help:    `up-one extended help here...`,
+	Run:     upOneRun,
+}
+
+func upOneRun(cmd *Command, args ...string) int {
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	current, err := goose.GetDBVersion(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	next, err := goose.GetNextDBVersion(conf.MigrationsDir, current)
+	if err == goose.ErrNoNextVersion {
+		fmt.Printf("goose: already at the most recent version %d, nothing to apply\n", current)
+		return 0
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	if err = runMigrations(conf, next); err == errInterrupted {
+		return interruptedStatus
+	} else if err != nil {
+		log.Fatal(err)
+	}
+
+	current, err = goose.GetDBVersion(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("goose: current version %d\n", current)
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationUpOne(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql", "003_three.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"up-one"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: current version 1\n")
+
+	// only 2 is applied, leaving 3 pending
+	status, out, err = run([]string{"up-one"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "002_two.sql")
+	assert.NotContains(t, out, "003_three.sql")
+	assert.Contains(t, out, "goose: current version 2\n")
+
+	status, out, err = run([]string{"status"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Regexp(t, `Pending +-- 003_three.sql`, out)
+	assert.NotRegexp(t, `Pending +-- 002_two.sql`, out)
+
+	status, _, err = run([]string{"up-one"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err = run([]string{"up-one"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "nothing to apply")
+}
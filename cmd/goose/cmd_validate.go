@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+var validateCmd = &Command{
+	Name:    "validate",
+	Usage:   "",
+	Summary: "Check the migrations for problems, without connecting to the DB",
+	Help:    `validate extended help here...`,
+	Run:     validateRun,
+}
+
+func validateRun(cmd *Command, args ...string) int {
+	conf, err := dbConfFromFlags()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	problems, err := goose.ValidateMigrations(conf.MigrationsDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("goose: found %d problems\n", len(problems))
+		return 1
+	}
+
+	fmt.Println("goose: migrations are valid")
+	return 0
+}
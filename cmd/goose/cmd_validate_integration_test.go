@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationValidate(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "001_one.sql"),
+		[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+		0600)
+	require.NoError(t, err)
+
+	// the DSN points nowhere, as no connection should be made
+	env := map[string]string{
+		"DB_DRIVER":         "postgres",
+		"DB_DSN":            "host=/nonexistent",
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"validate"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "migrations are valid")
+
+	for _, name := range []string{"002_two.sql", "002_dup.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	status, out, err = run([]string{"validate"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, out, "002_dup.sql: missing '-- +goose Down' section")
+	assert.Contains(t, out, "002_two.sql: version 2 is also used by")
+	assert.Contains(t, out, "found 2 problems")
+}
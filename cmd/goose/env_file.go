@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// loadEnvFile sets the environment variables given as KEY=VALUE lines in
+// the dotenv file at path, so the config picks them up as if they'd been
+// exported. Variables already set in the environment are left as they are.
+//
+// Blank lines and lines starting with # are skipped, and a leading export is
+// allowed. Values may be quoted: double quoted values are unescaped as Go
+// strings, single quoted ones are taken literally, and unquoted ones end at
+// a " #" comment.
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, val, err := parseEnvLine(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %s", path, n, err)
+		}
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, val); err != nil {
+			return fmt.Errorf("%s:%d: %s", path, n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// parseEnvLine splits a line of a dotenv file into its key and value.
+func parseEnvLine(line string) (key, val string, err error) {
+	line = strings.TrimPrefix(line, "export ")
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", "", fmt.Errorf("expected KEY=VALUE, got %q", line)
+	}
+	key = strings.TrimSpace(line[:i])
+	if key == "" || strings.ContainsAny(key, " \t") {
+		return "", "", fmt.Errorf("invalid variable name %q", key)
+	}
+
+	val = strings.TrimSpace(line[i+1:])
+	switch {
+	case strings.HasPrefix(val, `"`):
+		end := closingQuote(val)
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted value for %s", key)
+		}
+		if val, err = strconv.Unquote(val[:end+1]); err != nil {
+			return "", "", fmt.Errorf("invalid quoted value for %s: %s", key, err)
+		}
+	case strings.HasPrefix(val, "'"):
+		end := strings.Index(val[1:], "'")
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated quoted value for %s", key)
+		}
+		val = val[1 : end+1]
+	default:
+		if j := strings.Index(val, " #"); j >= 0 {
+			val = strings.TrimSpace(val[:j])
+		}
+	}
+	return key, val, nil
+}
+
+// closingQuote returns the index of the double quote closing the value
+// starting with one, skipping escaped quotes, or -1 if there isn't one.
+func closingQuote(val string) int {
+	for i := 1; i < len(val); i++ {
+		switch val[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
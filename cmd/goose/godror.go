@@ -0,0 +1,11 @@
+// +build oracle
+
+package main
+
+// including godror, which needs cgo and the Oracle client libraries,
+// so is only built with the oracle tag
+import _ "github.com/godror/godror"
+
+func init() {
+	drivers = append(drivers, "godror")
+}
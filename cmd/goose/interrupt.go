@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/CloudCom/goose/lib/goose"
+)
+
+// interruptedStatus is the exit status after a migration is interrupted,
+// as for a process killed by SIGINT.
+const interruptedStatus = 130
+
+// errInterrupted is returned by runMigrations once it has reported a
+// migration cut short by SIGINT or SIGTERM.
+var errInterrupted = errors.New("migration interrupted")
+
+// runMigrations migrates the DB of conf to target, like goose.RunMigrations,
+// but cancels the migration on SIGINT or SIGTERM, so the statement in
+// progress is rolled back before goose exits. A second signal exits at once.
+func runMigrations(conf *goose.DBConf, target int64) error {
+	db, err := goose.OpenDBFromDBConf(conf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := interruptContext()
+	defer stop()
+
+	obs := &inFlightObserver{next: conf.Observer}
+	conf.Observer = obs
+	defer func() { conf.Observer = obs.next }()
+
+	err = goose.RunMigrationsContext(ctx, conf, conf.MigrationsDir, target, db)
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+
+	m := obs.current()
+	switch {
+	case conf.SingleTransaction:
+		fmt.Println("goose: migration interrupted, rolled back every migration of the run")
+	case m == nil:
+		fmt.Println("goose: migration interrupted")
+	default:
+		fmt.Printf("goose: migration interrupted, rolled back version %d\n", m.Version)
+	}
+	return errInterrupted
+}
+
+// interruptContext returns a context cancelled by the first SIGINT or
+// SIGTERM, until stop is called. The process exits on the second.
+func interruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigs:
+		case <-done:
+			return
+		}
+		log.Printf("goose: interrupted, rolling back the migration in progress, interrupt again to exit at once")
+		cancel()
+
+		select {
+		case <-sigs:
+			log.Printf("goose: interrupted again, exiting without waiting for the rollback")
+			os.Exit(interruptedStatus)
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
+
+// inFlightObserver keeps track of the migration being run, passing the
+// notifications on to next.
+type inFlightObserver struct {
+	next goose.Observer
+
+	mu sync.Mutex
+	m  *goose.Migration
+}
+
+func (o *inFlightObserver) OnMigrationStart(m *goose.Migration, direction goose.Direction) {
+	o.mu.Lock()
+	o.m = m
+	o.mu.Unlock()
+	if o.next != nil {
+		o.next.OnMigrationStart(m, direction)
+	}
+}
+
+func (o *inFlightObserver) OnMigrationEnd(m *goose.Migration, direction goose.Direction, duration time.Duration, err error) {
+	if err == nil {
+		o.mu.Lock()
+		o.m = nil
+		o.mu.Unlock()
+	}
+	if o.next != nil {
+		o.next.OnMigrationEnd(m, direction, duration, err)
+	}
+}
+
+// current returns the migration which was being run when it was
+// interrupted, if any.
+func (o *inFlightObserver) current() *goose.Migration {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.m
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationUp_interrupted(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "001_one.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE one(id INTEGER);\n\n-- +goose Down\nDROP TABLE one;\n"), 0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "002_slow.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE two(id INTEGER);\nWITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 10000000000) SELECT count(*) FROM c;\n\n-- +goose Down\nDROP TABLE two;\n"), 0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	time.AfterFunc(time.Second, func() { syscall.Kill(os.Getpid(), syscall.SIGINT) })
+	start := time.Now()
+	status, out, err := run([]string{"up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, interruptedStatus, status)
+	assert.Contains(t, out, "goose: migration interrupted, rolled back version 2\n")
+	assert.True(t, time.Since(start) < 10*time.Second, "migration did not abort promptly")
+
+	status, out, err = run([]string{"dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 1\n")
+}
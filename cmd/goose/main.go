@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
 
@@ -12,22 +14,148 @@ import (
 
 // global options. available to any subcommands.
 var flagPath = flag.String("path", "db", "folder containing db info")
-var flagEnv = flag.String("env", "development", "which DB environment to use")
+var flagEnv = flag.String("env", "", "which DB environment to use, defaults to $GOOSE_ENV or development")
+var flagConfig = flag.String("config", "", "the dbconf file to use, rather than looking for one from -path")
+var flagEnvFile = flag.String("env-file", "", "load environment variables from this dotenv `file` before reading the config, without overriding those already set")
+var flagNoConfigFile = flag.Bool("no-config-file", false, "configure the DB from environment variables only, ignoring any dbconf file, as with $GOOSE_NO_CONFIG")
+var flagMigrationsDir = flag.String("migrations-dir", "", "folder containing the migrations, overrides the config")
+var flagMigrationExt = flag.String("migration-ext", "", "comma separated `ext=type` pairs, e.g. psql=sql, collecting files with other extensions as sql or go migrations")
+var flagRecursive = flag.Bool("recursive", false, "also collect the migrations in subfolders of the migrations folder")
+var flagPgSchema = flag.String("pgschema", "", "which postgres schema holds the goose_db_version table, overrides the config")
+var flagNoLock = flag.Bool("nolock", false, "don't lock the DB while migrating, for DBs that don't support it")
+var flagLockTimeout = flag.Duration("lock-timeout", 0, "fail if the migration lock, or with postgres any lock, isn't acquired within this `duration`, overrides the config")
+var flagWait = flag.Duration("wait", 0, "wait up to this `duration` for the DB to be reachable before running the command, overrides the config")
+var flagSkipVerify = flag.Bool("skip-verify", false, "don't check whether applied migrations have been modified")
+var flagUpsertVersions = flag.Bool("upsert-versions", false, "keep a single row per version in the goose_db_version table")
+var flagNoInitialVersion = flag.Bool("no-initial-version", false, "don't record version 0 when creating the goose_db_version table")
+var flagCompileGo = flag.Bool("compile-go", false, "build each go migration once, rather than `go run`ning it every time")
+var flagKeepTemp = flag.Bool("keep-temp", false, "keep the generated files of a failed go migration, for debugging")
+var flagAllowMissing = flag.Bool("allow-missing", false, "apply pending migrations which are older than the current version")
+var flagAllowAhead = flag.Bool("allow-ahead", false, "migrate a database with applied versions after the most recent migration")
+var flagExclude = flag.String("exclude", "", "comma separated versions to skip when migrating")
+var flagPrintSQL = flag.Bool("print-sql", false, "print each statement of sql migrations as it's executed")
+var flagSingleTransaction = flag.Bool("single-transaction", false, "run all the migrations in one transaction, rolling them all back on failure")
+var flagLogFile = flag.String("log-file", "", "append a JSON record of each migration run to this `file`")
+var flagParallelism = flag.Int("parallelism", 0, "run up to `N` consecutive NO TRANSACTION migrations annotated PARALLEL at once, overrides the config")
 
+// the config driver names of the drivers compiled in
 var drivers []string
 
+// dbEnv is the DB environment to use: the -env flag, falling back to
+// $GOOSE_ENV and then development.
+func dbEnv() string {
+	if *flagEnv != "" {
+		return *flagEnv
+	}
+	if env := os.Getenv("GOOSE_ENV"); env != "" {
+		return env
+	}
+	return "development"
+}
+
 // helper to create a DBConf from the given flags
-func dbConfFromFlags() (dbconf *goose.DBConf, err error) {
-	return goose.NewDBConf(*flagPath, *flagEnv)
+func dbConfFromFlags() (*goose.DBConf, error) {
+	return dbConfForEnv(dbEnv())
+}
+
+// dbConfForEnv is dbConfFromFlags for the given environment.
+func dbConfForEnv(env string) (dbconf *goose.DBConf, err error) {
+	if *flagConfig != "" && *flagNoConfigFile {
+		return nil, fmt.Errorf("-config and -no-config-file can't be combined")
+	}
+	if *flagConfig != "" {
+		dbconf, err = goose.NewDBConfFromFile(*flagConfig, env)
+	} else if *flagNoConfigFile {
+		dbconf, err = goose.NewDBConfFromEnv(*flagPath, env)
+	} else {
+		dbconf, err = goose.NewDBConf(*flagPath, env)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if *flagMigrationsDir != "" {
+		// relative to the working dir, unlike migrationsDir in the config
+		dirs := filepath.SplitList(*flagMigrationsDir)
+		for i, dir := range dirs {
+			if dirs[i], err = filepath.Abs(dir); err != nil {
+				return nil, err
+			}
+		}
+		dbconf.MigrationsDir = strings.Join(dirs, string(os.PathListSeparator))
+	}
+	if *flagMigrationExt != "" {
+		for _, s := range strings.Split(*flagMigrationExt, ",") {
+			parts := strings.SplitN(strings.TrimSpace(s), "=", 2)
+			if len(parts) != 2 || parts[0] == "" || (parts[1] != "sql" && parts[1] != "go") {
+				return nil, fmt.Errorf("invalid -migration-ext %q, expected ext=sql or ext=go", s)
+			}
+			goose.RegisterMigrationExtension("."+strings.TrimPrefix(parts[0], "."), parts[1])
+		}
+	}
+	if *flagRecursive {
+		dbconf.MigrationsDir = goose.RecursiveMigrationsDir(dbconf.MigrationsDir)
+	}
+	if *flagPgSchema != "" {
+		dbconf.Schema = *flagPgSchema
+	}
+	dbconf.NoLock = *flagNoLock
+	if *flagLockTimeout != 0 {
+		dbconf.LockTimeout = *flagLockTimeout
+	}
+	if *flagWait != 0 {
+		dbconf.Wait = *flagWait
+	}
+	dbconf.SkipVerify = *flagSkipVerify
+	dbconf.AllowMissing = *flagAllowMissing
+	dbconf.AllowAhead = *flagAllowAhead
+	dbconf.CompileGoMigrations = *flagCompileGo
+	dbconf.KeepTemp = *flagKeepTemp
+	dbconf.UpsertVersions = *flagUpsertVersions
+	dbconf.NoInitialVersion = *flagNoInitialVersion
+	dbconf.SingleTransaction = *flagSingleTransaction
+	dbconf.PrintSQL = *flagPrintSQL
+	if *flagLogFile != "" {
+		dbconf.LogFile = *flagLogFile
+	}
+	if *flagParallelism != 0 {
+		dbconf.Parallelism = *flagParallelism
+	}
+
+	if *flagExclude != "" {
+		for _, s := range strings.Split(*flagExclude, ",") {
+			v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid -exclude version %q", s)
+			}
+			dbconf.ExcludeVersions = append(dbconf.ExcludeVersions, v)
+		}
+	}
+
+	return dbconf, nil
 }
 
 var commands = []*Command{
 	upCmd,
+	upOneCmd,
 	downCmd,
+	downToCmd,
+	planCmd,
+	markCmd,
+	runFileCmd,
+	initCmd,
 	redoCmd,
 	statusCmd,
 	createCmd,
+	fixCmd,
+	convertCmd,
+	recreateVersionTableCmd,
+	validateCmd,
+	auditCmd,
 	dbVersionCmd,
+	dumpSchemaCmd,
+	exportCmd,
+	squashCmd,
 	driversCmd,
 }
 
@@ -38,6 +166,13 @@ func imain() int {
 	flag.Usage = usage
 	flag.Parse()
 
+	if *flagEnvFile != "" {
+		if err := loadEnvFile(*flagEnvFile); err != nil {
+			fmt.Printf("error: loading env file: %s\n", err)
+			return 1
+		}
+	}
+
 	args := flag.Args()
 	if len(args) == 0 || args[0] == "-h" {
 		flag.Usage()
@@ -59,8 +194,8 @@ func imain() int {
 		return 1
 	}
 
-	cmd.Exec(args[1:])
-	return 0
+	defer goose.CleanupGoMigrationCache()
+	return cmd.Exec(args[1:])
 }
 
 func usage() {
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIntegrationPathAndEnvFlags(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	confDir := filepath.Join(td, "config", "database")
+	err = os.MkdirAll(confDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(confDir, "dbconf.yml"), []byte(`
+development:
+    driver: sqlite3
+    open: `+filepath.Join(td, "dev.db")+`
+    migrationsDir: dev-migrations
+
+ci:
+    driver: sqlite3
+    open: `+filepath.Join(td, "ci.db")+`
+    migrationsDir: ci-migrations
+`), 0600)
+	require.NoError(t, err)
+
+	defer func(path, env string) { *flagPath, *flagEnv = path, env }(*flagPath, *flagEnv)
+
+	status, out, err := run([]string{"-path", confDir, "-env", "ci", "create", "mymigration"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, filepath.Join(confDir, "ci-migrations"))
+
+	status, out, err = run([]string{"-path", confDir, "-env", "development", "create", "mymigration"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, filepath.Join(confDir, "dev-migrations"))
+}
+
+func TestIntegrationConfigFlag(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	// a config -path would find, which -config should win over
+	err = os.MkdirAll(filepath.Join(td, "db"), 0700)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(td, "db", "dbconf.yml"), []byte(`
+development:
+    driver: sqlite3
+    open: `+filepath.Join(td, "wrong.db")+`
+    migrationsDir: wrong-migrations
+`), 0600)
+	require.NoError(t, err)
+
+	confDir := filepath.Join(td, "services", "billing")
+	err = os.MkdirAll(confDir, 0700)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(confDir, "billing.yml"), []byte(`
+development:
+    driver: sqlite3
+    open: `+filepath.Join(td, "billing.db")+`
+    migrationsDir: migrations
+`), 0600)
+	require.NoError(t, err)
+
+	defer func(path, config string) { *flagPath, *flagConfig = path, config }(*flagPath, *flagConfig)
+
+	status, out, err := run([]string{"-path", filepath.Join(td, "db"), "-config", filepath.Join(confDir, "billing.yml"), "create", "mymigration"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, filepath.Join(confDir, "migrations"))
+}
+
+func TestIntegrationNoConfigFileFlag(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	err = ioutil.WriteFile(filepath.Join(td, "dbconf.yml"), []byte(`
+development:
+    driver: sqlite3
+    open: `+filepath.Join(td, "stray.db")+`
+    migrationsDir: stray-migrations
+`), 0600)
+	require.NoError(t, err)
+
+	defer func(path string, noConfigFile bool) {
+		*flagPath, *flagNoConfigFile = path, noConfigFile
+	}(*flagPath, *flagNoConfigFile)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": filepath.Join(td, "env-migrations"),
+	}
+	status, out, err := run([]string{"-path", filepath.Join(td, "db"), "-no-config-file", "create", "mymigration"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, filepath.Join(td, "env-migrations"))
+}
+
+func TestIntegrationEnvFileFlag(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	envFile := filepath.Join(td, ".env")
+	err = ioutil.WriteFile(envFile, []byte(`# local development
+DB_DRIVER=sqlite3 # the only driver we use
+export DB_DSN='`+filepath.Join(td, "goose.db")+`'
+DB_MIGRATIONS_DIR="`+filepath.Join(td, "env-migrations")+`"
+`), 0600)
+	require.NoError(t, err)
+
+	// run leaves the variables of earlier tests set, if empty, and those
+	// already set aren't loaded from the file
+	for _, name := range []string{"DB_DRIVER", "DB_DSN", "DB_MIGRATIONS_DIR"} {
+		os.Unsetenv(name)
+		defer os.Unsetenv(name)
+	}
+	defer func(path, envFile string, noConfigFile bool) {
+		*flagPath, *flagEnvFile, *flagNoConfigFile = path, envFile, noConfigFile
+	}(*flagPath, *flagEnvFile, *flagNoConfigFile)
+
+	status, out, err := run([]string{"-path", filepath.Join(td, "db"), "-env-file", envFile, "-no-config-file", "create", "mymigration"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, filepath.Join(td, "env-migrations"))
+	assert.Equal(t, "sqlite3", os.Getenv("DB_DRIVER"))
+
+	err = ioutil.WriteFile(envFile, []byte("DB_DRIVER\n"), 0600)
+	require.NoError(t, err)
+	status, out, err = run([]string{"-env-file", envFile, "status"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, status)
+	assert.Contains(t, out, envFile+":1: expected KEY=VALUE")
+}
+
+func TestIntegrationEnvPrecedence(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	err = ioutil.WriteFile(filepath.Join(td, "dbconf.yml"), []byte(`
+development:
+    driver: sqlite3
+    open: `+filepath.Join(td, "dev.db")+`
+    migrationsDir: dev-migrations
+
+staging:
+    driver: sqlite3
+    open: `+filepath.Join(td, "staging.db")+`
+    migrationsDir: staging-migrations
+
+production:
+    driver: sqlite3
+    open: `+filepath.Join(td, "prod.db")+`
+    migrationsDir: prod-migrations
+`), 0600)
+	require.NoError(t, err)
+
+	defer func(path, env string) { *flagPath, *flagEnv = path, env }(*flagPath, *flagEnv)
+
+	tests := []struct {
+		args []string
+		env  string
+		dir  string
+	}{
+		{[]string{"-env", ""}, "", "dev-migrations"},
+		{[]string{"-env", ""}, "staging", "staging-migrations"},
+		{[]string{"-env", "production"}, "staging", "prod-migrations"},
+	}
+	for _, test := range tests {
+		args := append([]string{"-path", td}, test.args...)
+		args = append(args, "create", "mymigration")
+		status, out, err := run(args, map[string]string{"GOOSE_ENV": test.env})
+		require.NoError(t, err)
+		assert.Equal(t, 0, status)
+		assert.Contains(t, out, filepath.Join(td, test.dir), "%v GOOSE_ENV=%s", test.args, test.env)
+	}
+}
+
+func TestIntegrationMigrationsDirFlag(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	confDir := filepath.Join(td, "config")
+	err = os.MkdirAll(confDir, 0700)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(confDir, "dbconf.yml"), []byte(`
+development:
+    driver: sqlite3
+    open: `+filepath.Join(td, "dev.db")+`
+`), 0600)
+	require.NoError(t, err)
+
+	defer func(path, env, dir string) {
+		*flagPath, *flagEnv, *flagMigrationsDir = path, env, dir
+	}(*flagPath, *flagEnv, *flagMigrationsDir)
+
+	migrationsDir := filepath.Join(td, "db", "migrations")
+	status, out, err := run([]string{"-path", confDir, "-env", "development", "-migrations-dir", migrationsDir, "create", "mymigration"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, migrationsDir)
+
+	// relative paths are relative to the working dir
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(wd)
+	require.NoError(t, os.Chdir(td))
+	td, err = os.Getwd() // resolve any symlinks in the temp dir
+	require.NoError(t, err)
+
+	status, out, err = run([]string{"-path", confDir, "-env", "development", "-migrations-dir", "other/migrations", "create", "mymigration"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, filepath.Join(td, "other", "migrations"))
+}
+
+func TestIntegrationExcludeFlag(t *testing.T) {
+	defer func(exclude string) { *flagExclude = exclude }(*flagExclude)
+	defer func() { statusPending = false }()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	err = os.MkdirAll(migrationsDir, 0700)
+	require.NoError(t, err)
+
+	for _, name := range []string{"001_one.sql", "002_two.sql", "003_three.sql"} {
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name),
+			[]byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n"),
+			0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, _, err := run([]string{"-exclude", "2", "up"}, env)
+	require.NoError(t, err)
+	require.Equal(t, 0, status)
+
+	status, out, err := run([]string{"-exclude", "", "status", "-pending"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "001_one.sql")
+	assert.Contains(t, out, "002_two.sql")
+	assert.NotContains(t, out, "003_three.sql")
+}
+
+func TestIntegrationPrintSQLFlag(t *testing.T) {
+	defer func(printSQL bool) { *flagPrintSQL = printSQL }(*flagPrintSQL)
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	err = ioutil.WriteFile(filepath.Join(td, "001_one.sql"),
+		[]byte("-- +goose Up\nCREATE TABLE one(value TEXT);\nINSERT INTO one(value) VALUES('secret');\n\n-- +goose Down\nDROP TABLE one;\n"),
+		0600)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": td,
+	}
+
+	status, out, err := run([]string{"-print-sql", "up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "SQL   1 up: -- +goose Up\nCREATE TABLE one(value TEXT);\nSQL   1 up: INSERT INTO one(value) VALUES('secret');\nOK    001_one.sql")
+
+	status, out, err = run([]string{"-print-sql=false", "down"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.NotContains(t, out, "SQL ")
+}
+
+func TestIntegrationRecursiveFlag(t *testing.T) {
+	defer func(recursive bool) { *flagRecursive = recursive }(*flagRecursive)
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	migrationsDir := filepath.Join(td, "migrations")
+	sql := []byte("-- +goose Up\nSELECT 1;\n\n-- +goose Down\nSELECT 1;\n")
+	for _, name := range []string{"users/001_users.sql", "billing/002_invoices.sql"} {
+		err = os.MkdirAll(filepath.Join(migrationsDir, filepath.Dir(name)), 0700)
+		require.NoError(t, err)
+		err = ioutil.WriteFile(filepath.Join(migrationsDir, name), sql, 0600)
+		require.NoError(t, err)
+	}
+
+	env := map[string]string{
+		"DB_DRIVER":         "sqlite3",
+		"DB_DSN":            filepath.Join(td, "goose.db"),
+		"DB_MIGRATIONS_DIR": migrationsDir,
+	}
+
+	status, out, err := run([]string{"-recursive", "up"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "OK    001_users.sql")
+	assert.Contains(t, out, "OK    002_invoices.sql")
+
+	status, out, err = run([]string{"-recursive", "dbversion"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, 0, status)
+	assert.Contains(t, out, "goose: dbversion 2\n")
+}
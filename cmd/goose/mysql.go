@@ -6,5 +6,5 @@ package main
 import _ "github.com/go-sql-driver/mysql"
 
 func init() {
-	drivers = append(drivers, "mysql")
+	drivers = append(drivers, "mysql", "mariadb")
 }
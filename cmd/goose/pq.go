@@ -6,5 +6,5 @@ package main
 import _ "github.com/lib/pq"
 
 func init() {
-	drivers = append(drivers, "pq")
+	drivers = append(drivers, "postgres", "redshift")
 }
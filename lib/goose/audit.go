@@ -0,0 +1,53 @@
+package goose
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// AuditMigrations compares the applied migrations recorded in the DB with
+// the migrations in conf.MigrationsDir, without running anything, and
+// returns every discrepancy found: applied migrations modified since they
+// were applied, applied versions whose file is missing, and migrations
+// applied out of order. Migrations applied before goose recorded checksums
+// aren't checked for modifications.
+func AuditMigrations(conf *DBConf, db *sql.DB) ([]error, error) {
+	if conf.NoVersioning {
+		return nil, errors.New("can't audit migrations without versioning")
+	}
+
+	migrations, err := MigrationStatus(conf, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []error
+	for _, m := range migrations {
+		if !m.IsApplied {
+			continue
+		}
+
+		if m.Source == "" {
+			name := m.Name
+			if name == "" {
+				name = "unknown"
+			}
+			problems = append(problems, fmt.Errorf("version %d: applied, but its migration file (%s) is missing", m.Version, name))
+		} else if m.Checksum != "" {
+			checksum, err := fileChecksum(m.Source)
+			if err != nil {
+				return nil, err
+			}
+			if checksum != m.Checksum {
+				problems = append(problems, fmt.Errorf("%s: modified since it was applied", m.Source))
+			}
+		}
+
+		if m.OutOfOrder {
+			problems = append(problems, fmt.Errorf("version %d: applied out of order, after a later version", m.Version))
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,81 @@
+package goose
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuditMigrations(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	// apply 20010203040507 after 20010203040508
+	one := filepath.Join(md, "20010203040507_one.sql")
+	err = os.Rename(one, one+".hidden")
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	err = os.Rename(one+".hidden", one)
+	require.NoError(t, err)
+	conf.AllowMissing = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	conf.AllowMissing = false
+	problems, err := AuditMigrations(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, []error{
+		fmt.Errorf("version 20010203040507: applied out of order, after a later version"),
+	}, problems)
+
+	setup := filepath.Join(md, "20010203040506_setup.sql")
+	f, err := os.OpenFile(setup, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("-- edited\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	err = os.Remove(filepath.Join(md, "20010203040508_two.sql"))
+	require.NoError(t, err)
+
+	problems, err = AuditMigrations(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, []error{
+		fmt.Errorf("%s: modified since it was applied", setup),
+		fmt.Errorf("version 20010203040507: applied out of order, after a later version"),
+		fmt.Errorf("version 20010203040508: applied, but its migration file (20010203040508_two.sql) is missing"),
+	}, problems)
+}
+func TestAuditMigrations_sqlite3(t *testing.T) {
+	testAuditMigrations(t, getSqlite3Driver(t))
+}
+func TestAuditMigrations_mysql(t *testing.T) {
+	testAuditMigrations(t, getMysqlDriver(t))
+}
+func TestAuditMigrations_postgres(t *testing.T) {
+	testAuditMigrations(t, getPostgresDriver(t))
+}
+func TestAuditMigrations_redshift(t *testing.T) {
+	testAuditMigrations(t, getRedshiftDriver(t))
+}
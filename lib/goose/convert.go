@@ -0,0 +1,173 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConvertMigrations renumbers the timestamped migrations in
+// conf.MigrationsDir sequentially, as FixMigrations does, and rewrites the
+// versions recorded for them in the version table of db to match, within a
+// single transaction, so that the renamed migrations keep their history.
+//
+// It refuses to convert when the files and the version table don't
+// correspond: when a version recorded as applied has no migration, or an
+// applied migration has been modified since. If the DB can't be updated,
+// the renamed files are restored.
+func ConvertMigrations(conf *DBConf, db *sql.DB) (err error) {
+	ctx := context.Background()
+	if conf.NoVersioning {
+		return errors.New("can't convert migrations without versioning")
+	}
+
+	if !conf.NoLock {
+		unlock, err := lockDB(ctx, conf, db)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	if _, err := ensureDBVersion(ctx, conf, db); err != nil {
+		return err
+	}
+
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	missing, err := getMigrationsStatus(ctx, conf, db, migrations)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		sort.Sort(migrationSorter(missing))
+		var vs []string
+		for _, m := range missing {
+			vs = append(vs, fmt.Sprint(m.Version))
+		}
+		return fmt.Errorf("applied versions not found in %s: %s", conf.MigrationsDir, strings.Join(vs, ", "))
+	}
+	if !conf.SkipVerify {
+		if err := verifyChecksums(migrations); err != nil {
+			return err
+		}
+	}
+
+	rs := sequentialRenumbering(migrations)
+	if len(rs) == 0 {
+		conf.logger().Printf("goose: no timestamped migrations to convert\n")
+		return nil
+	}
+
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %s", err)
+	}
+
+	var undos []func() error
+	undo := func() {
+		for i := len(undos) - 1; i >= 0; i-- {
+			if e := undos[i](); e != nil {
+				conf.logger().Printf("goose: restoring a renamed migration: %s\n", e)
+			}
+		}
+	}
+
+	for _, r := range rs {
+		u, err := r.applyWithUndo()
+		if u != nil {
+			undos = append(undos, u)
+		}
+		if err == nil {
+			err = rewriteRecordedVersion(ctx, conf, txn, r)
+		}
+		if err != nil {
+			txn.Rollback()
+			undo()
+			return err
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		undo()
+		return err
+	}
+
+	for _, r := range rs {
+		conf.logger().Printf("goose: renamed %s to %s\n", filepath.Base(r.m.Source), r.name)
+	}
+	return nil
+}
+
+// applyWithUndo is apply, also returning a func restoring the migration's
+// file as it was, which is non-nil whenever anything was changed.
+func (r renumbering) applyWithUndo() (func() error, error) {
+	src := r.m.Source
+	// only Go migrations are rewritten, split migrations being directories
+	var orig []byte
+	if migrationExt(src) == ".go" {
+		var err error
+		if orig, err = ioutil.ReadFile(src); err != nil {
+			return nil, err
+		}
+	}
+	dst := filepath.Join(filepath.Dir(src), r.name)
+	undo := func() error {
+		if _, err := os.Stat(dst); err == nil {
+			if err := os.Rename(dst, src); err != nil {
+				return err
+			}
+		}
+		if orig == nil {
+			return nil
+		}
+		return ioutil.WriteFile(src, orig, 0644)
+	}
+
+	if _, err := r.apply(); err != nil {
+		return undo, err
+	}
+	return undo, nil
+}
+
+// rewriteRecordedVersion rewrites the records of the renumbered migration's
+// version within txn, as if it had been applied with its new version and
+// name. Its checksum is updated as well if renaming changed its contents.
+func rewriteRecordedVersion(ctx context.Context, conf *DBConf, txn *sql.Tx, r renumbering) error {
+	table := quoteTable(conf.Driver.Dialect, conf.versionTable())
+
+	var n int
+	row := txn.QueryRowContext(ctx, conf.rebind("SELECT COUNT(*) FROM "+table+" WHERE version_id = ?"), r.version)
+	if err := row.Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("can't convert %s to version %d, which is already recorded in the version table", filepath.Base(r.m.Source), r.version)
+	}
+
+	checksum, err := fileChecksum(filepath.Join(filepath.Dir(r.m.Source), r.name))
+	if err != nil {
+		return err
+	}
+	if r.m.Checksum != "" && checksum != r.m.Checksum {
+		_, err := txn.ExecContext(ctx, conf.rebind("UPDATE "+table+" SET checksum = ? WHERE version_id = ? AND checksum = ?"), checksum, r.m.Version, r.m.Checksum)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = txn.ExecContext(ctx, conf.rebind("UPDATE "+table+" SET version_id = ?, name = ? WHERE version_id = ?"), r.version, r.name, r.m.Version)
+	return err
+}
@@ -0,0 +1,142 @@
+package goose
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertMigrations(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"00001_setup.sql":          [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040506_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040507_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+		"20010203040508_three.sql": [2]string{"INSERT INTO test(value) VALUES('three');", "DELETE FROM test WHERE value = 'three';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	err = ConvertMigrations(conf, db)
+	require.NoError(t, err)
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	var names []string
+	for _, m := range migs {
+		names = append(names, filepath.Base(m.Source))
+	}
+	assert.Equal(t, []string{"00001_setup.sql", "00002_one.sql", "00003_two.sql", "00004_three.sql"}, names)
+
+	// the renamed migrations are still applied, and pass verification
+	missing, err := getMigrationsStatus(context.Background(), conf, db, migs)
+	require.NoError(t, err)
+	assert.Empty(t, missing)
+	for _, m := range migs {
+		assert.Equal(t, m.Version <= 3, m.IsApplied, m.Source)
+	}
+	assert.Equal(t, "00003_two.sql", migs[2].Name)
+	require.NoError(t, verifyChecksums(migs))
+
+	version, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 4, db)
+	require.NoError(t, err)
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+	assert.Equal(t, 3, n)
+
+	// nothing left to convert
+	err = ConvertMigrations(conf, db)
+	require.NoError(t, err)
+}
+
+func TestConvertMigrations_mismatch(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_data.sql":  [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	// an applied migration without a file
+	data := filepath.Join(md, "20010203040507_data.sql")
+	bs, err := ioutil.ReadFile(data)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(data))
+
+	err = ConvertMigrations(conf, db)
+	assert.EqualError(t, err, "applied versions not found in "+md+": 20010203040507")
+	assert.FileExists(t, filepath.Join(md, "20010203040506_setup.sql"))
+
+	// a modified applied migration
+	require.NoError(t, ioutil.WriteFile(data, append(bs, '\n'), 0644))
+	err = ConvertMigrations(conf, db)
+	assert.EqualError(t, err, "migration 20010203040507 has been modified since it was applied (20010203040507_data.sql)")
+	assert.FileExists(t, filepath.Join(md, "20010203040506_setup.sql"))
+}
+
+func TestConvertMigrations_restoresFiles(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_data.sql":  [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	// a record left behind for the version the second migration would get
+	_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (2, 0)")
+	require.NoError(t, err)
+
+	err = ConvertMigrations(conf, db)
+	assert.EqualError(t, err, "can't convert 20010203040507_data.sql to version 2, which is already recorded in the version table")
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 2)
+	assert.Equal(t, filepath.Join(md, "20010203040506_setup.sql"), migs[0].Source)
+	assert.Equal(t, filepath.Join(md, "20010203040507_data.sql"), migs[1].Source)
+
+	version, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), version)
+}
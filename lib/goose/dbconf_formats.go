@@ -0,0 +1,270 @@
+package goose
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/kylelemons/go-gypsy/yaml"
+)
+
+// readDBConfFile parses a dbconf.yaml, dbconf.toml or dbconf.json file into
+// the yaml nodes confGet reads from.
+func readDBConfFile(path string) (*yaml.File, error) {
+	var parse func(io.Reader) (yaml.Node, error)
+	switch filepath.Ext(path) {
+	case ".toml":
+		parse = parseTOMLConf
+	case ".json":
+		parse = parseJSONConf
+	default:
+		return yaml.ReadFile(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	root, err := parse(f)
+	if err != nil {
+		return nil, err
+	}
+	return &yaml.File{Root: root}, nil
+}
+
+// parseJSONConf parses a JSON config, whose objects become maps and whose
+// other values become scalars.
+func parseJSONConf(r io.Reader) (yaml.Node, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	return jsonNode(v), nil
+}
+
+func jsonNode(v interface{}) yaml.Node {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := yaml.Map{}
+		for k, e := range v {
+			if e != nil {
+				m[k] = jsonNode(e)
+			}
+		}
+		return m
+	case []interface{}:
+		l := yaml.List{}
+		for _, e := range v {
+			l = append(l, jsonNode(e))
+		}
+		return l
+	case string:
+		return yaml.Scalar(v)
+	default:
+		// numbers and bools
+		return yaml.Scalar(fmt.Sprint(v))
+	}
+}
+
+// parseTOMLConf parses the subset of TOML used by goose configs: tables
+// holding string, integer, float and boolean keys. Arrays, inline tables
+// and multi-line strings aren't supported.
+func parseTOMLConf(r io.Reader) (yaml.Node, error) {
+	root := yaml.Map{}
+	table := root
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: arrays of tables are not supported", n)
+			}
+			end := strings.Index(line, "]")
+			if end == -1 || !isTOMLComment(line[end+1:]) {
+				return nil, fmt.Errorf("line %d: invalid table header", n)
+			}
+			keys, err := parseTOMLKey(line[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			if table, err = tomlTable(root, keys); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			continue
+		}
+
+		eq := strings.Index(line, "=")
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		keys, err := parseTOMLKey(line[:eq])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		value, err := parseTOMLValue(strings.TrimSpace(line[eq+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+
+		parent, err := tomlTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		key := keys[len(keys)-1]
+		if _, ok := parent[key]; ok {
+			return nil, fmt.Errorf("line %d: duplicate key %q", n, key)
+		}
+		parent[key] = yaml.Scalar(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// tomlTable returns the table at the given keys below t, creating any
+// missing tables.
+func tomlTable(t yaml.Map, keys []string) (yaml.Map, error) {
+	for _, key := range keys {
+		switch child := t[key].(type) {
+		case nil:
+			m := yaml.Map{}
+			t[key] = m
+			t = m
+		case yaml.Map:
+			t = child
+		default:
+			return nil, fmt.Errorf("%q is not a table", key)
+		}
+	}
+	return t, nil
+}
+
+// parseTOMLKey splits a, possibly dotted, bare or quoted key.
+func parseTOMLKey(s string) ([]string, error) {
+	var keys []string
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return nil, fmt.Errorf("missing key")
+		}
+
+		var key string
+		switch s[0] {
+		case '"', '\'':
+			end := strings.IndexByte(s[1:], s[0])
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated key")
+			}
+			var err error
+			if key, err = parseTOMLValue(s[:end+2]); err != nil {
+				return nil, err
+			}
+			s = s[end+2:]
+		default:
+			end := strings.IndexFunc(s, func(r rune) bool {
+				return !(r == '_' || r == '-' ||
+					'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+			})
+			if end == -1 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("invalid key %q", s)
+			}
+			key, s = s[:end], s[end:]
+		}
+		keys = append(keys, key)
+
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return keys, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key %q", s)
+		}
+		s = s[1:]
+	}
+}
+
+// parseTOMLValue parses a single line value, followed by an optional comment.
+func parseTOMLValue(s string) (string, error) {
+	if strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''") {
+		return "", fmt.Errorf("multi-line strings are not supported")
+	}
+
+	switch {
+	case s == "":
+		return "", fmt.Errorf("missing value")
+
+	case s[0] == '"':
+		// find the closing quote, skipping escaped ones
+		end := -1
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				end = i
+				break
+			}
+		}
+		if end == -1 || !isTOMLComment(s[end+1:]) {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		v, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s[:end+1])
+		}
+		return v, nil
+
+	case s[0] == '\'':
+		// literal strings have no escapes
+		end := strings.IndexByte(s[1:], '\'')
+		if end == -1 || !isTOMLComment(s[end+2:]) {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return s[1 : end+1], nil
+
+	case s[0] == '[' || s[0] == '{':
+		return "", fmt.Errorf("arrays and inline tables are not supported")
+	}
+
+	// booleans and numbers are kept as written
+	v := s
+	if i := strings.IndexByte(s, '#'); i != -1 {
+		v = s[:i]
+	}
+	v = strings.TrimSpace(v)
+	if v == "true" || v == "false" {
+		return v, nil
+	}
+	if _, err := strconv.ParseFloat(strings.Replace(v, "_", "", -1), 64); err != nil {
+		return "", fmt.Errorf("invalid value %s", v)
+	}
+	return v, nil
+}
+
+// isTOMLComment reports whether s is empty or only a comment.
+func isTOMLComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
@@ -0,0 +1,81 @@
+package goose
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kylelemons/go-gypsy/yaml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTOMLConf(t *testing.T) {
+	root, err := parseTOMLConf(strings.NewReader(`
+driver = "postgres"
+
+[development]
+open = "user=goose dbname=\"goose dev\"" # inline comment
+literal = 'C:\goose'
+nolock = true
+port = 5432
+
+[production.replica]
+"quoted key" = "x"
+`))
+	require.NoError(t, err)
+
+	f := &yaml.File{Root: root}
+	for spec, want := range map[string]string{
+		"driver":                        "postgres",
+		"development.open":              `user=goose dbname="goose dev"`,
+		"development.literal":           `C:\goose`,
+		"development.nolock":            "true",
+		"development.port":              "5432",
+		"production.replica.quoted key": "x",
+	} {
+		got, err := f.Get(spec)
+		if assert.NoError(t, err, spec) {
+			assert.Equal(t, want, got, spec)
+		}
+	}
+}
+
+func TestParseTOMLConf_invalid(t *testing.T) {
+	for _, conf := range []string{
+		"driver",
+		"driver = postgres",
+		"driver = \"postgres",
+		"driver = \"a\"\ndriver = \"b\"",
+		"[development\nopen = \"x\"",
+		"[[envs]]",
+		"dirs = [\"a\", \"b\"]",
+		"open = \"\"\"\nx\n\"\"\"",
+		"driver = \"a\"\n[driver]",
+	} {
+		_, err := parseTOMLConf(strings.NewReader(conf))
+		assert.Error(t, err, conf)
+	}
+}
+
+func TestParseJSONConf(t *testing.T) {
+	root, err := parseJSONConf(strings.NewReader(`{
+	"driver": "postgres",
+	"development": {"open": "user=goose", "port": 5432, "nolock": true, "schema": null}
+}`))
+	require.NoError(t, err)
+
+	f := &yaml.File{Root: root}
+	got, err := f.Get("development.port")
+	require.NoError(t, err)
+	assert.Equal(t, "5432", got)
+
+	got, err = f.Get("development.nolock")
+	require.NoError(t, err)
+	assert.Equal(t, "true", got)
+
+	_, err = f.Get("development.schema")
+	assert.Error(t, err)
+
+	_, err = parseJSONConf(strings.NewReader(`["postgres"]`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,13 @@
+// +build go1.15
+
+package goose
+
+import (
+	"database/sql"
+	"time"
+)
+
+// setConnMaxIdleTime closes connections idle in db's pool for longer than d.
+func setConnMaxIdleTime(db *sql.DB, d time.Duration) {
+	db.SetConnMaxIdleTime(d)
+}
@@ -0,0 +1,15 @@
+// +build !go1.15
+
+package goose
+
+import (
+	"database/sql"
+	"time"
+)
+
+// setConnMaxIdleTime closes connections in db's pool after d. Before Go
+// 1.15, sql.DB can't tell how long a connection has been idle, so they're
+// closed once they're that old instead.
+func setConnMaxIdleTime(db *sql.DB, d time.Duration) {
+	db.SetConnMaxLifetime(d)
+}
@@ -0,0 +1,45 @@
+package goose
+
+// Option overrides a setting of the DBConf built by NewDBConfWithOptions.
+type Option func(*DBConf)
+
+// WithMigrationsDir sets DBConf.MigrationsDir, rather than it being taken
+// from the config, or being the migrations folder of the config's folder.
+func WithMigrationsDir(dir string) Option {
+	return func(c *DBConf) {
+		c.MigrationsDir = dir
+	}
+}
+
+// WithVersionTable sets DBConf.VersionTable, the table versions are
+// recorded in.
+func WithVersionTable(table string) Option {
+	return func(c *DBConf) {
+		c.VersionTable = table
+	}
+}
+
+// WithDriver sets the driver, as the driver setting of the config does,
+// with the import path and dialect goose knows for it. The open string is
+// kept.
+func WithDriver(name string) Option {
+	return func(c *DBConf) {
+		c.Driver = newDBDriver(name, c.Driver.OpenStr)
+	}
+}
+
+// WithDialect sets the dialect of the driver, e.g. for a driver goose
+// doesn't know.
+func WithDialect(dialect SqlDialect) Option {
+	return func(c *DBConf) {
+		c.Driver.Dialect = dialect
+	}
+}
+
+// WithOpenString sets the open string the driver is given to connect to the
+// DB.
+func WithOpenString(open string) Option {
+	return func(c *DBConf) {
+		c.Driver.OpenStr = open
+	}
+}
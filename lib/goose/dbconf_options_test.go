@@ -0,0 +1,113 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDBConfWithOptions(t *testing.T) {
+	confPath, _, clean := setupDBConf(t, "dbconf.yml", "migrations")
+	defer clean()
+	err := ioutil.WriteFile(confPath,
+		[]byte(`
+development:
+    driver: postgres
+    open: user=dev
+    schema: tenant
+`),
+		0700)
+	require.NoError(t, err)
+	dbDir := filepath.Dir(confPath)
+
+	dbconf, err := NewDBConfWithOptions(dbDir, "development")
+	require.NoError(t, err)
+	plain, err := NewDBConf(dbDir, "development")
+	require.NoError(t, err)
+	assert.Equal(t, plain, dbconf)
+	assert.Equal(t, "tenant.goose_db_version", dbconf.versionTable())
+
+	dbconf, err = NewDBConfWithOptions(dbDir, "development", WithMigrationsDir("/srv/migrations"))
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/migrations", dbconf.MigrationsDir)
+
+	dbconf, err = NewDBConfWithOptions(dbDir, "development", WithVersionTable("schema_versions"))
+	require.NoError(t, err)
+	assert.Equal(t, "schema_versions", dbconf.VersionTable)
+	assert.Equal(t, "tenant.schema_versions", dbconf.versionTable())
+
+	dbconf, err = NewDBConfWithOptions(dbDir, "development", WithDialect(&RedshiftDialect{}))
+	require.NoError(t, err)
+	assert.Equal(t, "postgres", dbconf.Driver.Name)
+	assert.Equal(t, &RedshiftDialect{}, dbconf.Driver.Dialect)
+
+	dbconf, err = NewDBConfWithOptions(dbDir, "development", WithOpenString("user=app"))
+	require.NoError(t, err)
+	assert.Equal(t, "user=app", dbconf.Driver.OpenStr)
+
+	// the options apply in order
+	dbconf, err = NewDBConfWithOptions(dbDir, "development", WithOpenString("file.db"), WithDriver("sqlite3"))
+	require.NoError(t, err)
+	assert.Equal(t, "sqlite3", dbconf.Driver.Name)
+	assert.Equal(t, &Sqlite3Dialect{}, dbconf.Driver.Dialect)
+	assert.Equal(t, "file.db", dbconf.Driver.OpenStr)
+}
+
+func TestNewDBConfWithOptions_noConfig(t *testing.T) {
+	for _, name := range []string{"DB_MIGRATIONS_DIR", "DB_DRIVER", "DB_DRIVER_IMPORT", "DB_DIALECT", "DB_DSN", "DATABASE_URL"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	defer os.Setenv("GOOSE_NO_CONFIG", os.Getenv("GOOSE_NO_CONFIG"))
+	os.Setenv("GOOSE_NO_CONFIG", "true")
+
+	// without a driver or dialect, there's nothing to go on
+	_, err := NewDBConfWithOptions("", "")
+	assert.Error(t, err)
+
+	dbconf, err := NewDBConfWithOptions("", "",
+		WithMigrationsDir("/srv/migrations"),
+		WithDialect(&PostgresDialect{}),
+		WithOpenString("user=app"),
+		WithVersionTable("schema_versions"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/migrations", dbconf.MigrationsDir)
+	assert.Equal(t, &PostgresDialect{}, dbconf.Driver.Dialect)
+	assert.Equal(t, "user=app", dbconf.Driver.OpenStr)
+	assert.Equal(t, "schema_versions", dbconf.versionTable())
+
+	dbconf, err = NewDBConfWithOptions("", "", WithDriver("postgres"), WithOpenString("user=app"))
+	require.NoError(t, err)
+	assert.Equal(t, "github.com/lib/pq", dbconf.Driver.Import)
+	assert.Equal(t, &PostgresDialect{}, dbconf.Driver.Dialect)
+}
+
+func TestNewDBConfWithOptions_noDriver(t *testing.T) {
+	confPath, _, clean := setupDBConf(t, "dbconf.yml", "migrations")
+	defer clean()
+	err := ioutil.WriteFile(confPath,
+		[]byte(`
+development:
+    migrationsDir: migrations
+`),
+		0700)
+	require.NoError(t, err)
+	dbDir := filepath.Dir(confPath)
+
+	// the config file needn't set the driver, if opts do
+	_, err = NewDBConfWithOptions(dbDir, "development")
+	assert.EqualError(t, err, "invalid DBConf: no driver, set one with driver")
+
+	dbconf, err := NewDBConfWithOptions(dbDir, "development", WithDriver("sqlite3"), WithOpenString(":memory:"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dbDir, "migrations"), dbconf.MigrationsDir)
+	assert.Equal(t, "sqlite3", dbconf.Driver.Name)
+	assert.Equal(t, &Sqlite3Dialect{}, dbconf.Driver.Dialect)
+	assert.Equal(t, ":memory:", dbconf.Driver.OpenStr)
+	assert.NoError(t, dbconf.Validate())
+}
@@ -1,20 +1,387 @@
 package goose
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
 )
 
+// lockPollInterval is how often an advisory lock is retried while waiting
+// for it with a timeout.
+const lockPollInterval = 100 * time.Millisecond
+
+// gooseLockID is the key goose uses for database advisory locks.
+// It's simply "goose" in ASCII.
+const gooseLockID = 0x676f6f7365
+
 // SqlDialect abstracts the details of specific SQL dialects
 // for goose's few SQL specific statements
 type SqlDialect interface {
-	createVersionTableSql() string // sql string to create the goose_db_version table
-	insertVersionSql() string      // sql string to insert the initial version table row
-	dbVersionQuery(db *sql.DB) (*sql.Rows, error)
+	createVersionTableSql(table string) string // sql string to create the goose_db_version table
+	insertVersionSql(table string) string      // sql string to insert the initial version table row
+	nowSql() string                            // sql expression for the time a version is recorded at
+	addChecksumColumnSql(table string) string  // sql string to add the checksum column to an existing goose_db_version table
+	addNameColumnSql(table string) string      // sql string to add the name column to an existing goose_db_version table
+	addDirectionColumnSql(table string) string // sql string to add the direction column to an existing goose_db_version table
+	addActorColumnSql(table string) string     // sql string to add the actor column to an existing goose_db_version table
+	addActorHostColumnSql(table string) string // sql string to add the actor_host column to an existing goose_db_version table
+	dbVersionQuery(ctx context.Context, db *sql.DB, table string) (*sql.Rows, error)
+	// currentVersionSql selects the current version, being the most
+	// recently recorded version whose latest row is applied, or is "" if
+	// the dialect relies on scanning dbVersionQuery instead.
+	currentVersionSql(table string) string
+	// tableExists reports whether the given, possibly schema qualified,
+	// table exists.
+	tableExists(ctx context.Context, db *sql.DB, table string) (bool, error)
+	// QuoteIdentifier quotes a table, schema or index name for SQL, so that
+	// it may be a reserved word or contain any character. The version table
+	// is passed to the other methods unquoted, and quoted with it.
+	QuoteIdentifier(name string) string
+
+	// upsertVersionSql is like insertVersionSql, but replaces any existing
+	// row for the version. It relies on the index added by addVersionIndex.
+	upsertVersionSql(table string) string
+	// addVersionIndex adds a unique index on version_id, if it isn't
+	// already there.
+	addVersionIndex(ctx context.Context, db *sql.DB, table string) error
+
+	// lockSession blocks until it holds a lock preventing other goose
+	// processes from migrating the same database, or ctx is done. It returns
+	// the connection holding the lock, or nil if the dialect has no locking
+	// mechanism. If ctx has a deadline, giving up at it mustn't rely on the
+	// driver cancelling a blocked query.
+	lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error)
+	// unlockSession releases a lock acquired by lockSession.
+	unlockSession(conn *sql.Conn) error
+
+	// isRetryable reports whether err, from running a migration's
+	// transaction, is transient, such as a serialization failure, so that
+	// the transaction may succeed if it's run again.
+	isRetryable(err error) bool
+
+	// appliedValue is the value bound to is_applied when recording a
+	// version, for dialects whose column isn't a boolean the driver maps Go
+	// bools to.
+	appliedValue(applied bool) interface{}
+
+	// placeholder is the style of the bind parameters the dialect's driver
+	// expects. insertVersionSql and upsertVersionSql bind version_id,
+	// is_applied, name, checksum, direction, actor and actor_host to ?
+	// placeholders, which are rebound to this style, so a dialect can be
+	// used with a driver expecting another.
+	placeholder() PlaceholderStyle
+
+	// capabilities reports what the dialect's database supports.
+	capabilities() DialectCapabilities
+}
+
+// DialectCapabilities describes what a dialect's database supports, so that
+// tooling can pick options which are safe with it. See DBConf.Capabilities.
+type DialectCapabilities struct {
+	// TransactionalDDL is set if DDL statements are rolled back with the
+	// transaction they ran in, rather than implicitly committing it, as
+	// DBConf.SingleTransaction relies on.
+	TransactionalDDL bool
+	// AdvisoryLock is set if migrating takes a database lock, unless
+	// DBConf.NoLock is set, so that concurrent goose processes don't race.
+	AdvisoryLock bool
+	// CreateTableIfNotExists is set if CREATE TABLE IF NOT EXISTS is
+	// supported.
+	CreateTableIfNotExists bool
+}
+
+// PlaceholderStyle is the style of a driver's bind parameters.
+type PlaceholderStyle int
+
+const (
+	// PlaceholderQuestion is ?, as used by mysql and sqlite3 drivers.
+	PlaceholderQuestion PlaceholderStyle = iota
+	// PlaceholderDollar is $1, $2, ..., as used by postgres drivers.
+	PlaceholderDollar
+	// PlaceholderColon is :1, :2, ..., as used by oracle drivers.
+	PlaceholderColon
+)
+
+// Rebind replaces the ? placeholders in query with those of the given
+// style, leaving any within quotes alone, like sqlx's Rebind.
+func Rebind(style PlaceholderStyle, query string) string {
+	var prefix byte
+	switch style {
+	case PlaceholderDollar:
+		prefix = '$'
+	case PlaceholderColon:
+		prefix = ':'
+	default:
+		return query
+	}
+
+	var b bytes.Buffer
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte(prefix)
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// PlaceholderDialect is a Dialect used with a driver expecting bind parameters
+// of the given Style, rather than the dialect's own, e.g. the postgres
+// dialect with a driver expecting ?. Register it as any other dialect.
+type PlaceholderDialect struct {
+	Dialect SqlDialect
+	Style   PlaceholderStyle
+}
+
+func (d PlaceholderDialect) createVersionTableSql(table string) string {
+	return d.Dialect.createVersionTableSql(table)
+}
+
+func (d PlaceholderDialect) insertVersionSql(table string) string {
+	return d.Dialect.insertVersionSql(table)
+}
+
+func (d PlaceholderDialect) nowSql() string {
+	return d.Dialect.nowSql()
+}
+
+func (d PlaceholderDialect) addChecksumColumnSql(table string) string {
+	return d.Dialect.addChecksumColumnSql(table)
+}
+
+func (d PlaceholderDialect) addNameColumnSql(table string) string {
+	return d.Dialect.addNameColumnSql(table)
+}
+
+func (d PlaceholderDialect) addDirectionColumnSql(table string) string {
+	return d.Dialect.addDirectionColumnSql(table)
+}
+
+func (d PlaceholderDialect) addActorColumnSql(table string) string {
+	return d.Dialect.addActorColumnSql(table)
+}
+
+func (d PlaceholderDialect) addActorHostColumnSql(table string) string {
+	return d.Dialect.addActorHostColumnSql(table)
+}
+
+func (d PlaceholderDialect) dbVersionQuery(ctx context.Context, db *sql.DB, table string) (*sql.Rows, error) {
+	return d.Dialect.dbVersionQuery(ctx, db, table)
+}
+
+func (d PlaceholderDialect) currentVersionSql(table string) string {
+	return d.Dialect.currentVersionSql(table)
+}
+
+func (d PlaceholderDialect) tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	return d.Dialect.tableExists(ctx, db, table)
+}
+
+func (d PlaceholderDialect) QuoteIdentifier(name string) string {
+	return d.Dialect.QuoteIdentifier(name)
+}
+
+func (d PlaceholderDialect) upsertVersionSql(table string) string {
+	return d.Dialect.upsertVersionSql(table)
+}
+
+func (d PlaceholderDialect) addVersionIndex(ctx context.Context, db *sql.DB, table string) error {
+	return d.Dialect.addVersionIndex(ctx, db, table)
+}
+
+func (d PlaceholderDialect) lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	return d.Dialect.lockSession(ctx, db)
+}
+
+func (d PlaceholderDialect) unlockSession(conn *sql.Conn) error {
+	return d.Dialect.unlockSession(conn)
+}
+
+func (d PlaceholderDialect) isRetryable(err error) bool {
+	return d.Dialect.isRetryable(err)
+}
+
+func (d PlaceholderDialect) appliedValue(applied bool) interface{} {
+	return d.Dialect.appliedValue(applied)
+}
+
+func (d PlaceholderDialect) placeholder() PlaceholderStyle {
+	return d.Style
+}
+
+func (d PlaceholderDialect) capabilities() DialectCapabilities {
+	return d.Dialect.capabilities()
+}
+
+func (d PlaceholderDialect) rewriteStatement(stmt string) string {
+	if r, ok := d.Dialect.(statementRewriter); ok {
+		return r.rewriteStatement(stmt)
+	}
+	return stmt
+}
+
+func (d PlaceholderDialect) splitStatement(stmt string) []string {
+	if s, ok := d.Dialect.(statementSplitter); ok {
+		return s.splitStatement(stmt)
+	}
+	return []string{stmt}
+}
+
+func (d PlaceholderDialect) dumpSchema(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	if s, ok := d.Dialect.(schemaDumper); ok {
+		return s.dumpSchema(ctx, db, table)
+	}
+	return nil, errSchemaDumpUnsupported
+}
+
+// statementRewriter is implemented by dialects whose driver can't execute the
+// statements of SQL migrations as written.
+type statementRewriter interface {
+	rewriteStatement(stmt string) string
+}
+
+// statementSplitter is implemented by dialects whose driver executes a
+// single statement at a time, so several statements parsed as one, e.g.
+// on the same line, are split before they're executed.
+type statementSplitter interface {
+	splitStatement(stmt string) []string
+}
+
+// schemaDumper is implemented by dialects which can dump the schema of a
+// database, leaving out the version table, for DumpSchema.
+type schemaDumper interface {
+	dumpSchema(ctx context.Context, db *sql.DB, table string) ([]string, error)
+}
+
+// errSchemaDumpUnsupported is returned by DumpSchema for dialects which
+// can't dump a schema.
+var errSchemaDumpUnsupported = errors.New("dumping the schema is only supported with the postgres and sqlite3 dialects")
+
+// queryStrings returns the single string column of the rows selected by
+// query.
+func queryStrings(ctx context.Context, db *sql.DB, query string, args ...interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var strs []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+	return strs, rows.Err()
+}
+
+// unqualifiedTable strips any schema from the table name.
+func unqualifiedTable(table string) string {
+	_, name := splitTable(table)
+	return name
+}
+
+// splitTable splits a possibly schema qualified table name into the schema,
+// which may be empty, and the table.
+func splitTable(table string) (schema, name string) {
+	i := strings.LastIndex(table, ".")
+	if i < 0 {
+		return "", table
+	}
+	return table[:i], table[i+1:]
+}
+
+// quoteTable quotes each part of a possibly schema qualified table name.
+func quoteTable(d SqlDialect, table string) string {
+	schema, name := splitTable(table)
+	if schema == "" {
+		return d.QuoteIdentifier(name)
+	}
+	return d.QuoteIdentifier(schema) + "." + d.QuoteIdentifier(name)
+}
+
+// quoteDouble quotes an identifier in double quotes, as standard SQL does.
+func quoteDouble(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// versionIndexName returns the name of the unique version_id index on
+// the given version table.
+func versionIndexName(table string) string {
+	return table + "_version_id_key"
+}
+
+// registeredDialect is a driver added with RegisterDialect.
+type registeredDialect struct {
+	importPath string
+	dialect    SqlDialect
+}
+
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[string]registeredDialect{}
+)
+
+// RegisterDialect makes the named driver and dialect known to NewDBConf,
+// which uses it for configs naming it as the driver or dialect, in preference
+// to the built-in ones. importPath is the driver's package, imported by Go
+// migrations.
+//
+// As the methods of SqlDialect are unexported, dialects are implemented by
+// embedding one of the built-in dialects.
+//
+// The dialect is registered with encoding/gob, as the DBConf is passed to Go
+// migrations gob encoded. For Go migrations to decode it, the dialect must
+// also be registered with gob.Register from an init func in the package at
+// importPath, since that's imported by the program running the migration.
+func RegisterDialect(name, importPath string, dialect SqlDialect) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+
+	gob.Register(dialect)
+	dialects[name] = registeredDialect{importPath, dialect}
+}
+
+func lookupDialect(name string) (registeredDialect, bool) {
+	dialectsMu.RLock()
+	defer dialectsMu.RUnlock()
+
+	r, ok := dialects[name]
+	return r, ok
 }
 
 // drivers that we don't know about can ask for a dialect by name
 func dialectByName(d string) SqlDialect {
+	if r, ok := lookupDialect(d); ok {
+		return r.dialect
+	}
+
 	switch d {
 	case "postgres":
 		return &PostgresDialect{}
@@ -22,8 +389,12 @@ func dialectByName(d string) SqlDialect {
 		return &RedshiftDialect{}
 	case "mysql":
 		return &MySqlDialect{}
+	case "mariadb":
+		return &MariaDBDialect{}
 	case "sqlite3":
 		return &Sqlite3Dialect{}
+	case "oracle":
+		return &OracleDialect{}
 	}
 
 	return nil
@@ -35,31 +406,269 @@ func dialectByName(d string) SqlDialect {
 
 type PostgresDialect struct{}
 
-func (pg PostgresDialect) createVersionTableSql() string {
-	return `CREATE TABLE goose_db_version (
+func (pg PostgresDialect) createVersionTableSql(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + quoteTable(pg, table) + ` (
             	id serial NOT NULL,
                 version_id bigint NOT NULL,
                 is_applied boolean NOT NULL,
                 tstamp timestamp NULL default now(),
+                name varchar(255) NULL,
+                checksum varchar(64) NULL,
+                direction varchar(4) NULL,
+                actor varchar(255) NULL,
+                actor_host varchar(255) NULL,
                 PRIMARY KEY(id)
             );`
 }
 
-func (pg PostgresDialect) insertVersionSql() string {
-	return "INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, $2);"
+func (pg PostgresDialect) insertVersionSql(table string) string {
+	return "INSERT INTO " + quoteTable(pg, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + pg.nowSql() + ");"
+}
+
+// now() is the time the transaction started, which would be the same for
+// every migration run in a single transaction.
+func (pg PostgresDialect) nowSql() string {
+	return "clock_timestamp()"
+}
+
+func (pg PostgresDialect) addChecksumColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN checksum varchar(64) NULL;"
+}
+
+func (pg PostgresDialect) addNameColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN name varchar(255) NULL;"
+}
+
+func (pg PostgresDialect) addDirectionColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN direction varchar(4) NULL;"
+}
+
+func (pg PostgresDialect) addActorColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN actor varchar(255) NULL;"
+}
+
+func (pg PostgresDialect) addActorHostColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN actor_host varchar(255) NULL;"
+}
+
+func (pg PostgresDialect) upsertVersionSql(table string) string {
+	return "INSERT INTO " + quoteTable(pg, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + pg.nowSql() + ")" +
+		" ON CONFLICT (version_id) DO UPDATE SET is_applied = EXCLUDED.is_applied, tstamp = EXCLUDED.tstamp, name = EXCLUDED.name, checksum = EXCLUDED.checksum, direction = EXCLUDED.direction, actor = EXCLUDED.actor, actor_host = EXCLUDED.actor_host;"
+}
+
+func (pg PostgresDialect) addVersionIndex(ctx context.Context, db *sql.DB, table string) error {
+	// the index is created in the table's schema, so its name can't be qualified
+	_, err := db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS "+pg.QuoteIdentifier(versionIndexName(unqualifiedTable(table)))+" ON "+quoteTable(pg, table)+" (version_id);")
+	return err
+}
+
+func (pg PostgresDialect) dbVersionQuery(ctx context.Context, db *sql.DB, table string) (*sql.Rows, error) {
+	return db.QueryContext(ctx, "SELECT version_id, is_applied, tstamp, name, checksum, actor, actor_host from "+quoteTable(pg, table)+" ORDER BY id DESC")
+}
+
+func (pg PostgresDialect) currentVersionSql(table string) string {
+	return idCurrentVersionSql(quoteTable(pg, table))
+}
+
+func (pg PostgresDialect) tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	return pgTableExists(ctx, db, table)
+}
+
+func (pg PostgresDialect) QuoteIdentifier(name string) string {
+	return quoteDouble(name)
+}
+
+// idCurrentVersionSql finds the current version in a table whose rows are
+// ordered by an id column.
+func idCurrentVersionSql(table string) string {
+	return "SELECT v.version_id FROM " + table + " v WHERE v.is_applied" +
+		" AND NOT EXISTS (SELECT 1 FROM " + table + " l WHERE l.version_id = v.version_id AND l.id > v.id)" +
+		" ORDER BY v.version_id DESC LIMIT 1"
+}
+
+// pgTableExists looks for the table in pg_catalog, within the schemas on the
+// search path if it isn't qualified.
+func pgTableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	var exists bool
+	var err error
+	if schema, name := splitTable(table); schema != "" {
+		err = db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_tables WHERE schemaname = $1 AND tablename = $2)", schema, name).Scan(&exists)
+	} else {
+		err = db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_tables WHERE schemaname = ANY(current_schemas(false)) AND tablename = $1)", name).Scan(&exists)
+	}
+	return exists, err
+}
+
+func (pg PostgresDialect) lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", gooseLockID); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	// poll until the deadline, rather than blocking in pg_advisory_lock
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", gooseLockID).Scan(&locked); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if locked {
+			return conn, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
 }
 
-func (pg PostgresDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query("SELECT version_id, is_applied, tstamp from goose_db_version ORDER BY id DESC")
+func (pg PostgresDialect) unlockSession(conn *sql.Conn) error {
+	defer conn.Close()
 
-	// XXX: check for postgres specific error indicating the table doesn't exist.
-	// for now, assume any error is because the table doesn't exist,
-	// in which case we'll try to create it.
+	_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", gooseLockID)
+	return err
+}
+
+// serialization_failure and deadlock_detected
+func (pg PostgresDialect) isRetryable(err error) bool {
+	switch sqlState(err) {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
+
+func (pg PostgresDialect) appliedValue(applied bool) interface{} {
+	return applied
+}
+
+func (pg PostgresDialect) placeholder() PlaceholderStyle {
+	return PlaceholderDollar
+}
+
+func (pg PostgresDialect) capabilities() DialectCapabilities {
+	return DialectCapabilities{TransactionalDDL: true, AdvisoryLock: true, CreateTableIfNotExists: true}
+}
+
+// dumpSchema introspects the sequences, tables, with their constraints,
+// indexes and views of the version table's schema. Other objects, such as
+// functions, triggers and types, aren't dumped.
+func (pg PostgresDialect) dumpSchema(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	schema, name := splitTable(table)
+	if schema == "" {
+		if err := db.QueryRowContext(ctx, "SELECT current_schema()").Scan(&schema); err != nil {
+			return nil, err
+		}
+	}
+
+	// the sequence of the version table's id is left out with it
+	stmts, err := queryStrings(ctx, db, `SELECT 'CREATE SEQUENCE ' || quote_ident(c.relname) || ';'
+		FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'S' AND n.nspname = $1 AND NOT EXISTS (
+			SELECT 1 FROM pg_catalog.pg_depend d JOIN pg_catalog.pg_class t ON t.oid = d.refobjid
+			WHERE d.objid = c.oid AND t.relnamespace = n.oid AND t.relname = $2)
+		ORDER BY c.relname`, schema, name)
 	if err != nil {
-		return nil, ErrTableDoesNotExist
+		return nil, err
 	}
 
-	return rows, err
+	type pgTable struct {
+		oid  int64
+		name string
+	}
+	var tables []pgTable
+	rows, err := db.QueryContext(ctx, `SELECT c.oid, quote_ident(c.relname)
+		FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'r' AND n.nspname = $1 AND c.relname <> $2
+		ORDER BY c.relname`, schema, name)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var t pgTable
+		if err := rows.Scan(&t.oid, &t.name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, t := range tables {
+		columns, err := queryStrings(ctx, db, `SELECT quote_ident(a.attname) || ' ' || pg_catalog.format_type(a.atttypid, a.atttypmod)
+			|| CASE WHEN a.attnotnull THEN ' NOT NULL' ELSE '' END
+			|| COALESCE(' DEFAULT ' || pg_catalog.pg_get_expr(d.adbin, d.adrelid), '')
+			FROM pg_catalog.pg_attribute a
+			LEFT JOIN pg_catalog.pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+			WHERE a.attrelid = $1 AND a.attnum > 0 AND NOT a.attisdropped
+			ORDER BY a.attnum`, t.oid)
+		if err != nil {
+			return nil, err
+		}
+		// foreign keys are added once every table exists
+		constraints, err := queryStrings(ctx, db, `SELECT 'CONSTRAINT ' || quote_ident(conname) || ' ' || pg_catalog.pg_get_constraintdef(oid)
+			FROM pg_catalog.pg_constraint
+			WHERE conrelid = $1 AND contype IN ('p', 'u', 'c')
+			ORDER BY contype, conname`, t.oid)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, "CREATE TABLE "+t.name+" (\n    "+strings.Join(append(columns, constraints...), ",\n    ")+"\n);")
+	}
+
+	for _, q := range []string{
+		`SELECT 'ALTER TABLE ' || quote_ident(t.relname) || ' ADD CONSTRAINT ' || quote_ident(c.conname) || ' ' || pg_catalog.pg_get_constraintdef(c.oid) || ';'
+		FROM pg_catalog.pg_constraint c
+		JOIN pg_catalog.pg_class t ON t.oid = c.conrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		WHERE c.contype = 'f' AND n.nspname = $1 AND t.relname <> $2
+		ORDER BY t.relname, c.conname`,
+		// indexes backing constraints are created with them
+		`SELECT pg_catalog.pg_get_indexdef(i.indexrelid) || ';'
+		FROM pg_catalog.pg_index i
+		JOIN pg_catalog.pg_class t ON t.oid = i.indrelid
+		JOIN pg_catalog.pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_catalog.pg_namespace n ON n.oid = t.relnamespace
+		WHERE n.nspname = $1 AND t.relname <> $2 AND t.relkind = 'r'
+		AND NOT EXISTS (SELECT 1 FROM pg_catalog.pg_constraint c WHERE c.conindid = i.indexrelid)
+		ORDER BY t.relname, ic.relname`,
+		// views in the order they were created, so those they select from
+		// come first
+		`SELECT 'CREATE VIEW ' || quote_ident(c.relname) || ' AS' || chr(10) || rtrim(pg_catalog.pg_get_viewdef(c.oid), ';') || ';'
+		FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind = 'v' AND n.nspname = $1 AND c.relname <> $2
+		ORDER BY c.oid`,
+	} {
+		more, err := queryStrings(ctx, db, q, schema, name)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, more...)
+	}
+	return stmts, nil
+}
+
+// sqlState returns the SQLSTATE code of err, as reported by drivers such as
+// lib/pq, or "" if it has none.
+func sqlState(err error) string {
+	if e, ok := rootCause(err).(interface{ SQLState() string }); ok {
+		return e.SQLState()
+	}
+	return ""
 }
 
 ////////////////////////////
@@ -68,29 +677,98 @@ func (pg PostgresDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
 
 type RedshiftDialect struct{}
 
-func (pg RedshiftDialect) createVersionTableSql() string {
-	return `CREATE TABLE goose_db_version (
+func (pg RedshiftDialect) createVersionTableSql(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + quoteTable(pg, table) + ` (
                 version_id       BIGINT    NOT NULL,
                 is_applied       BOOLEAN   NOT NULL,
-                tstamp           timestamp NOT NULL
+                tstamp           timestamp NOT NULL,
+                name             VARCHAR(255) NULL,
+                checksum         VARCHAR(64) NULL,
+                direction        VARCHAR(4) NULL,
+                actor            VARCHAR(255) NULL,
+                actor_host       VARCHAR(255) NULL
             ) SORTKEY(tstamp);`
 }
 
-func (pg RedshiftDialect) insertVersionSql() string {
-	return "INSERT INTO goose_db_version (version_id, is_applied, tstamp) VALUES ($1, $2, SYSDATE);"
+func (pg RedshiftDialect) insertVersionSql(table string) string {
+	return "INSERT INTO " + quoteTable(pg, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + pg.nowSql() + ");"
 }
 
-func (pg RedshiftDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query("SELECT version_id, is_applied, tstamp from goose_db_version ORDER BY tstamp DESC")
+func (pg RedshiftDialect) nowSql() string {
+	return "SYSDATE"
+}
 
-	// XXX: check for postgres specific error indicating the table doesn't exist.
-	// for now, assume any error is because the table doesn't exist,
-	// in which case we'll try to create it.
-	if err != nil {
-		return nil, ErrTableDoesNotExist
-	}
+func (pg RedshiftDialect) addChecksumColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN checksum VARCHAR(64) NULL;"
+}
+
+func (pg RedshiftDialect) addNameColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN name VARCHAR(255) NULL;"
+}
+
+func (pg RedshiftDialect) addDirectionColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN direction VARCHAR(4) NULL;"
+}
+
+func (pg RedshiftDialect) addActorColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN actor VARCHAR(255) NULL;"
+}
+
+func (pg RedshiftDialect) addActorHostColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(pg, table) + " ADD COLUMN actor_host VARCHAR(255) NULL;"
+}
+
+// Redshift doesn't enforce unique indexes, so versions can't be upserted.
+func (pg RedshiftDialect) upsertVersionSql(table string) string {
+	return ""
+}
+
+func (pg RedshiftDialect) addVersionIndex(ctx context.Context, db *sql.DB, table string) error {
+	return errors.New("redshift doesn't support upserting versions")
+}
+
+func (pg RedshiftDialect) dbVersionQuery(ctx context.Context, db *sql.DB, table string) (*sql.Rows, error) {
+	return db.QueryContext(ctx, "SELECT version_id, is_applied, tstamp, name, checksum, actor, actor_host from "+quoteTable(pg, table)+" ORDER BY tstamp DESC")
+}
+
+// The redshift table has no id to order rows recorded at the same time, so
+// the version is found by scanning the table.
+func (pg RedshiftDialect) currentVersionSql(table string) string {
+	return ""
+}
+
+func (pg RedshiftDialect) tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	return pgTableExists(ctx, db, table)
+}
+
+func (pg RedshiftDialect) QuoteIdentifier(name string) string {
+	return quoteDouble(name)
+}
+
+// Redshift has no advisory locks, so no locking is performed.
+func (pg RedshiftDialect) lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	return nil, nil
+}
+
+func (pg RedshiftDialect) unlockSession(conn *sql.Conn) error {
+	return nil
+}
+
+// serializable isolation violations
+func (pg RedshiftDialect) isRetryable(err error) bool {
+	return sqlState(err) == "40001"
+}
+
+func (pg RedshiftDialect) appliedValue(applied bool) interface{} {
+	return applied
+}
+
+func (pg RedshiftDialect) placeholder() PlaceholderStyle {
+	return PlaceholderDollar
+}
 
-	return rows, err
+func (pg RedshiftDialect) capabilities() DialectCapabilities {
+	return DialectCapabilities{TransactionalDDL: true, CreateTableIfNotExists: true}
 }
 
 ////////////////////////////
@@ -99,31 +777,227 @@ func (pg RedshiftDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
 
 type MySqlDialect struct{}
 
-func (m MySqlDialect) createVersionTableSql() string {
-	return `CREATE TABLE goose_db_version (
+func (m MySqlDialect) createVersionTableSql(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + quoteTable(m, table) + ` (
                 id serial NOT NULL,
                 version_id bigint NOT NULL,
                 is_applied boolean NOT NULL,
-                tstamp timestamp NULL default now(),
+                tstamp timestamp(6) NULL default now(6),
+                name varchar(255) NULL,
+                checksum varchar(64) NULL,
+                direction varchar(4) NULL,
+                actor varchar(255) NULL,
+                actor_host varchar(255) NULL,
                 PRIMARY KEY(id)
             );`
 }
 
-func (m MySqlDialect) insertVersionSql() string {
-	return "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?);"
+func (m MySqlDialect) insertVersionSql(table string) string {
+	return "INSERT INTO " + quoteTable(m, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + m.nowSql() + ");"
+}
+
+// now() is in whole seconds. Version tables created before goose used
+// microseconds keep their column's precision, rounding it off.
+func (m MySqlDialect) nowSql() string {
+	return "NOW(6)"
+}
+
+func (m MySqlDialect) addChecksumColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN checksum varchar(64) NULL;"
 }
 
-func (m MySqlDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query("SELECT version_id, is_applied, tstamp from goose_db_version ORDER BY id DESC")
+func (m MySqlDialect) addNameColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN name varchar(255) NULL;"
+}
+
+func (m MySqlDialect) addDirectionColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN direction varchar(4) NULL;"
+}
 
-	// XXX: check for mysql specific error indicating the table doesn't exist.
-	// for now, assume any error is because the table doesn't exist,
-	// in which case we'll try to create it.
+func (m MySqlDialect) addActorColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN actor varchar(255) NULL;"
+}
+
+func (m MySqlDialect) addActorHostColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN actor_host varchar(255) NULL;"
+}
+
+func (m MySqlDialect) upsertVersionSql(table string) string {
+	return "INSERT INTO " + quoteTable(m, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + m.nowSql() + ")" +
+		" ON DUPLICATE KEY UPDATE is_applied = VALUES(is_applied), tstamp = VALUES(tstamp), name = VALUES(name), checksum = VALUES(checksum), direction = VALUES(direction), actor = VALUES(actor), actor_host = VALUES(actor_host);"
+}
+
+func (m MySqlDialect) addVersionIndex(ctx context.Context, db *sql.DB, table string) error {
+	// mysql has no CREATE INDEX IF NOT EXISTS
+	name := versionIndexName(unqualifiedTable(table))
+	rows, err := db.QueryContext(ctx, "SHOW INDEX FROM "+quoteTable(m, table)+" WHERE Key_name = ?", name)
 	if err != nil {
-		return nil, ErrTableDoesNotExist
+		return err
 	}
+	exists := rows.Next()
+	rows.Close()
+	if exists {
+		return nil
+	}
+
+	_, err = db.ExecContext(ctx, "ALTER TABLE "+quoteTable(m, table)+" ADD UNIQUE INDEX "+m.QuoteIdentifier(name)+" (version_id);")
+	return err
+}
+
+func (m MySqlDialect) dbVersionQuery(ctx context.Context, db *sql.DB, table string) (*sql.Rows, error) {
+	return db.QueryContext(ctx, "SELECT version_id, is_applied, tstamp, name, checksum, actor, actor_host from "+quoteTable(m, table)+" ORDER BY id DESC")
+}
+
+func (m MySqlDialect) currentVersionSql(table string) string {
+	return idCurrentVersionSql(quoteTable(m, table))
+}
+
+func (m MySqlDialect) tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	// the schema is the database, defaulting to the current one
+	schema, name := splitTable(table)
+	schemaArg := sql.NullString{String: schema, Valid: schema != ""}
 
-	return rows, err
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = COALESCE(?, DATABASE()) AND table_name = ?", schemaArg, name).Scan(&count)
+	return count > 0, err
+}
+
+func (m MySqlDialect) QuoteIdentifier(name string) string {
+	return "`" + strings.Replace(name, "`", "``", -1) + "`"
+}
+
+func (m MySqlDialect) lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// a negative timeout waits forever, otherwise it's in whole seconds.
+	// GET_LOCK returns 1 on success, 0 on timeout and NULL on error.
+	timeout := int64(-1)
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = int64(math.Ceil(time.Until(deadline).Seconds()))
+	}
+	var res sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", fmt.Sprint(gooseLockID), timeout).Scan(&res); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if res.Valid && res.Int64 == 0 && timeout >= 0 {
+		conn.Close()
+		return nil, context.DeadlineExceeded
+	}
+	if !res.Valid || res.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("could not acquire lock %d", gooseLockID)
+	}
+
+	return conn, nil
+}
+
+func (m MySqlDialect) unlockSession(conn *sql.Conn) error {
+	defer conn.Close()
+
+	_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", fmt.Sprint(gooseLockID))
+	return err
+}
+
+// ER_LOCK_DEADLOCK, which rolls back the transaction
+func (m MySqlDialect) isRetryable(err error) bool {
+	e, ok := rootCause(err).(*mysql.MySQLError)
+	return ok && e.Number == 1213
+}
+
+func (m MySqlDialect) appliedValue(applied bool) interface{} {
+	return applied
+}
+
+func (m MySqlDialect) placeholder() PlaceholderStyle {
+	return PlaceholderQuestion
+}
+
+// DDL statements implicitly commit the transaction they're run in
+func (m MySqlDialect) capabilities() DialectCapabilities {
+	return DialectCapabilities{AdvisoryLock: true, CreateTableIfNotExists: true}
+}
+
+// splitStatement splits stmt at each semicolon outside of quotes and
+// comments, as the driver rejects several statements in one Exec unless
+// multiStatements is set in the DSN. Statements between StatementBegin and
+// StatementEnd, such as stored procedures, are left whole.
+func (m MySqlDialect) splitStatement(stmt string) []string {
+	if strings.Contains(stmt, sqlCmdPrefix+"StatementBegin") {
+		return []string{stmt}
+	}
+
+	var stmts []string
+	start := 0
+	for i := 0; i < len(stmt); i++ {
+		switch c := stmt[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(stmt, i)
+		case c == '#' || strings.HasPrefix(stmt[i:], "-- "):
+			if j := strings.IndexByte(stmt[i:], '\n'); j >= 0 {
+				i += j
+			} else {
+				i = len(stmt)
+			}
+		case strings.HasPrefix(stmt[i:], "/*"):
+			if j := strings.Index(stmt[i+2:], "*/"); j >= 0 {
+				i += j + 3
+			} else {
+				i = len(stmt)
+			}
+		case c == ';':
+			stmts = appendStatement(stmts, stmt[start:i+1])
+			start = i + 1
+		}
+	}
+	return appendStatement(stmts, stmt[start:])
+}
+
+// skipQuoted returns the index of the quote closing the string, or quoted
+// identifier, opened at stmt[i], where quotes are escaped by doubling them
+// or, but for backticks, with a backslash.
+func skipQuoted(stmt string, i int) int {
+	quote := stmt[i]
+	for i++; i < len(stmt); i++ {
+		switch stmt[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(stmt) && stmt[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return i
+}
+
+// appendStatement appends stmt to stmts unless it's only blanks and
+// comments, which are left over after a statement's semicolon.
+func appendStatement(stmts []string, stmt string) []string {
+	for _, line := range strings.Split(stmt, "\n") {
+		if isSQLStatementLine(line) {
+			return append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+////////////////////////////
+// MariaDB
+////////////////////////////
+
+// MariaDBDialect is for MariaDB, which is so far handled the same as
+// MySQL, but has diverged from it since 10.x, e.g. with sequences and
+// RETURNING, so has its own dialect to branch on.
+type MariaDBDialect struct {
+	MySqlDialect
 }
 
 ////////////////////////////
@@ -132,24 +1006,283 @@ func (m MySqlDialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
 
 type Sqlite3Dialect struct{}
 
-func (m Sqlite3Dialect) createVersionTableSql() string {
-	return `CREATE TABLE goose_db_version (
+func (m Sqlite3Dialect) createVersionTableSql(table string) string {
+	return `CREATE TABLE IF NOT EXISTS ` + quoteTable(m, table) + ` (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 version_id INTEGER NOT NULL,
                 is_applied INTEGER NOT NULL,
-                tstamp TIMESTAMP DEFAULT (datetime('now'))
+                tstamp TIMESTAMP DEFAULT (datetime('now')),
+                name TEXT NULL,
+                checksum TEXT NULL,
+                direction TEXT NULL,
+                actor TEXT NULL,
+                actor_host TEXT NULL
             );`
 }
 
-func (m Sqlite3Dialect) insertVersionSql() string {
-	return "INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?);"
+func (m Sqlite3Dialect) insertVersionSql(table string) string {
+	return "INSERT INTO " + quoteTable(m, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + m.nowSql() + ");"
+}
+
+// datetime('now'), and CURRENT_TIMESTAMP, are in whole seconds, while %f
+// has milliseconds, in a format the driver still parses as a time.
+func (m Sqlite3Dialect) nowSql() string {
+	return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+}
+
+func (m Sqlite3Dialect) addChecksumColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN checksum TEXT NULL;"
+}
+
+func (m Sqlite3Dialect) addNameColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN name TEXT NULL;"
+}
+
+func (m Sqlite3Dialect) addDirectionColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN direction TEXT NULL;"
+}
+
+func (m Sqlite3Dialect) addActorColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN actor TEXT NULL;"
+}
+
+func (m Sqlite3Dialect) addActorHostColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(m, table) + " ADD COLUMN actor_host TEXT NULL;"
+}
+
+func (m Sqlite3Dialect) upsertVersionSql(table string) string {
+	return "INSERT OR REPLACE INTO " + quoteTable(m, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + m.nowSql() + ");"
+}
+
+func (m Sqlite3Dialect) addVersionIndex(ctx context.Context, db *sql.DB, table string) error {
+	// sqlite qualifies the index name with the schema, rather than the table
+	_, err := db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS "+quoteTable(m, versionIndexName(table))+" ON "+m.QuoteIdentifier(unqualifiedTable(table))+" (version_id);")
+	return err
+}
+
+func (m Sqlite3Dialect) dbVersionQuery(ctx context.Context, db *sql.DB, table string) (*sql.Rows, error) {
+	return db.QueryContext(ctx, "SELECT version_id, is_applied, tstamp, name, checksum, actor, actor_host from "+quoteTable(m, table)+" ORDER BY id DESC")
+}
+
+func (m Sqlite3Dialect) currentVersionSql(table string) string {
+	return idCurrentVersionSql(quoteTable(m, table))
+}
+
+func (m Sqlite3Dialect) tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	// each attached database has its own sqlite_master
+	master := "sqlite_master"
+	schema, name := splitTable(table)
+	if schema != "" {
+		master = m.QuoteIdentifier(schema) + "." + master
+	}
+
+	var count int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+master+" WHERE type = 'table' AND name = ?", name).Scan(&count)
+	return count > 0, err
+}
+
+func (m Sqlite3Dialect) QuoteIdentifier(name string) string {
+	return quoteDouble(name)
+}
+
+// sqlite3 already serializes writers on the database file, so no locking is
+// performed.
+func (m Sqlite3Dialect) lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	return nil, nil
+}
+
+func (m Sqlite3Dialect) unlockSession(conn *sql.Conn) error {
+	return nil
+}
+
+// waiting for a locked database is left to SqliteBusyTimeout
+func (m Sqlite3Dialect) isRetryable(err error) bool {
+	return false
+}
+
+// the driver stores bools in the INTEGER column as 1 and 0
+func (m Sqlite3Dialect) appliedValue(applied bool) interface{} {
+	return applied
+}
+
+func (m Sqlite3Dialect) placeholder() PlaceholderStyle {
+	return PlaceholderQuestion
+}
+
+func (m Sqlite3Dialect) capabilities() DialectCapabilities {
+	return DialectCapabilities{TransactionalDDL: true, CreateTableIfNotExists: true}
+}
+
+// sqlite keeps the statements creating each table, index, view and trigger,
+// which are dumped in the order they were created.
+func (m Sqlite3Dialect) dumpSchema(ctx context.Context, db *sql.DB, table string) ([]string, error) {
+	// each attached database has its own sqlite_master
+	master := "sqlite_master"
+	schema, name := splitTable(table)
+	if schema != "" {
+		master = m.QuoteIdentifier(schema) + "." + master
+	}
+
+	return queryStrings(ctx, db, "SELECT sql || ';' FROM "+master+" WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\' AND tbl_name <> ? ORDER BY rowid", name)
+}
+
+////////////////////////////
+// Oracle
+////////////////////////////
+
+// OracleDialect supports Oracle 12c and later, which have identity columns
+// and FETCH FIRST.
+type OracleDialect struct{}
+
+func (o OracleDialect) createVersionTableSql(table string) string {
+	// oracle has no CREATE TABLE IF NOT EXISTS, so createVersionTable checks
+	// whether the table exists if this fails.
+	// it also has no boolean type, so is_applied is 0 or 1
+	return `CREATE TABLE ` + quoteTable(o, table) + ` (
+                id NUMBER(19) GENERATED BY DEFAULT AS IDENTITY,
+                version_id NUMBER(19) NOT NULL,
+                is_applied NUMBER(1) NOT NULL,
+                tstamp TIMESTAMP DEFAULT SYSTIMESTAMP,
+                name VARCHAR2(255) NULL,
+                checksum VARCHAR2(64) NULL,
+                direction VARCHAR2(4) NULL,
+                actor VARCHAR2(255) NULL,
+                actor_host VARCHAR2(255) NULL,
+                PRIMARY KEY(id)
+            )`
+}
+
+func (o OracleDialect) insertVersionSql(table string) string {
+	return "INSERT INTO " + quoteTable(o, table) + " (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, " + o.nowSql() + ")"
+}
+
+func (o OracleDialect) nowSql() string {
+	return "SYSTIMESTAMP"
+}
+
+func (o OracleDialect) addChecksumColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(o, table) + " ADD (checksum VARCHAR2(64) NULL)"
+}
+
+func (o OracleDialect) addNameColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(o, table) + " ADD (name VARCHAR2(255) NULL)"
+}
+
+func (o OracleDialect) addDirectionColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(o, table) + " ADD (direction VARCHAR2(4) NULL)"
+}
+
+func (o OracleDialect) addActorColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(o, table) + " ADD (actor VARCHAR2(255) NULL)"
+}
+
+func (o OracleDialect) addActorHostColumnSql(table string) string {
+	return "ALTER TABLE " + quoteTable(o, table) + " ADD (actor_host VARCHAR2(255) NULL)"
+}
+
+func (o OracleDialect) upsertVersionSql(table string) string {
+	return "MERGE INTO " + quoteTable(o, table) + " t" +
+		" USING (SELECT ? version_id, ? is_applied, ? name, ? checksum, ? direction, ? actor, ? actor_host FROM dual) s" +
+		" ON (t.version_id = s.version_id)" +
+		" WHEN MATCHED THEN UPDATE SET t.is_applied = s.is_applied, t.tstamp = " + o.nowSql() + ", t.name = s.name, t.checksum = s.checksum, t.direction = s.direction, t.actor = s.actor, t.actor_host = s.actor_host" +
+		" WHEN NOT MATCHED THEN INSERT (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (s.version_id, s.is_applied, s.name, s.checksum, s.direction, s.actor, s.actor_host, " + o.nowSql() + ")"
+}
+
+func (o OracleDialect) addVersionIndex(ctx context.Context, db *sql.DB, table string) error {
+	// oracle has no CREATE INDEX IF NOT EXISTS, and before 12.2 names are
+	// limited to 30 characters, too few for versionIndexName
+	schema, name := splitTable(table)
+	index := name + "_version_uk"
+
+	var count int
+	var err error
+	if schema != "" {
+		err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM all_indexes WHERE owner = UPPER(:1) AND index_name = UPPER(:2)", schema, index).Scan(&count)
+	} else {
+		err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_indexes WHERE index_name = UPPER(:1)", index).Scan(&count)
+	}
+	if err != nil || count > 0 {
+		return err
+	}
+
+	if schema != "" {
+		index = schema + "." + index
+	}
+	_, err = db.ExecContext(ctx, "CREATE UNIQUE INDEX "+quoteTable(o, index)+" ON "+quoteTable(o, table)+" (version_id)")
+	return err
+}
+
+func (o OracleDialect) dbVersionQuery(ctx context.Context, db *sql.DB, table string) (*sql.Rows, error) {
+	return db.QueryContext(ctx, "SELECT version_id, is_applied, tstamp, name, checksum, actor, actor_host FROM "+quoteTable(o, table)+" ORDER BY id DESC")
+}
+
+func (o OracleDialect) currentVersionSql(table string) string {
+	return "SELECT v.version_id FROM " + quoteTable(o, table) + " v WHERE v.is_applied = 1" +
+		" AND NOT EXISTS (SELECT 1 FROM " + quoteTable(o, table) + " l WHERE l.version_id = v.version_id AND l.id > v.id)" +
+		" ORDER BY v.version_id DESC FETCH FIRST 1 ROWS ONLY"
+}
+
+func (o OracleDialect) tableExists(ctx context.Context, db *sql.DB, table string) (bool, error) {
+	// unquoted names are stored upper cased
+	var count int
+	var err error
+	if schema, name := splitTable(table); schema != "" {
+		err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM all_tables WHERE owner = UPPER(:1) AND table_name = UPPER(:2)", schema, name).Scan(&count)
+	} else {
+		err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM user_tables WHERE table_name = UPPER(:1)", name).Scan(&count)
+	}
+	return count > 0, err
+}
+
+// Names are upper cased, as oracle stores unquoted ones, so that quoting
+// goose_db_version still refers to a table created without quotes.
+func (o OracleDialect) QuoteIdentifier(name string) string {
+	return quoteDouble(strings.ToUpper(name))
+}
+
+// Locking with DBMS_LOCK needs privileges which aren't granted by default,
+// so no locking is performed.
+func (o OracleDialect) lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	return nil, nil
+}
+
+func (o OracleDialect) unlockSession(conn *sql.Conn) error {
+	return nil
+}
+
+// ORA-08177: can't serialize access for this transaction
+func (o OracleDialect) isRetryable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "ORA-08177")
+}
+
+// is_applied is a NUMBER(1), as oracle has no boolean column type
+func (o OracleDialect) appliedValue(applied bool) interface{} {
+	if applied {
+		return 1
+	}
+	return 0
+}
+
+func (o OracleDialect) placeholder() PlaceholderStyle {
+	return PlaceholderColon
+}
+
+// like mysql, DDL statements implicitly commit, and there's no
+// CREATE TABLE IF NOT EXISTS
+func (o OracleDialect) capabilities() DialectCapabilities {
+	return DialectCapabilities{}
 }
 
-func (m Sqlite3Dialect) dbVersionQuery(db *sql.DB) (*sql.Rows, error) {
-	rows, err := db.Query("SELECT version_id, is_applied, tstamp from goose_db_version ORDER BY id DESC")
+// matches the end of a PL/SQL block, e.g. "END;" or "END my_proc;"
+var plsqlEndRegexp = regexp.MustCompile(`(?i)\bEND(\s+\w+)?\s*;$`)
 
-	if err != nil && strings.Contains(err.Error(), "no such table") {
-		err = ErrTableDoesNotExist
+// rewriteStatement drops the semicolon terminating plain SQL statements,
+// which oracle rejects, while keeping it at the end of PL/SQL blocks, where
+// it's required.
+func (o OracleDialect) rewriteStatement(stmt string) string {
+	trimmed := strings.TrimSpace(stmt)
+	if plsqlEndRegexp.MatchString(trimmed) {
+		return trimmed
 	}
-	return rows, err
+	return strings.TrimSuffix(trimmed, ";")
 }
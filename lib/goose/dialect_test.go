@@ -0,0 +1,386 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testLockSession(t *testing.T, driver DBDriver) {
+	conf := &DBConf{Driver: driver}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	conn, err := driver.Dialect.lockSession(context.Background(), db)
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+
+	acquired := make(chan *sql.Conn)
+	go func() {
+		conn, err := driver.Dialect.lockSession(context.Background(), db)
+		assert.NoError(t, err)
+		acquired <- conn
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("lock acquired while already held")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, driver.Dialect.unlockSession(conn))
+
+	select {
+	case conn := <-acquired:
+		require.NotNil(t, conn)
+		assert.NoError(t, driver.Dialect.unlockSession(conn))
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock not acquired after being released")
+	}
+}
+func TestLockSession_mysql(t *testing.T) {
+	testLockSession(t, getMysqlDriver(t))
+}
+func TestLockSession_postgres(t *testing.T) {
+	testLockSession(t, getPostgresDriver(t))
+}
+
+func testLockSession_timeout(t *testing.T, driver DBDriver) {
+	conf := &DBConf{Driver: driver}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	conn, err := driver.Dialect.lockSession(context.Background(), db)
+	require.NoError(t, err)
+	defer driver.Dialect.unlockSession(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err = driver.Dialect.lockSession(ctx, db)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 3*time.Second, "gave up after %s", time.Since(start))
+}
+func TestLockSession_timeout_mysql(t *testing.T) {
+	testLockSession_timeout(t, getMysqlDriver(t))
+}
+func TestLockSession_timeout_postgres(t *testing.T) {
+	testLockSession_timeout(t, getPostgresDriver(t))
+}
+
+// blockingLockDialect never acquires the migration lock.
+type blockingLockDialect struct {
+	Sqlite3Dialect
+}
+
+func (blockingLockDialect) lockSession(ctx context.Context, db *sql.DB) (*sql.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestLockDB_timeout(t *testing.T) {
+	conf := &DBConf{
+		Driver:      DBDriver{Name: "sqlite3", OpenStr: ":memory:", Dialect: blockingLockDialect{}},
+		LockTimeout: 50 * time.Millisecond,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = lockDB(context.Background(), conf, db)
+	require.Error(t, err)
+	assert.Equal(t, "could not acquire the migration lock within 50ms", err.Error())
+
+	// but cancelling isn't reported as a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = lockDB(ctx, conf, db)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "within")
+}
+
+func testTableExists(t *testing.T, driver DBDriver) {
+	ctx := context.Background()
+	conf := &DBConf{Driver: driver}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	// keep sqlite's :memory: DB on a single connection
+	db.SetMaxOpenConns(1)
+
+	table := "goose_test_table_exists"
+	_, err = db.Exec("DROP TABLE IF EXISTS " + table)
+	require.NoError(t, err)
+
+	exists, err := driver.Dialect.tableExists(ctx, db, table)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = db.Exec("CREATE TABLE " + table + " (id int)")
+	require.NoError(t, err)
+	defer db.Exec("DROP TABLE " + table)
+
+	exists, err = driver.Dialect.tableExists(ctx, db, table)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+func TestTableExists_sqlite3(t *testing.T) {
+	testTableExists(t, getSqlite3Driver(t))
+}
+func TestTableExists_mysql(t *testing.T) {
+	testTableExists(t, getMysqlDriver(t))
+}
+func TestTableExists_postgres(t *testing.T) {
+	testTableExists(t, getPostgresDriver(t))
+}
+func TestTableExists_redshift(t *testing.T) {
+	testTableExists(t, getRedshiftDriver(t))
+}
+
+func TestSplitTable(t *testing.T) {
+	schema, name := splitTable("goose_db_version")
+	assert.Equal(t, "", schema)
+	assert.Equal(t, "goose_db_version", name)
+
+	schema, name = splitTable("other.goose_db_version")
+	assert.Equal(t, "other", schema)
+	assert.Equal(t, "goose_db_version", name)
+}
+
+func TestOracleDialect_rewriteStatement(t *testing.T) {
+	tests := map[string]string{
+		"CREATE TABLE post (id NUMBER);\n":                "CREATE TABLE post (id NUMBER)",
+		"BEGIN\n  NULL;\nEND;\n":                          "BEGIN\n  NULL;\nEND;",
+		"CREATE PROCEDURE p AS\nBEGIN\n  NULL;\nEND p;\n": "CREATE PROCEDURE p AS\nBEGIN\n  NULL;\nEND p;",
+	}
+	for stmt, want := range tests {
+		assert.Equal(t, want, OracleDialect{}.rewriteStatement(stmt))
+	}
+}
+
+func TestMySqlDialect_splitStatement(t *testing.T) {
+	tests := map[string][]string{
+		"INSERT INTO t VALUES(1);\n":                          {"INSERT INTO t VALUES(1);"},
+		"INSERT INTO t VALUES(1); INSERT INTO t VALUES(2);\n": {"INSERT INTO t VALUES(1);", " INSERT INTO t VALUES(2);"},
+		"INSERT INTO t VALUES('a;b', \"c;\", 'd\\';');\n":     {"INSERT INTO t VALUES('a;b', \"c;\", 'd\\';');"},
+		"INSERT INTO t VALUES('it''s;');\n":                   {"INSERT INTO t VALUES('it''s;');"},
+		"SELECT 1; -- one; two\n":                             {"SELECT 1;"},
+		"SELECT 1; /* ; */ SELECT 2;\n":                       {"SELECT 1;", " /* ; */ SELECT 2;"},
+		"-- +goose StatementBegin\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END;\n-- +goose StatementEnd\n": {
+			"-- +goose StatementBegin\nCREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END;\n-- +goose StatementEnd\n",
+		},
+	}
+	for stmt, want := range tests {
+		assert.Equal(t, want, MySqlDialect{}.splitStatement(stmt), "%q", stmt)
+	}
+}
+
+func TestDBConf_Capabilities(t *testing.T) {
+	tests := map[string]DialectCapabilities{
+		"postgres": {TransactionalDDL: true, AdvisoryLock: true, CreateTableIfNotExists: true},
+		"redshift": {TransactionalDDL: true, CreateTableIfNotExists: true},
+		"mysql":    {AdvisoryLock: true, CreateTableIfNotExists: true},
+		"mariadb":  {AdvisoryLock: true, CreateTableIfNotExists: true},
+		"sqlite3":  {TransactionalDDL: true, CreateTableIfNotExists: true},
+		"oracle":   {},
+	}
+	for name, want := range tests {
+		conf := &DBConf{Driver: DBDriver{Name: name, Dialect: dialectByName(name)}}
+		assert.Equal(t, want, conf.Capabilities(), name)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "INSERT INTO t (a, b, c) VALUES (?, ?, '?')"
+	assert.Equal(t, query, Rebind(PlaceholderQuestion, query))
+	assert.Equal(t, "INSERT INTO t (a, b, c) VALUES ($1, $2, '?')", Rebind(PlaceholderDollar, query))
+	assert.Equal(t, "INSERT INTO t (a, b, c) VALUES (:1, :2, '?')", Rebind(PlaceholderColon, query))
+
+	conf := &DBConf{Driver: DBDriver{Dialect: PostgresDialect{}}}
+	assert.Equal(t, "INSERT INTO \"goose_db_version\" (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES ($1, $2, $3, $4, $5, $6, $7, clock_timestamp());",
+		conf.rebind(conf.Driver.Dialect.insertVersionSql(conf.versionTable())))
+}
+
+func TestPlaceholderDialect(t *testing.T) {
+	// the postgres dialect with a driver expecting ?
+	conf := &DBConf{Driver: DBDriver{Dialect: PlaceholderDialect{Dialect: PostgresDialect{}, Style: PlaceholderQuestion}}}
+	assert.Equal(t, "INSERT INTO \"goose_db_version\" (version_id, is_applied, name, checksum, direction, actor, actor_host, tstamp) VALUES (?, ?, ?, ?, ?, ?, ?, clock_timestamp());",
+		conf.rebind(conf.Driver.Dialect.insertVersionSql(conf.versionTable())))
+
+	// its statements are still rewritten and split as the dialect's are
+	var dialect SqlDialect = PlaceholderDialect{Dialect: OracleDialect{}, Style: PlaceholderQuestion}
+	assert.Equal(t, "SELECT 1 FROM dual", dialect.(statementRewriter).rewriteStatement("SELECT 1 FROM dual;"))
+	dialect = PlaceholderDialect{Dialect: MySqlDialect{}, Style: PlaceholderDollar}
+	assert.Equal(t, []string{"SELECT 1;", " SELECT 2;"}, dialect.(statementSplitter).splitStatement("SELECT 1; SELECT 2;"))
+}
+
+type testVitessDialect struct {
+	MySqlDialect
+}
+
+// sqlStateError is a driver error with a SQLSTATE, like lib/pq's.
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "pq: " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestIsRetryable(t *testing.T) {
+	wrapped := func(err error) error {
+		return wrapError(err, "migration 001_foo.sql: statement 1 failed: %s (SELECT 1;)", err)
+	}
+
+	assert.True(t, PostgresDialect{}.isRetryable(wrapped(sqlStateError("40001"))))
+	assert.True(t, PostgresDialect{}.isRetryable(sqlStateError("40P01")))
+	assert.False(t, PostgresDialect{}.isRetryable(wrapped(sqlStateError("42P01"))))
+	assert.False(t, PostgresDialect{}.isRetryable(errors.New("40001")))
+	assert.True(t, RedshiftDialect{}.isRetryable(sqlStateError("40001")))
+
+	assert.True(t, MySqlDialect{}.isRetryable(wrapped(&mysql.MySQLError{Number: 1213})))
+	assert.True(t, MariaDBDialect{}.isRetryable(&mysql.MySQLError{Number: 1213}))
+	assert.False(t, MySqlDialect{}.isRetryable(&mysql.MySQLError{Number: 1146}))
+
+	assert.True(t, OracleDialect{}.isRetryable(errors.New("ORA-08177: can't serialize access for this transaction")))
+	assert.False(t, Sqlite3Dialect{}.isRetryable(errors.New("database is locked")))
+}
+
+func TestAppliedValue(t *testing.T) {
+	for _, d := range []SqlDialect{PostgresDialect{}, RedshiftDialect{}, MySqlDialect{}, MariaDBDialect{}, Sqlite3Dialect{}} {
+		assert.Equal(t, true, d.appliedValue(true), "%T", d)
+		assert.Equal(t, false, d.appliedValue(false), "%T", d)
+	}
+	assert.Equal(t, 1, OracleDialect{}.appliedValue(true))
+	assert.Equal(t, 0, OracleDialect{}.appliedValue(false))
+}
+
+func TestRegisterDialect(t *testing.T) {
+	RegisterDialect("vitess", "example.com/vitess", testVitessDialect{})
+	defer delete(dialects, "vitess")
+
+	d := newDBDriver("vitess", "foo")
+	assert.Equal(t, DBDriver{
+		Name:    "vitess",
+		OpenStr: "foo",
+		Import:  "example.com/vitess",
+		Dialect: testVitessDialect{},
+	}, d)
+
+	assert.Equal(t, testVitessDialect{}, dialectByName("vitess"))
+
+	// built-in drivers are unaffected
+	assert.Equal(t, &MySqlDialect{}, newDBDriver("mysql", "").Dialect)
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	// order is a reserved word in every dialect
+	tests := map[string][2]string{
+		"postgres": {`"order"`, `"my""schema"."order"`},
+		"redshift": {`"order"`, `"my""schema"."order"`},
+		"mysql":    {"`order`", "`my\"schema`.`order`"},
+		"sqlite3":  {`"order"`, `"my""schema"."order"`},
+		// upper cased, as oracle stores unquoted names
+		"oracle": {`"ORDER"`, `"MY""SCHEMA"."ORDER"`},
+	}
+	for name, want := range tests {
+		d := dialectByName(name)
+		assert.Equal(t, want[0], d.QuoteIdentifier("order"), name)
+		assert.Equal(t, want[1], quoteTable(d, `my"schema.order`), name)
+	}
+	assert.Equal(t, "`a``b`", MySqlDialect{}.QuoteIdentifier("a`b"))
+
+	// the version table is quoted in the dialects' statements
+	conf := &DBConf{Driver: DBDriver{Dialect: MySqlDialect{}}, Schema: "order"}
+	assert.Equal(t, "ALTER TABLE `order`.`goose_db_version` ADD COLUMN name varchar(255) NULL;",
+		conf.Driver.Dialect.addNameColumnSql(conf.versionTable()))
+}
+
+func TestEnsureDBVersion_quotedSchema(t *testing.T) {
+	conf := &DBConf{
+		Driver: getSqlite3Driver(t),
+		Schema: "order",
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// a database attached under a keyword
+	_, err = db.Exec(`ATTACH DATABASE ':memory:' AS "order"`)
+	require.NoError(t, err)
+
+	version, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM "order".goose_db_version`).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func testRecordedTimestamps(t *testing.T, driver DBDriver) {
+	conf := &DBConf{Driver: driver}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.Exec("DROP TABLE goose_db_version")
+	defer db.Exec("DROP TABLE goose_db_version")
+
+	ctx := context.Background()
+	_, err = ensureDBVersion(ctx, conf, db)
+	require.NoError(t, err)
+
+	// two versions recorded in quick succession, in the same transaction,
+	// as with DBConf.SingleTransaction
+	txn, err := db.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	d := conf.Driver.Dialect
+	for _, v := range []int64{1, 2} {
+		_, err = txn.ExecContext(ctx, conf.rebind(d.insertVersionSql(conf.versionTable())), v, d.appliedValue(true), nil, nil, nil, nil, nil)
+		require.NoError(t, err)
+		// the finest precision of any dialect is milliseconds
+		time.Sleep(2 * time.Millisecond)
+	}
+	require.NoError(t, txn.Commit())
+
+	migrations := []*Migration{{Version: 1}, {Version: 2}}
+	_, err = getMigrationsStatus(ctx, conf, db, migrations)
+	require.NoError(t, err)
+	assert.True(t, migrations[1].TStamp.After(migrations[0].TStamp), "%s, %s", migrations[0].TStamp, migrations[1].TStamp)
+}
+func TestRecordedTimestamps_sqlite3(t *testing.T) {
+	testRecordedTimestamps(t, getSqlite3Driver(t))
+}
+func TestRecordedTimestamps_mysql(t *testing.T) {
+	testRecordedTimestamps(t, getMysqlDriver(t))
+}
+func TestRecordedTimestamps_postgres(t *testing.T) {
+	testRecordedTimestamps(t, getPostgresDriver(t))
+}
+
+func TestNowSql(t *testing.T) {
+	tests := map[string]string{
+		"postgres": "clock_timestamp()",
+		"redshift": "SYSDATE",
+		"mysql":    "NOW(6)",
+		"mariadb":  "NOW(6)",
+		"sqlite3":  "strftime('%Y-%m-%d %H:%M:%f', 'now')",
+		"oracle":   "SYSTIMESTAMP",
+	}
+	for name, want := range tests {
+		d := dialectByName(name)
+		assert.Equal(t, want, d.nowSql(), name)
+		assert.Contains(t, d.insertVersionSql("goose_db_version"), want, name)
+		if upsert := d.upsertVersionSql("goose_db_version"); upsert != "" {
+			assert.Contains(t, upsert, "tstamp", name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package goose
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ExportMigrations writes the Up statements of the SQL migrations in dirpath
+// with versions from from to to, inclusive, to w as a single script, in
+// version order, with a comment naming each migration before its
+// statements. The goose annotations are left out, so the script can be
+// applied by other tools. Go migrations can't be exported, so only get a
+// comment noting they were skipped.
+func ExportMigrations(w io.Writer, dirpath string, from, to int64) error {
+	migrations, err := CollectMigrations(dirpath)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version < from || m.Version > to {
+			continue
+		}
+
+		name := filepath.Base(m.Source)
+		if migrationExt(m.Source) != ".sql" {
+			if _, err := fmt.Fprintf(w, "-- version %d: %s skipped, go migrations can't be exported\n\n", m.Version, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		r, err := readSQLMigration(m.Source)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "-- version %d: %s\n", m.Version, name); err != nil {
+			return err
+		}
+		for _, stmt := range splitSQLStatements(r, DirectionUp) {
+			if _, err := fmt.Fprintln(w, exportStatement(stmt)); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// exportStatement removes the goose annotations, such as StatementBegin,
+// from a statement returned by splitSQLStatements.
+func exportStatement(stmt string) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(stmt), "\n") {
+		if !strings.HasPrefix(line, sqlCmdPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,41 @@
+package goose
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportMigrations(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');\nINSERT INTO test(value) VALUES('uno');", "DELETE FROM test;"},
+		"20010203040509_late.sql":  [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	// env vars are expanded as when migrating
+	os.Setenv("GOOSE_TEST_EXPORT_VALUE", "two")
+	defer os.Unsetenv("GOOSE_TEST_EXPORT_VALUE")
+	err := ioutil.WriteFile(filepath.Join(md, "20010203040508_env.sql"),
+		[]byte("-- +goose ENV GOOSE_TEST_EXPORT_VALUE\n-- +goose Up\nINSERT INTO test(value) VALUES('$GOOSE_TEST_EXPORT_VALUE');\n\n-- +goose Down\nDELETE FROM test;\n"),
+		0600)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = ExportMigrations(&buf, md, 20010203040507, 20010203040508)
+	require.NoError(t, err)
+	assert.Equal(t, `-- version 20010203040507: 20010203040507_one.sql
+INSERT INTO test(value) VALUES('one');
+INSERT INTO test(value) VALUES('uno');
+
+-- version 20010203040508: 20010203040508_env.sql
+INSERT INTO test(value) VALUES('two');
+
+`, buf.String())
+}
@@ -0,0 +1,58 @@
+package goose
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// runHook runs command, the DBConf's BeforeMigrate or AfterMigrate hook
+// called name, with the system shell. Besides the environment goose runs
+// with, the command is given
+//
+//	GOOSE_HOOK       the name of the hook
+//	GOOSE_DIRECTION  "up" or "down"
+//	GOOSE_TARGET     the version being migrated to
+//
+// and the afterMigrate hook GOOSE_STATUS, "ok" or "failed" depending on
+// migrateErr. An empty command does nothing.
+func runHook(ctx context.Context, conf *DBConf, name, command string, direction Direction, target int64, migrateErr error) error {
+	if command == "" {
+		return nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		"GOOSE_HOOK="+name,
+		"GOOSE_DIRECTION="+direction.String(),
+		"GOOSE_TARGET="+strconv.FormatInt(target, 10),
+	)
+	if name == "afterMigrate" {
+		status := "ok"
+		if migrateErr != nil {
+			status = "failed"
+		}
+		cmd.Env = append(cmd.Env, "GOOSE_STATUS="+status)
+	}
+
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if conf.Output != nil {
+		stdout, stderr = conf.Output, conf.Output
+	}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook failed: %s", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package goose
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Logger is used by goose to report the progress of migrations.
+// *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+	Println(v ...interface{})
+}
+
+// stdoutLogger is the default Logger, printing to os.Stdout.
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, v ...interface{}) { fmt.Printf(format, v...) }
+func (stdoutLogger) Println(v ...interface{})               { fmt.Println(v...) }
+
+var logger Logger = stdoutLogger{}
+
+// SetLogger replaces the Logger goose reports progress to.
+// To discard all output, use log.New(ioutil.Discard, "", 0).
+func SetLogger(l Logger) {
+	logger = l
+}
+
+// MigrationReport is the JSON object reported for each migration run with
+// DBConf.JSON. Type is "migration".
+type MigrationReport struct {
+	Type       string  `json:"type"`
+	Version    int64   `json:"version"`
+	Source     string  `json:"source"`
+	Direction  string  `json:"direction"`
+	DurationMs float64 `json:"duration_ms"`
+	OK         bool    `json:"ok"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// SummaryReport is the JSON object reported after the migrations of a run
+// with DBConf.JSON, including when there are none to run. Type is
+// "summary".
+type SummaryReport struct {
+	Type       string  `json:"type"`
+	Direction  string  `json:"direction"`
+	Target     int64   `json:"target"`
+	Migrations int     `json:"migrations"`
+	DurationMs float64 `json:"duration_ms"`
+	OK         bool    `json:"ok"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// StatementReport is the JSON object reported for each statement executed
+// with DBConf.PrintSQL and DBConf.JSON. Type is "statement".
+type StatementReport struct {
+	Type      string `json:"type"`
+	Version   int64  `json:"version"`
+	Source    string `json:"source"`
+	Direction string `json:"direction"`
+	Statement string `json:"statement"`
+}
+
+// printStatement reports a statement of a SQL migration about to be
+// executed, for DBConf.PrintSQL.
+func printStatement(out Logger, conf *DBConf, v int64, scriptFile string, direction Direction, stmt string) {
+	if !conf.JSON {
+		out.Printf("SQL   %d %s: %s\n", v, direction, strings.TrimSpace(stmt))
+		return
+	}
+	printJSON(out, StatementReport{
+		Type:      "statement",
+		Version:   v,
+		Source:    scriptFile,
+		Direction: direction.String(),
+		Statement: stmt,
+	})
+}
+
+// printMigrationResult reports a migration that ran, as an OK line or, with
+// DBConf.JSON, a MigrationReport. A failed migration is only reported with
+// DBConf.JSON, as otherwise its error is.
+func printMigrationResult(out Logger, conf *DBConf, m *Migration, direction Direction, d time.Duration, err error) {
+	if !conf.JSON {
+		if err == nil {
+			out.Printf("OK    %s (%s)\n", filepath.Base(m.Source), formatDuration(d))
+		}
+		return
+	}
+	r := MigrationReport{
+		Type:       "migration",
+		Version:    m.Version,
+		Source:     m.Source,
+		Direction:  direction.String(),
+		DurationMs: durationMs(d),
+		OK:         err == nil,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	printJSON(out, r)
+}
+
+// printSummary reports the end of a run of n migrations, as the total time
+// or, with DBConf.JSON, a SummaryReport.
+func printSummary(out Logger, conf *DBConf, direction Direction, target int64, n int, d time.Duration, err error) {
+	if !conf.JSON {
+		if err == nil {
+			out.Printf("goose: total time %s (%d migrations)\n", formatDuration(d), n)
+		}
+		return
+	}
+	r := SummaryReport{
+		Type:       "summary",
+		Direction:  direction.String(),
+		Target:     target,
+		Migrations: n,
+		DurationMs: durationMs(d),
+		OK:         err == nil,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	printJSON(out, r)
+}
+
+func printJSON(out Logger, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// the reports only hold strings and numbers
+		panic(err)
+	}
+	out.Printf("%s\n", b)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
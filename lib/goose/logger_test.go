@@ -0,0 +1,129 @@
+package goose
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLogger(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var buf bytes.Buffer
+	defer SetLogger(logger)
+	SetLogger(log.New(&buf, "", 0))
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), "goose: migrating db, current version: 0, target: 20010203040506")
+	assert.Regexp(t, `OK    20010203040506_setup.sql \([0-9.]+[µm]?s\)`, buf.String())
+	assert.Regexp(t, `goose: total time [0-9.]+[µm]?s \(1 migrations\)`, buf.String())
+}
+
+func TestDBConfOutput(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+
+	var buf bytes.Buffer
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        &buf,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var logBuf bytes.Buffer
+	defer SetLogger(logger)
+	SetLogger(log.New(&logBuf, "", 0))
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	assert.Contains(t, buf.String(), "OK    20010203040506_setup.sql")
+	assert.Empty(t, logBuf.String())
+}
+
+func TestDBConfJSON(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_fail.sql":  [2]string{"INSERT INTO nonexistent(value) VALUES('one');", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	var buf bytes.Buffer
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        &buf,
+		JSON:          true,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3, buf.String())
+
+	var m MigrationReport
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &m))
+	assert.Equal(t, "migration", m.Type)
+	assert.EqualValues(t, 20010203040506, m.Version)
+	assert.Equal(t, filepath.Join(md, "20010203040506_setup.sql"), m.Source)
+	assert.Equal(t, "up", m.Direction)
+	assert.True(t, m.OK)
+	assert.Empty(t, m.Error)
+
+	m = MigrationReport{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &m))
+	assert.EqualValues(t, 20010203040507, m.Version)
+	assert.False(t, m.OK)
+	assert.Contains(t, m.Error, "no such table: nonexistent")
+
+	var sum SummaryReport
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &sum))
+	assert.Equal(t, SummaryReport{
+		Type:       "summary",
+		Direction:  "up",
+		Target:     20010203040507,
+		Migrations: 1,
+		DurationMs: sum.DurationMs,
+		OK:         false,
+		Error:      err.Error(),
+	}, sum)
+
+	// with nothing to run, there's just the summary
+	buf.Reset()
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+	sum = SummaryReport{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &sum))
+	assert.True(t, sum.OK)
+	assert.Equal(t, 0, sum.Migrations)
+}
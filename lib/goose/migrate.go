@@ -1,10 +1,17 @@
 package goose
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"sort"
@@ -12,13 +19,53 @@ import (
 	"strings"
 	"text/template"
 	"time"
+	"unicode"
 )
 
 var (
 	ErrTableDoesNotExist = errors.New("table does not exist")
 	ErrNoPreviousVersion = errors.New("no previous version found")
+	ErrNoNextVersion     = errors.New("no next version found")
 )
 
+// MigrationError is returned by the Run functions when a migration fails,
+// wrapping the error from running it, so callers can tell which migration
+// failed, and why.
+type MigrationError struct {
+	Version   int64
+	Source    string
+	Direction Direction
+	// RolledBack is set if the migrations were run in a single
+	// transaction, with DBConf.SingleTransaction, and so every migration
+	// in the run was rolled back.
+	RolledBack bool
+	Err        error
+}
+
+func (e *MigrationError) Error() string {
+	if e.RolledBack {
+		return fmt.Sprintf("FAIL %v, rolled back all migrations", e.Err)
+	}
+	return fmt.Sprintf("FAIL %v, quitting migration", e.Err)
+}
+
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// MigrationErrors is returned by the Run functions when down migrations
+// failed with DBConf.ContinueOnError, holding each failure in the order the
+// migrations ran.
+type MigrationErrors []*MigrationError
+
+func (e MigrationErrors) Error() string {
+	versions := make([]string, len(e))
+	for i, m := range e {
+		versions[i] = strconv.FormatInt(m.Version, 10)
+	}
+	return fmt.Sprintf("FAIL %d migrations failed to roll back: %s", len(e), strings.Join(versions, ", "))
+}
+
 type Direction bool
 
 func (d Direction) String() string {
@@ -34,16 +81,66 @@ const (
 	DirectionUp   = Direction(true)
 )
 
+// The templates are compiled in with go-bindata, rather than go:embed, which
+// needs Go 1.16, while goose still builds with Go 1.9.
 //go:generate sh -c "go get github.com/jteeuwen/go-bindata/go-bindata && go-bindata -pkg goose -o templates.go -nometadata -nocompress ./templates && gofmt -w templates.go"
+
 var goMigrationDriverTemplate = template.Must(template.New("").Parse(string(_templatesMigrationMainGoTmpl)))
-var goMigrationTemplate = template.Must(template.New("").Parse(string(_templatesMigrationGoTmpl)))
-var sqlMigrationTemplate = template.Must(template.New("").Parse(string(_templatesMigrationSqlTmpl)))
+
+// the name of the template new migrations are created from by default
+const defaultTemplateName = "default"
+
+// migrationTemplates holds the templates for new migrations, by name and
+// then migration type. See RegisterMigrationTemplate.
+var migrationTemplates = map[string]map[string]*template.Template{
+	defaultTemplateName: {
+		"go":  template.Must(template.New("").Parse(string(_templatesMigrationGoTmpl))),
+		"sql": template.Must(template.New("").Parse(string(_templatesMigrationSqlTmpl))),
+	},
+	"index": {
+		"sql": template.Must(template.New("").Parse(string(_templatesMigrationIndexSqlTmpl))),
+	},
+	"data": {
+		"sql": template.Must(template.New("").Parse(string(_templatesMigrationDataSqlTmpl))),
+	},
+}
+
+// RegisterMigrationTemplate adds a named template for new migrations of the
+// given type, "sql" or "go", replacing any of the same name, for use with
+// CreateMigrationFromNamedTemplate. The template is executed with the new
+// migration's version. It isn't safe to call concurrently with creating
+// migrations.
+func RegisterMigrationTemplate(name, migrationType string, tmpl *template.Template) {
+	if migrationTemplates[name] == nil {
+		migrationTemplates[name] = map[string]*template.Template{}
+	}
+	migrationTemplates[name][migrationType] = tmpl
+}
 
 type Migration struct {
 	Version   int64
 	IsApplied bool
 	TStamp    time.Time
 	Source    string // path to .go or .sql script
+	Name      string // file name of the script, as recorded in the DB
+	Checksum  string // sha256 of the script when it was last applied or rolled back
+	Actor     string // who last applied or rolled back the migration, see DBConf.Actor
+	ActorHost string // the host it was last applied or rolled back from
+
+	// OutOfOrder is set by MigrationStatus for applied migrations which
+	// were applied after a migration with a later version, e.g. with
+	// DBConf.AllowMissing.
+	OutOfOrder bool
+}
+
+// Type returns the type of the migration, "sql" or "go", from the extension
+// of its Source, taking into account RegisterMigrationExtension. It's
+// "unknown" if the migration's file no longer exists.
+func (m *Migration) Type() string {
+	if m.Source == "" {
+		return "unknown"
+	}
+	return strings.TrimPrefix(migrationExt(m.Source), ".")
 }
 
 type migrationSorter []*Migration
@@ -54,44 +151,285 @@ func (ms migrationSorter) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
 func (ms migrationSorter) Less(i, j int) bool { return ms[i].Version < ms[j].Version }
 
 func RunMigrations(conf *DBConf, migrationsDir string, target int64) (err error) {
-	db, err := OpenDBFromDBConf(conf)
+	s, err := NewSession(conf)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
+	defer s.Close()
 
-	return RunMigrationsOnDb(conf, migrationsDir, target, db)
+	return RunMigrationsOnDb(conf, migrationsDir, target, s.DB)
 }
 
 // Runs migration on a specific database instance.
 func RunMigrationsOnDb(conf *DBConf, migrationsDir string, target int64, db *sql.DB) (err error) {
-	//TODO get rid of migrationsDir, it's already in conf.MigrationsDir
-	current, err := EnsureDBVersion(conf, db)
+	return RunMigrationsContext(context.Background(), conf, migrationsDir, target, db)
+}
+
+// RunMigrationsContext runs migrations on a specific database instance.
+// Cancelling ctx aborts the migration in progress, and the returned error
+// will be ctx.Err().
+func RunMigrationsContext(ctx context.Context, conf *DBConf, migrationsDir string, target int64, db *sql.DB) error {
+	_, err := RunMigrationsWithResult(ctx, conf, migrationsDir, target, db)
+	return err
+}
+
+// MigrationResult describes what a call to RunMigrationsWithResult did.
+type MigrationResult struct {
+	Direction Direction
+	// Migrations are those applied, or rolled back, in the order they ran.
+	// Nothing is run in a dry run.
+	Migrations []*Migration
+	// Version is the DB version afterwards. Without versioning, it's the
+	// latest version applied.
+	Version int64
+	// Failed are the migrations which failed, if migrating failed because
+	// of a migration: the one migrating stopped at or, with
+	// DBConf.ContinueOnError, each one which failed to roll back.
+	Failed []*Migration
+	// Remaining are the migrations which were to be run, in order, but
+	// weren't, as migrating failed. With DBConf.SingleTransaction, they
+	// include those rolled back with the failed one.
+	Remaining []*Migration
+}
+
+// RunMigrationsWithResult is like RunMigrationsContext, but also reports the
+// migrations which ran. If migrating fails, the result holds the migrations
+// which ran before the failure.
+func RunMigrationsWithResult(ctx context.Context, conf *DBConf, migrationsDir string, target int64, db *sql.DB) (*MigrationResult, error) {
+	return runMigrationsWithResult(ctx, conf, migrationsDir, target, db, false)
+}
+
+// runMigrationsWithResult is RunMigrationsWithResult. With upOnly, the DB
+// is left as it is if it's already after target, rather than migrated down.
+func runMigrationsWithResult(ctx context.Context, conf *DBConf, migrationsDir string, target int64, db *sql.DB, upOnly bool) (*MigrationResult, error) {
+	res := &MigrationResult{Direction: DirectionUp}
+	if conf.LogFile == "" || conf.DryRun {
+		err := runMigrations(ctx, conf, migrationsDir, target, db, upOnly, res)
+		return res, err
+	}
+
+	l := startRunLog(conf)
+	err := runMigrations(ctx, conf, migrationsDir, target, db, upOnly, res)
+	if e := l.finish(conf, target, res, err); e != nil && err == nil {
+		err = fmt.Errorf("writing the log file: %s", e)
+	}
+	return res, err
+}
+
+// EnsureMigrated opens the DB of conf, and applies every pending migration
+// in conf.MigrationsDir, up to the most recent. It's meant to be called when
+// an application starts: it does nothing if the DB is already migrated, or
+// has no migrations, and never rolls migrations back, e.g. if a newer
+// version of the application has already migrated the DB further. Unless
+// conf.NoLock is set, the DB is locked while migrating, so it's safe for
+// several instances of the application to call it at once.
+func EnsureMigrated(conf *DBConf) error {
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	db, err := OpenDBFromDBConf(conf)
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 
-	migrations, err := CollectMigrations(migrationsDir)
+	return EnsureMigratedOnDb(context.Background(), conf, db)
+}
+
+// EnsureMigratedOnDb is EnsureMigrated for a DB opened by the caller, e.g.
+// with a DBConf from NewDBConfForDB.
+func EnsureMigratedOnDb(ctx context.Context, conf *DBConf, db *sql.DB) error {
+	if conf.MigrationsDir == "" {
+		return errors.New("invalid DBConf: MigrationsDir is not set")
+	}
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+	target := migrations[len(migrations)-1].Version
+
+	// a DB migrated further by a newer release is left as it is
+	econf := *conf
+	econf.AllowAhead = true
+	_, err = runMigrationsWithResult(ctx, &econf, econf.MigrationsDir, target, db, true)
+	return err
+}
+
+func runMigrations(ctx context.Context, conf *DBConf, migrationsDir string, target int64, db *sql.DB, upOnly bool, res *MigrationResult) (err error) {
+	//TODO get rid of migrationsDir, it's already in conf.MigrationsDir
+	if err := conf.validateMigrate(); err != nil {
+		return err
+	}
+
+	if !conf.NoLock {
+		var unlock func() error
+		if unlock, err = lockDB(ctx, conf, db); err != nil {
+			return err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	if conf.NoVersioning {
+		return runUnversionedMigrations(ctx, conf, migrationsDir, target, db, res)
+	}
+
+	var current int64
+	if conf.DryRun {
+		// a pristine DB is at version 0, but don't create the version table
+		if current, err = dbVersion(ctx, conf, db); err == ErrTableDoesNotExist {
+			err = nil
+		}
+	} else {
+		current, err = ensureDBVersion(ctx, conf, db)
+	}
 	if err != nil {
 		return err
 	}
 
-	if err := getMigrationsStatus(conf, db, migrations); err != nil {
+	res.Version = current
+	plan, excluded, err := planMigrations(ctx, conf, migrationsDir, current, target, db)
+	if err != nil {
 		return err
 	}
+	direction := plan.Direction
+	if direction == DirectionDown && upOnly {
+		conf.logger().Printf("goose: the DB is already at version %d, after the most recent migration %d, leaving it as it is\n", current, target)
+		return nil
+	}
+	res.Direction = direction
+
+	out := conf.logger()
+
+	printExcluded(out, excluded)
+	ms := filterMigrationType(out, conf, plan.Migrations)
+
+	if len(ms) == 0 {
+		if conf.JSON && !conf.DryRun {
+			printSummary(out, conf, direction, target, 0, 0, nil)
+		} else {
+			out.Printf("goose: no migrations to run. current version: %d, target: %d\n", current, target)
+		}
+		return nil
+	}
+
+	if conf.DryRun {
+		out.Printf("goose: dry run, current version: %d, target: %d\n", current, target)
+	} else if !conf.JSON {
+		out.Printf("goose: migrating db, current version: %d, target: %d\n", current, target)
+	}
+
+	err = applyMigrations(ctx, conf, db, ms, direction, target, res)
+	if len(res.Migrations) > 0 {
+		if v, e := dbVersion(ctx, conf, db); e == nil {
+			res.Version = v
+		} else if err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// MigrationPlan is what migrating the DB to a target version involves.
+type MigrationPlan struct {
+	// Current is the DB version.
+	Current   int64
+	Target    int64
+	Direction Direction
+	// Migrations are those which would be applied, or rolled back, in the
+	// order they'd run.
+	Migrations []*Migration
+}
+
+// PlanMigrations returns what RunMigrationsOnDb would do to migrate db to
+// target, without migrating it. The DB is only read, so the version table
+// isn't created, and it isn't locked. Excluded migrations, and those left
+// out by DBConf.MigrationType, are reported as they would be by a run.
+func PlanMigrations(conf *DBConf, db *sql.DB, target int64) (*MigrationPlan, error) {
+	ctx := context.Background()
+	if err := conf.validateMigrate(); err != nil {
+		return nil, err
+	}
+	if conf.NoVersioning {
+		return nil, errors.New("can't plan migrations without versioning")
+	}
+
+	// a pristine DB is at version 0
+	current, err := dbVersion(ctx, conf, db)
+	if err == ErrTableDoesNotExist {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plan, excluded, err := planMigrations(ctx, conf, conf.MigrationsDir, current, target, db)
+	if err != nil {
+		return nil, err
+	}
+	out := conf.logger()
+	printExcluded(out, excluded)
+	plan.Migrations = filterMigrationType(out, conf, plan.Migrations)
+	return plan, nil
+}
+
+// planMigrations works out the migrations to run, in order, to migrate db
+// from current to target, also returning those skipped as excluded.
+func planMigrations(ctx context.Context, conf *DBConf, migrationsDir string, current, target int64, db *sql.DB) (*MigrationPlan, []*Migration, error) {
+	migrations, err := CollectMigrations(migrationsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	missing, err := getMigrationsStatus(ctx, conf, db, migrations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !conf.AllowAhead && !conf.OutOfOrder {
+		if err := checkNotAhead(migrations, missing); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if target != 0 && !hasVersion(migrations, target) && !hasVersion(missing, target) {
+		return nil, nil, fmt.Errorf("target version %d not found in %s", target, migrationsDir)
+	}
+
+	if !conf.SkipVerify {
+		if err := verifyChecksums(migrations); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	direction := DirectionUp
-	if target < current {
+	if target < current && !conf.OutOfOrder {
 		direction = DirectionDown
 	}
 
 	var neededMigrations []*Migration
+	var outOfOrder []*Migration
+	var excluded []*Migration
 	for _, m := range migrations {
 		if direction == DirectionUp {
 			if m.Version > target {
 				continue
 			}
-			if m.IsApplied {
+			if m.IsApplied || m.Version < conf.MinVersion {
+				continue
+			}
+			if conf.isExcluded(m.Version) {
+				excluded = append(excluded, m)
+				continue
+			}
+			if m.Version < current && !conf.AllowMissing && !conf.OutOfOrder {
+				outOfOrder = append(outOfOrder, m)
 				continue
 			}
 		} else {
@@ -101,17 +439,23 @@ func RunMigrationsOnDb(conf *DBConf, migrationsDir string, target int64, db *sql
 			if !m.IsApplied {
 				continue
 			}
+			if conf.isExcluded(m.Version) {
+				excluded = append(excluded, m)
+				continue
+			}
 		}
 		neededMigrations = append(neededMigrations, m)
 	}
 
-	if len(neededMigrations) == 0 {
-		fmt.Printf("goose: no migrations to run. current version: %d, target: %d\n", current, target)
-		return nil
+	if len(outOfOrder) > 0 {
+		sort.Sort(migrationSorter(outOfOrder))
+		versions := make([]string, len(outOfOrder))
+		for i, m := range outOfOrder {
+			versions[i] = strconv.FormatInt(m.Version, 10)
+		}
+		return nil, nil, fmt.Errorf("found pending migrations older than the current version %d: %s", current, strings.Join(versions, ", "))
 	}
 
-	fmt.Printf("goose: migrating db, current version: %d, target: %d\n", current, target)
-
 	ms := migrationSorter(neededMigrations)
 	if direction == DirectionUp {
 		sort.Sort(ms)
@@ -119,300 +463,2002 @@ func RunMigrationsOnDb(conf *DBConf, migrationsDir string, target int64, db *sql
 		sort.Sort(sort.Reverse(ms))
 	}
 
-	for _, m := range ms {
-		switch filepath.Ext(m.Source) {
-		case ".go":
-			err = runGoMigration(conf, m.Source, m.Version, direction)
-		case ".sql":
-			err = runSQLMigration(conf, db, m.Source, m.Version, direction)
-		}
+	return &MigrationPlan{Current: current, Target: target, Direction: direction, Migrations: ms}, excluded, nil
+}
 
-		if err != nil {
-			return errors.New(fmt.Sprintf("FAIL %v, quitting migration", err))
+// checkNotAhead returns an error if any of the applied versions missing from
+// the migrations dir is after the most recent migration, as when the DB was
+// migrated on another branch, since migrating it as if it were at the most
+// recent migration could run migrations it has already had the equivalent of.
+func checkNotAhead(migrations, missing []*Migration) error {
+	var latest, ahead int64
+	if len(migrations) > 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+	for _, m := range missing {
+		if m.Version > latest && m.Version > ahead {
+			ahead = m.Version
 		}
-
-		fmt.Println("OK   ", filepath.Base(m.Source))
 	}
-
-	return nil
+	if ahead == 0 {
+		return nil
+	}
+	return fmt.Errorf("database is ahead of migration files (version %d applied, %d on disk)", ahead, latest)
 }
 
-// collect all the valid looking migration scripts in the
-// migrations folder, and key them by version
-func CollectMigrations(dirpath string) (m []*Migration, err error) {
-	// extract the numeric component of each migration,
-	// filter out any uninteresting files,
-	// and ensure we only have one file per migration version.
-	filepath.Walk(dirpath, func(name string, info os.FileInfo, err error) error {
+// runUnversionedMigrations applies every migration up to target, for
+// DBConf.NoVersioning. The version table is neither read nor written, so to
+// avoid reapplying migrations to a DB which is tracking its version, it's an
+// error for the version table to exist.
+func runUnversionedMigrations(ctx context.Context, conf *DBConf, migrationsDir string, target int64, db *sql.DB, res *MigrationResult) error {
+	exists, err := conf.Driver.Dialect.tableExists(ctx, db, conf.versionTable())
+	if err != nil {
+		return fmt.Errorf("checking for the version table: %s", err)
+	}
+	if exists {
+		return fmt.Errorf("%s exists, refusing to migrate a versioned db without versioning", conf.versionTable())
+	}
 
-		if v, e := NumericComponent(name); e == nil {
+	migrations, err := CollectMigrations(migrationsDir)
+	if err != nil {
+		return err
+	}
 
-			for _, g := range m {
-				if v == g.Version {
-					log.Fatalf("more than one file specifies the migration for version %d (%s and %s)",
-						v, g.Source, filepath.Join(dirpath, name))
-				}
-			}
+	if target != 0 && !hasVersion(migrations, target) {
+		return fmt.Errorf("target version %d not found in %s", target, migrationsDir)
+	}
 
-			m = append(m, &Migration{Version: v, Source: name})
+	var ms []*Migration
+	var excluded []*Migration
+	for _, m := range migrations {
+		if m.Version > target {
+			continue
 		}
+		if conf.isExcluded(m.Version) {
+			excluded = append(excluded, m)
+			continue
+		}
+		ms = append(ms, m)
+	}
 
-		return nil
-	})
-
-	return m, nil
-}
+	out := conf.logger()
 
-// look for migration scripts with names in the form:
-//  XXX_descriptivename.ext
-// where XXX specifies the version number
-// and ext specifies the type of migration
-func NumericComponent(name string) (int64, error) {
-	base := filepath.Base(name)
+	printExcluded(out, excluded)
+	ms = filterMigrationType(out, conf, ms)
 
-	if ext := filepath.Ext(base); ext != ".go" && ext != ".sql" {
-		return 0, errors.New("not a recognized migration file type")
+	if len(ms) == 0 {
+		if conf.JSON && !conf.DryRun {
+			printSummary(out, conf, DirectionUp, target, 0, 0, nil)
+		} else {
+			out.Printf("goose: no migrations to run. target: %d\n", target)
+		}
+		return nil
 	}
 
-	idx := strings.Index(base, "_")
-	if idx < 0 {
-		return 0, errors.New("no separator found")
+	if conf.DryRun {
+		out.Printf("goose: dry run without versioning, target: %d\n", target)
+	} else if !conf.JSON {
+		out.Printf("goose: migrating db without versioning, target: %d\n", target)
 	}
 
-	n, e := strconv.ParseInt(base[:idx], 10, 64)
-	if e == nil && n <= 0 {
-		return 0, errors.New("migration IDs must be greater than zero")
+	// CollectMigrations has already sorted them
+	err = applyMigrations(ctx, conf, db, ms, DirectionUp, target, res)
+	if n := len(res.Migrations); n > 0 {
+		res.Version = res.Migrations[n-1].Version
 	}
+	return err
+}
 
-	return n, e
+// printExcluded reports the migrations skipped because of
+// DBConf.ExcludeVersions.
+func printExcluded(out Logger, excluded []*Migration) {
+	for _, m := range excluded {
+		out.Printf("goose: skipping excluded migration %s\n", filepath.Base(m.Source))
+	}
 }
 
-func getMigrationsStatus(conf *DBConf, db *sql.DB, migrations []*Migration) error {
-	rows, err := conf.Driver.Dialect.dbVersionQuery(db)
-	if err != nil {
-		if err == ErrTableDoesNotExist {
-			for _, m := range migrations {
-				m.IsApplied = false
-			}
-			return nil
+// filterMigrationType returns the migrations, in the order they're to be
+// run, before the first which isn't of DBConf.MigrationType. The rest are
+// reported as skipped.
+func filterMigrationType(out Logger, conf *DBConf, ms []*Migration) []*Migration {
+	if conf.MigrationType == "" {
+		return ms
+	}
+	for i, m := range ms {
+		if migrationExt(m.Source) == "."+conf.MigrationType {
+			continue
 		}
-		return fmt.Errorf("getting db version: %s", err)
+		out.Printf("goose: skipping %s, only %s migrations are being run\n", filepath.Base(m.Source), conf.MigrationType)
+		for _, later := range ms[i+1:] {
+			out.Printf("goose: skipping %s, which may depend on %s\n", filepath.Base(later.Source), filepath.Base(m.Source))
+		}
+		return ms[:i]
 	}
-	defer rows.Close()
+	return ms
+}
 
-	mm := map[int64]*Migration{}
-	for _, m := range migrations {
-		mm[m.Version] = m
-		// default to false so if the DB doesn't know about the migration...
-		m.IsApplied = false
+// applyMigrations runs, or with DBConf.DryRun prints, the given migrations
+// in order, migrating towards target. The DBConf's hooks are run around
+// them, unless it's a dry run. The migrations which ran are added to res.
+func applyMigrations(ctx context.Context, conf *DBConf, db *sql.DB, ms []*Migration, direction Direction, target int64, res *MigrationResult) (err error) {
+	out := conf.logger()
+	start := time.Now()
+
+	if !conf.DryRun {
+		// with DBConf.JSON the summary is also reported on failure
+		n := len(res.Migrations)
+		defer func() {
+			printSummary(out, conf, direction, target, len(res.Migrations)-n, time.Since(start), err)
+		}()
+		defer func() {
+			if err != nil {
+				res.Failed, res.Remaining = partialProgress(ms, res.Migrations[n:], err)
+			}
+		}()
 	}
 
-	for rows.Next() {
-		var row Migration
-		if err = rows.Scan(&row.Version, &row.IsApplied, &row.TStamp); err != nil {
-			log.Fatal("error scanning rows:", err)
+	if !goMigrationsSupported && !conf.DryRun {
+		// fail before running any of the migrations
+		for _, m := range ms {
+			if migrationExt(m.Source) == ".go" {
+				return errGoMigrationsUnsupported(m.Source)
+			}
 		}
+	}
 
-		m, ok := mm[row.Version]
-		if !ok {
-			continue
+	if direction == DirectionDown && conf.Protected && !conf.ConfirmDestructive && !conf.DryRun {
+		if err := checkDestructive(conf, ms); err != nil {
+			return err
 		}
-		if !row.TStamp.After(m.TStamp) {
-			// If the migration went up, then down, it'll have multiple rows.
-			// But we only want the newest, so skip this row if it's older.
-			continue
-		}
-		m.IsApplied = row.IsApplied
-		m.TStamp = row.TStamp
 	}
 
-	return nil
-}
-
-// retrieve the current version for this DB.
-// Create and initialize the DB version table if it doesn't exist.
-func EnsureDBVersion(conf *DBConf, db *sql.DB) (int64, error) {
-	rows, err := conf.Driver.Dialect.dbVersionQuery(db)
-	if err != nil {
-		if err == ErrTableDoesNotExist {
-			return 0, createVersionTable(conf, db)
+	if !conf.DryRun {
+		if err := runHook(ctx, conf, "beforeMigrate", conf.BeforeMigrate, direction, target, nil); err != nil {
+			return err
 		}
-		return 0, fmt.Errorf("getting db version: %#v", err)
+		defer func() {
+			// the migrations are already committed, so just report it
+			if e := runHook(ctx, conf, "afterMigrate", conf.AfterMigrate, direction, target, err); e != nil {
+				conf.logger().Printf("goose: %s\n", e)
+			}
+		}()
 	}
-	defer rows.Close()
-
-	// The most recent record for each migration specifies
-	// whether it has been applied or rolled back.
-	// The first version we find that has been applied is the current version.
 
-	toSkip := make([]int64, 0)
+	if conf.SingleTransaction && !conf.DryRun {
+		if err := applyMigrationsInTxn(ctx, conf, db, ms, direction); err != nil {
+			return err
+		}
+		for _, m := range ms {
+			m.IsApplied = direction == DirectionUp
+		}
+		res.Migrations = append(res.Migrations, ms...)
+		return nil
+	}
 
-	for rows.Next() {
-		var row Migration
-		if err = rows.Scan(&row.Version, &row.IsApplied, &row.TStamp); err != nil {
-			log.Fatal("error scanning rows:", err)
+	var failed MigrationErrors
+	for i := 0; i < len(ms); i++ {
+		m := ms[i]
+		if conf.DryRun {
+			if err := printMigration(out, m, direction); err != nil {
+				return err
+			}
+			continue
 		}
 
-		// have we already marked this version to be skipped?
-		skip := false
-		for _, v := range toSkip {
-			if v == row.Version {
-				skip = true
-				break
+		if conf.Parallelism > 1 {
+			group, err := parallelGroup(ms[i:])
+			if err != nil {
+				return err
+			}
+			if len(group) > 1 {
+				if err := applyParallelGroup(ctx, conf, db, group, direction); err != nil {
+					return err
+				}
+				for _, m := range group {
+					m.IsApplied = direction == DirectionUp
+				}
+				res.Migrations = append(res.Migrations, group...)
+				i += len(group) - 1
+				continue
 			}
 		}
 
-		if skip {
-			continue
+		warnEmptyDown(out, m, direction)
+		conf.observeStart(m, direction)
+		migrationStart := time.Now()
+
+		switch migrationExt(m.Source) {
+		case ".go":
+			err = runGoMigration(ctx, conf, m.Source, m.Version, direction)
+		case ".sql":
+			err = runSQLMigration(ctx, conf, db, m.Source, m.Version, direction)
 		}
+		conf.observeEnd(m, direction, time.Since(migrationStart), err)
+		printMigrationResult(out, conf, m, direction, time.Since(migrationStart), err)
 
-		// if version has been applied we're done
-		if row.IsApplied {
-			return row.Version, nil
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			merr := &MigrationError{Version: m.Version, Source: m.Source, Direction: direction, Err: err}
+			if conf.ContinueOnError && direction == DirectionDown {
+				failed = append(failed, merr)
+				continue
+			}
+			return merr
 		}
 
-		// latest version of migration has not been applied.
-		toSkip = append(toSkip, row.Version)
+		m.IsApplied = direction == DirectionUp
+		res.Migrations = append(res.Migrations, m)
 	}
 
-	panic("failure in EnsureDBVersion()")
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
 }
 
-// Create the goose_db_version table
-// and insert the initial 0 value into it
-func createVersionTable(conf *DBConf, db *sql.DB) error {
-	txn, err := db.Begin()
-	if err != nil {
-		return err
+// partialProgress splits the migrations ms, of a run which failed with err,
+// into those which failed, according to err, and the rest of those which
+// didn't run, given those which did.
+func partialProgress(ms, ran []*Migration, err error) (failed, remaining []*Migration) {
+	failedVersions := map[int64]bool{}
+	switch err := err.(type) {
+	case MigrationErrors:
+		for _, e := range err {
+			failedVersions[e.Version] = true
+		}
+	case *MigrationError:
+		failedVersions[err.Version] = true
 	}
 
-	d := conf.Driver.Dialect
-
-	if _, err := txn.Exec(d.createVersionTableSql()); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("creating migration table: %s", err)
+	for _, m := range ms {
+		switch {
+		case failedVersions[m.Version]:
+			failed = append(failed, m)
+		case !hasVersion(ran, m.Version):
+			remaining = append(remaining, m)
+		}
 	}
+	return failed, remaining
+}
 
-	version := 0
-	applied := true
-	if _, err := txn.Exec(d.insertVersionSql(), version, applied); err != nil {
-		txn.Rollback()
-		return fmt.Errorf("inserting first migration: %s", err)
+// applyMigrationsInTxn runs the given SQL migrations, and updates the version
+// table, within a single transaction, for DBConf.SingleTransaction.
+func applyMigrationsInTxn(ctx context.Context, conf *DBConf, db *sql.DB, ms []*Migration, direction Direction) error {
+	if !conf.Capabilities().TransactionalDDL {
+		return fmt.Errorf("migrating in a single transaction isn't supported with the %s driver, whose DDL commits implicitly", conf.Driver.Name)
+	}
+	for _, m := range ms {
+		// go migrations run in their own process, with their own connection
+		if migrationExt(m.Source) != ".sql" {
+			return fmt.Errorf("%s can't be run in a single transaction, only sql migrations can", filepath.Base(m.Source))
+		}
+		noTx, err := sqlNoTransaction(m.Source)
+		if err != nil {
+			return err
+		}
+		if noTx {
+			return fmt.Errorf("%s can't be run in a single transaction, it's annotated with '-- +goose %s'", filepath.Base(m.Source), sqlNoTransactionCmd)
+		}
 	}
 
-	return txn.Commit()
-}
-
-// wrapper for EnsureDBVersion for callers that don't already have
-// their own DB instance
-func GetDBVersion(conf *DBConf) (version int64, err error) {
-	db, err := OpenDBFromDBConf(conf)
+	txn, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return -1, err
+		return fmt.Errorf("db.Begin: %s", err)
 	}
-	defer db.Close()
 
-	version, err = EnsureDBVersion(conf, db)
+	out := conf.logger()
+
+	for _, m := range ms {
+		warnEmptyDown(out, m, direction)
+		conf.observeStart(m, direction)
+		start := time.Now()
+		err = execSQLMigration(ctx, conf, txn, m.Source, m.Version, direction)
+		if err == nil {
+			err = recordMigration(ctx, conf, txn, direction, m.Version, m.Source)
+		}
+		conf.observeEnd(m, direction, time.Since(start), err)
+		printMigrationResult(out, conf, m, direction, time.Since(start), err)
+		if err != nil {
+			txn.Rollback()
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &MigrationError{Version: m.Version, Source: m.Source, Direction: direction, RolledBack: true, Err: err}
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		return fmt.Errorf("committing migrations: %s", err)
+	}
+	return nil
+}
+
+// formatDuration rounds d for reporting how long migrations took.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		d = d.Round(100 * time.Millisecond)
+	case d >= time.Millisecond:
+		d = d.Round(time.Millisecond)
+	default:
+		d = d.Round(time.Microsecond)
+	}
+	return d.String()
+}
+
+// printMigration describes what running the migration would do,
+// without running it.
+func printMigration(out Logger, m *Migration, direction Direction) error {
+	out.Println("DRY  ", filepath.Base(m.Source))
+
+	switch migrationExt(m.Source) {
+	case ".go":
+		out.Printf("    %s(txn)\n", goMigrationFunc(direction, m.Version))
+	case ".sql":
+		r, err := readSQLMigration(m.Source)
+		if err != nil {
+			return err
+		}
+
+		for _, query := range splitSQLStatements(r, direction) {
+			out.Println(strings.TrimSpace(query))
+		}
+	}
+
+	return nil
+}
+
+// lockDB takes the dialect's migration lock on db, waiting for any other
+// goose process to release it first.
+// The returned function releases the lock.
+func lockDB(ctx context.Context, conf *DBConf, db *sql.DB) (func() error, error) {
+	d := conf.Driver.Dialect
+
+	lockCtx := ctx
+	if conf.LockTimeout > 0 {
+		var cancel context.CancelFunc
+		lockCtx, cancel = context.WithTimeout(ctx, conf.LockTimeout)
+		defer cancel()
+	}
+
+	conn, err := d.lockSession(lockCtx, db)
+	if err != nil {
+		if ctx.Err() == nil && (err == context.DeadlineExceeded || lockCtx.Err() == context.DeadlineExceeded) {
+			return nil, fmt.Errorf("could not acquire the migration lock within %s", conf.LockTimeout)
+		}
+		return nil, fmt.Errorf("acquiring migration lock: %s", err)
+	}
+
+	return func() error {
+		if conn == nil {
+			return nil
+		}
+		if err := d.unlockSession(conn); err != nil {
+			return fmt.Errorf("releasing migration lock: %s", err)
+		}
+		return nil
+	}, nil
+}
+
+// collect all the valid looking migration scripts in the
+// migrations folder, and key them by version.
+// dirpath may list several folders, separated by os.PathListSeparator,
+// whose migrations are merged.
+func CollectMigrations(dirpath string) (m []*Migration, err error) {
+	err = WalkMigrations(dirpath, 0, math.MaxInt64, func(mg *Migration) error {
+		m = append(m, mg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WalkMigrations calls fn for each of the migrations in dirpath with a
+// version from min to max, inclusive, in version order, as found by
+// CollectMigrations. Only their versions and paths are kept while walking,
+// so the caller needn't keep every Migration. Walking stops at the first
+// error returned by fn, which is returned.
+func WalkMigrations(dirpath string, min, max int64, fn func(*Migration) error) error {
+	paths, err := readMigrationDir(dirpath)
+	if err != nil {
+		return err
+	}
+
+	// extract the numeric component of each migration,
+	// filter out any uninteresting files,
+	// and ensure we only have one file per migration version.
+	sources := map[int64]string{}
+	var versions []int64
+	for _, name := range paths {
+		v, e := NumericComponent(name)
+		if _, ok := e.(invalidVersionError); ok {
+			return fmt.Errorf("%s: %s", name, e)
+		}
+		if e != nil {
+			continue
+		}
+		if other, ok := sources[v]; ok {
+			return fmt.Errorf("more than one file specifies the migration for version %d (%s and %s)",
+				v, other, name)
+		}
+		sources[v] = name
+		if v >= min && v <= max {
+			versions = append(versions, v)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, v := range versions {
+		if err := fn(&Migration{Version: v, Source: sources[v]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readMigrationDir returns the paths of the files directly within dirpath.
+// Subdirectories aren't descended into, so they may hold fixtures or archived
+// scripts without those being mistaken for migrations, unless the directory
+// is given as dir/..., see RecursiveMigrationsDir.
+//
+// Files matching a pattern in the directory's .gooseignore file are skipped.
+//
+// dirpath may be a list of directories separated by os.PathListSeparator,
+// in which case the files of all of them are returned.
+func readMigrationDir(dirpath string) ([]string, error) {
+	var paths []string
+	for _, dir := range filepath.SplitList(dirpath) {
+		dir, recursive := splitRecursiveDir(dir)
+		var err error
+		paths, err = readMigrationFiles(dir, recursive, paths, map[string]bool{})
+		if os.IsNotExist(err) {
+			// likely a misconfiguration, rather than there being no migrations
+			return nil, fmt.Errorf("migrations directory does not exist: %s", dir)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return paths, nil
+}
+
+// readMigrationFiles appends the paths of the files in dir which aren't
+// ignored by its .gooseignore to paths, and if recursive, those in its
+// subdirectories. The directories of split migrations, named with a version
+// and holding an up.sql, are included like files, rather than searched.
+//
+// dir, and its subdirectories, may be symlinks to directories. They're read
+// through the directories they resolve to, but the paths returned are within
+// dir, as given. seen holds the resolved directories already read, so that
+// each is read once, even if symlinks form a cycle.
+func readMigrationFiles(dir string, recursive bool, paths []string, seen map[string]bool) ([]string, error) {
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	if seen[resolved] {
+		return paths, nil
+	}
+	seen[resolved] = true
+
+	infos, err := ioutil.ReadDir(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	ignore, err := readIgnoreFile(filepath.Join(resolved, ignoreFile))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if info.Name() == ignoreFile || isIgnored(ignore, info.Name()) {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		isDir := info.IsDir()
+		if info.Mode()&os.ModeSymlink != 0 {
+			// ReadDir doesn't follow symlinks, so a symlinked directory
+			// would otherwise be taken for a file
+			if target, err := os.Stat(path); err == nil {
+				isDir = target.IsDir()
+			}
+		}
+		if !isDir {
+			paths = append(paths, path)
+		} else if _, e := NumericComponent(path); e == nil {
+			// a split migration
+			paths = append(paths, path)
+		} else if recursive {
+			if paths, err = readMigrationFiles(path, true, paths, seen); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return paths, nil
+}
+
+// the last element of a migrations directory whose subdirectories are
+// searched too, as in go's package patterns
+const recursiveDirElem = "..."
+
+// splitRecursiveDir strips the trailing /... from dir, reporting whether it
+// was there.
+func splitRecursiveDir(dir string) (string, bool) {
+	if filepath.Base(dir) != recursiveDirElem {
+		return dir, false
+	}
+	return filepath.Dir(dir), true
+}
+
+// CreateMigrationsDir returns the directory new migrations are created in,
+// given dirpath, a directory or a list of them: the first of them, without
+// any /... suffix, or the current directory if dirpath is empty.
+func CreateMigrationsDir(dirpath string) string {
+	dirs := filepath.SplitList(dirpath)
+	if len(dirs) == 0 {
+		return "."
+	}
+	first, _ := splitRecursiveDir(dirs[0])
+	return first
+}
+
+// RecursiveMigrationsDir returns dirpath, a directory or a list of them
+// separated by os.PathListSeparator, with /... appended to each directory
+// so that the migrations in their subdirectories are collected too. Versions
+// must then be unique across all of them.
+func RecursiveMigrationsDir(dirpath string) string {
+	dirs := filepath.SplitList(dirpath)
+	for i, dir := range dirs {
+		if _, ok := splitRecursiveDir(dir); !ok {
+			dirs[i] = filepath.Join(dir, recursiveDirElem)
+		}
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
+
+// the file in a migrations directory listing the files to ignore
+const ignoreFile = ".gooseignore"
+
+// readIgnoreFile returns the glob patterns in the ignore file at path, one
+// per line, skipping blank lines and # comments. A missing file ignores
+// nothing.
+func readIgnoreFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || pattern[0] == '#' {
+			continue
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: line %d: invalid pattern %q", path, n, pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// isIgnored reports whether the file name matches one of the patterns.
+func isIgnored(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// the characters which may separate a migration's version from its name
+const versionSeparators = "_-"
+
+// look for migration scripts with names in the form:
+//  XXX_descriptivename.ext or XXX-descriptivename.ext
+// where XXX specifies the version number
+// and ext specifies the type of migration
+func NumericComponent(name string) (int64, error) {
+	base := filepath.Base(name)
+
+	if ext := migrationExt(name); ext != ".go" && ext != ".sql" {
+		return 0, errors.New("not a recognized migration file type")
+	}
+
+	idx := strings.IndexAny(base, versionSeparators)
+	if idx < 0 {
+		return 0, errors.New("no separator found")
+	}
+
+	prefix := base[:idx]
+	n, e := strconv.ParseInt(prefix, 10, 64)
+	if e != nil {
+		if prefix != "" && strings.Trim(prefix, "0123456789") == "" {
+			return 0, invalidVersionError(fmt.Sprintf("version %s is too large, the maximum is %d", prefix, int64(math.MaxInt64)))
+		}
+		return 0, e
+	}
+	if n <= 0 {
+		return 0, errors.New("migration IDs must be greater than zero")
+	}
+
+	return n, nil
+}
+
+// invalidVersionError is returned by NumericComponent for a file named like
+// a migration, with a version of digits too large to be a valid version, so
+// that it's reported rather than skipped as not being a migration.
+type invalidVersionError string
+
+func (e invalidVersionError) Error() string {
+	return string(e)
+}
+
+// MigrationStatus returns all the migrations in conf.MigrationsDir, sorted by
+// version, with IsApplied and TStamp populated from the DB.
+//
+// Migrations which are applied in the DB but whose script no longer exists
+// are included too, with an empty Source.
+func MigrationStatus(conf *DBConf, db *sql.DB) ([]*Migration, error) {
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	missing, err := getMigrationsStatus(context.Background(), conf, db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations = append(migrations, missing...)
+	sort.Sort(migrationSorter(migrations))
+
+	return migrations, nil
+}
+
+// MigrationStatusInAppliedOrder is like MigrationStatus, but lists the
+// applied migrations in the order they were applied, which differs from
+// their version order if they were applied out of order, followed by the
+// pending migrations.
+func MigrationStatusInAppliedOrder(conf *DBConf, db *sql.DB) ([]*Migration, error) {
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	missing, recency, err := readMigrationsStatus(context.Background(), conf, db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations = append(migrations, missing...)
+	sort.Sort(migrationSorter(migrations))
+
+	ms := appliedOrder(migrations, recency)
+	for _, m := range migrations {
+		if !m.IsApplied {
+			ms = append(ms, m)
+		}
+	}
+	return ms, nil
+}
+
+// VersionRecords returns every record in the version table as it is, in
+// timestamp order, for debugging its state: the initial version 0 record,
+// each migration's records from it being applied and rolled back, and any
+// records of versions with no migration file. Only Version, IsApplied,
+// TStamp, Name, Checksum, Actor and ActorHost are set. It's nil if the
+// table doesn't exist.
+func VersionRecords(conf *DBConf, db *sql.DB) ([]*Migration, error) {
+	ctx := context.Background()
+	exists, err := conf.Driver.Dialect.tableExists(ctx, db, conf.versionTable())
+	if err != nil {
+		return nil, fmt.Errorf("checking for the version table: %s", err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	rows, err := conf.Driver.Dialect.dbVersionQuery(ctx, db, conf.versionTable())
+	if err != nil {
+		return nil, fmt.Errorf("getting db version: %s", err)
+	}
+	defer rows.Close()
+
+	var records []*Migration
+	for rows.Next() {
+		var row Migration
+		var name, checksum, actor, actorHost sql.NullString
+		if err = rows.Scan(&row.Version, &row.IsApplied, &row.TStamp, &name, &checksum, &actor, &actorHost); err != nil {
+			return nil, fmt.Errorf("error scanning rows: %s", err)
+		}
+		row.Name = name.String
+		row.Checksum = checksum.String
+		row.Actor = actor.String
+		row.ActorHost = actorHost.String
+		records = append(records, &row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getting db version: %s", err)
+	}
+
+	// the rows are newest first, by id, so reverse them to keep records
+	// with the same tstamp in the order they were written
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].TStamp.Before(records[j].TStamp)
+	})
+	return records, nil
+}
+
+func hasVersion(migrations []*Migration, version int64) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// getMigrationsStatus populates the given migrations from the DB.
+// It also returns the migrations which are applied in the DB but aren't in
+// the given list.
+func getMigrationsStatus(ctx context.Context, conf *DBConf, db *sql.DB, migrations []*Migration) ([]*Migration, error) {
+	missing, _, err := readMigrationsStatus(ctx, conf, db, migrations)
+	return missing, err
+}
+
+// readMigrationsStatus is getMigrationsStatus, also returning how recently
+// each version's record was written, 0 being the latest.
+func readMigrationsStatus(ctx context.Context, conf *DBConf, db *sql.DB, migrations []*Migration) ([]*Migration, map[int64]int, error) {
+	exists, err := conf.Driver.Dialect.tableExists(ctx, db, conf.versionTable())
+	if err != nil {
+		return nil, nil, fmt.Errorf("checking for the version table: %s", err)
+	}
+	if !exists {
+		for _, m := range migrations {
+			m.IsApplied = false
+		}
+		return nil, nil, nil
+	}
+
+	rows, err := conf.Driver.Dialect.dbVersionQuery(ctx, db, conf.versionTable())
+	if err != nil {
+		return nil, nil, fmt.Errorf("getting db version: %s", err)
+	}
+	defer rows.Close()
+
+	mm := map[int64]*Migration{}
+	for _, m := range migrations {
+		mm[m.Version] = m
+		// default to false so if the DB doesn't know about the migration...
+		m.IsApplied = false
+	}
+
+	missing := map[int64]*Migration{}
+	// how recently each version's record was written, 0 being the latest
+	recency := map[int64]int{}
+	for n := 0; rows.Next(); n++ {
+		var row Migration
+		var name, checksum, actor, actorHost sql.NullString
+		if err = rows.Scan(&row.Version, &row.IsApplied, &row.TStamp, &name, &checksum, &actor, &actorHost); err != nil {
+			return nil, nil, fmt.Errorf("error scanning rows: %s", err)
+		}
+		row.Name = name.String
+		row.Checksum = checksum.String
+		row.Actor = actor.String
+		row.ActorHost = actorHost.String
+
+		m, ok := mm[row.Version]
+		if !ok {
+			// version 0 is the initial record, not an actual migration
+			if row.Version == 0 {
+				continue
+			}
+			m = &Migration{Version: row.Version}
+			mm[row.Version] = m
+			missing[row.Version] = m
+		}
+		if _, ok := recency[row.Version]; ok {
+			// If the migration went up, then down, it'll have multiple rows.
+			// They're ordered newest first, by id rather than tstamp, which
+			// may be the same for both, so skip all but the first.
+			continue
+		}
+		m.IsApplied = row.IsApplied
+		m.TStamp = row.TStamp
+		m.Name = row.Name
+		m.Checksum = row.Checksum
+		m.Actor = row.Actor
+		m.ActorHost = row.ActorHost
+		recency[row.Version] = n
+	}
+
+	markOutOfOrder(mm, recency)
+
+	var ms []*Migration
+	for _, m := range missing {
+		if m.IsApplied {
+			ms = append(ms, m)
+		}
+	}
+
+	return ms, recency, nil
+}
+
+// appliedOrder returns the applied migrations in the order they were
+// applied, given the recency from readMigrationsStatus.
+func appliedOrder(migrations []*Migration, recency map[int64]int) []*Migration {
+	var applied []*Migration
+	for _, m := range migrations {
+		if m.IsApplied {
+			applied = append(applied, m)
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return recency[applied[i].Version] > recency[applied[j].Version]
+	})
+	return applied
+}
+
+// markOutOfOrder sets OutOfOrder on the applied migrations which were
+// applied more recently than an applied migration with a later version.
+func markOutOfOrder(mm map[int64]*Migration, recency map[int64]int) {
+	var applied []*Migration
+	for _, m := range mm {
+		m.OutOfOrder = false
+		if m.IsApplied {
+			applied = append(applied, m)
+		}
+	}
+	sort.Sort(sort.Reverse(migrationSorter(applied)))
+
+	// the least recent of the later versions, walking down from the latest
+	oldest := -1
+	for _, m := range applied {
+		r := recency[m.Version]
+		if r < oldest {
+			m.OutOfOrder = true
+		}
+		if r > oldest {
+			oldest = r
+		}
+	}
+}
+
+// verifyChecksums ensures that none of the applied migrations has been
+// edited since it was applied.
+// Migrations applied before goose recorded checksums are not checked.
+func verifyChecksums(migrations []*Migration) error {
+	for _, m := range migrations {
+		if !m.IsApplied || m.Checksum == "" {
+			continue
+		}
+
+		checksum, err := fileChecksum(m.Source)
+		if err != nil {
+			return err
+		}
+		if checksum != m.Checksum {
+			return fmt.Errorf("migration %d has been modified since it was applied (%s)", m.Version, filepath.Base(m.Source))
+		}
+	}
+
+	return nil
+}
+
+// fileChecksum returns the hex encoded sha256 of the file's contents,
+// decompressed if it's gzipped, so that compressing an applied migration
+// doesn't count as modifying it.
+func fileChecksum(path string) (string, error) {
+	f, err := openMigration(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// retrieve the current version for this DB.
+// Create and initialize the DB version table if it doesn't exist.
+func EnsureDBVersion(conf *DBConf, db *sql.DB) (int64, error) {
+	return ensureDBVersion(context.Background(), conf, db)
+}
+
+func ensureDBVersion(ctx context.Context, conf *DBConf, db *sql.DB) (int64, error) {
+	if err := upgradeVersionTable(ctx, conf, db); err != nil {
+		return 0, err
+	}
+
+	version, err := dbVersion(ctx, conf, db)
+	if err == ErrTableDoesNotExist {
+		version, err = 0, createVersionTable(ctx, conf, db)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if conf.UpsertVersions {
+		if err := uniqueVersions(ctx, conf, db); err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// uniqueVersions removes all but the latest row for each version from the
+// version table, and adds the unique index upserting versions relies on.
+func uniqueVersions(ctx context.Context, conf *DBConf, db *sql.DB) error {
+	table := conf.versionTable()
+	if conf.Driver.Dialect.upsertVersionSql(table) == "" {
+		return errors.New("upserting versions isn't supported by this dialect")
+	}
+
+	// the derived table keeps mysql from complaining about selecting from
+	// the table being deleted from
+	quoted := quoteTable(conf.Driver.Dialect, table)
+	_, err := db.ExecContext(ctx, "DELETE FROM "+quoted+" WHERE id NOT IN (SELECT id FROM (SELECT MAX(id) AS id FROM "+quoted+" GROUP BY version_id) AS latest)")
+	if err != nil {
+		return fmt.Errorf("removing old versions: %s", err)
+	}
+
+	if err := conf.Driver.Dialect.addVersionIndex(ctx, db, table); err != nil {
+		return fmt.Errorf("adding version index: %s", err)
+	}
+	return nil
+}
+
+// dbVersion retrieves the current version for this DB, without modifying it.
+// Returns ErrTableDoesNotExist if the DB version table doesn't exist.
+func dbVersion(ctx context.Context, conf *DBConf, db *sql.DB) (int64, error) {
+	exists, err := conf.Driver.Dialect.tableExists(ctx, db, conf.versionTable())
+	if err != nil {
+		return 0, fmt.Errorf("checking for the version table: %s", err)
+	}
+	if !exists {
+		return 0, ErrTableDoesNotExist
+	}
+
+	// tables created by very old versions of goose may not have an id
+	if q := conf.Driver.Dialect.currentVersionSql(conf.versionTable()); q != "" && hasVersionColumn(ctx, db, quoteTable(conf.Driver.Dialect, conf.versionTable()), "id") {
+		var version int64
+		switch err := db.QueryRowContext(ctx, q).Scan(&version); err {
+		case nil:
+			return version, nil
+		case sql.ErrNoRows:
+			// everything has been rolled back
+			return 0, nil
+		default:
+			return 0, fmt.Errorf("getting db version: %s", err)
+		}
+	}
+
+	rows, err := conf.Driver.Dialect.dbVersionQuery(ctx, db, conf.versionTable())
+	if err != nil {
+		return 0, fmt.Errorf("getting db version: %s", err)
+	}
+	defer rows.Close()
+
+	// The most recent record for each migration specifies
+	// whether it has been applied or rolled back.
+	// The highest version that has been applied is the current version,
+	// even if a lower one was applied after it.
+
+	seen := map[int64]bool{}
+	var current int64
+
+	for rows.Next() {
+		var row Migration
+		var name, checksum, actor, actorHost sql.NullString
+		if err = rows.Scan(&row.Version, &row.IsApplied, &row.TStamp, &name, &checksum, &actor, &actorHost); err != nil {
+			return 0, fmt.Errorf("error scanning rows: %s", err)
+		}
+
+		// only the most recent record counts
+		if seen[row.Version] {
+			continue
+		}
+		seen[row.Version] = true
+
+		if row.IsApplied && row.Version > current {
+			current = row.Version
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("getting db version: %s", err)
+	}
+
+	// 0 if everything has been rolled back, even the initial 0 record if
+	// it's been removed.
+	return current, nil
+}
+
+// CreateVersionTableSql returns the statement creating the goose_db_version
+// table for the configured dialect and schema, for creating the table by
+// hand. goose treats an empty table as being at version 0.
+func CreateVersionTableSql(conf *DBConf) string {
+	return conf.Driver.Dialect.createVersionTableSql(conf.versionTable())
+}
+
+// createVersionTable creates the goose_db_version table and, unless
+// conf.NoInitialVersion is set, inserts the initial 0 value into it.
+func createVersionTable(ctx context.Context, conf *DBConf, db *sql.DB) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	d := conf.Driver.Dialect
+
+	if _, err := txn.ExecContext(ctx, d.createVersionTableSql(conf.versionTable())); err != nil {
+		txn.Rollback()
+		// another process may have just created it
+		if exists, e := d.tableExists(ctx, db, conf.versionTable()); e == nil && exists {
+			return nil
+		}
+		return fmt.Errorf("creating migration table: %s", err)
+	}
+
+	if !conf.NoInitialVersion {
+		version := 0
+		if _, err := txn.ExecContext(ctx, conf.rebind(d.insertVersionSql(conf.versionTable())), version, d.appliedValue(true), nil, nil, nil, nil, nil); err != nil {
+			txn.Rollback()
+			return fmt.Errorf("inserting first migration: %s", err)
+		}
+	}
+
+	return txn.Commit()
+}
+
+// upgradeVersionTable adds any columns missing from a goose_db_version table
+// created by an older version of goose.
+func upgradeVersionTable(ctx context.Context, conf *DBConf, db *sql.DB) error {
+	table := conf.versionTable()
+	columns := []struct {
+		name  string
+		alter string
+	}{
+		{"checksum", conf.Driver.Dialect.addChecksumColumnSql(table)},
+		{"name", conf.Driver.Dialect.addNameColumnSql(table)},
+		{"direction", conf.Driver.Dialect.addDirectionColumnSql(table)},
+		{"actor", conf.Driver.Dialect.addActorColumnSql(table)},
+		{"actor_host", conf.Driver.Dialect.addActorHostColumnSql(table)},
+	}
+
+	exists, err := conf.Driver.Dialect.tableExists(ctx, db, table)
+	if err != nil {
+		return fmt.Errorf("checking for the version table: %s", err)
+	}
+	if !exists {
+		// the table doesn't exist yet, it'll be created with every column
+		return nil
+	}
+
+	for _, c := range columns {
+		if hasVersionColumn(ctx, db, quoteTable(conf.Driver.Dialect, table), c.name) {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, c.alter); err != nil {
+			return fmt.Errorf("adding %s column to %s: %s", c.name, table, err)
+		}
+	}
+
+	return nil
+}
+
+// hasVersionColumn reports whether the goose_db_version table, quoted with
+// quoteTable, can be queried for the given column.
+func hasVersionColumn(ctx context.Context, db *sql.DB, table, column string) bool {
+	rows, err := db.QueryContext(ctx, "SELECT "+column+" FROM "+table+" WHERE 1=0")
+	if err != nil {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// wrapper for EnsureDBVersion for callers that don't already have
+// their own DB instance
+func GetDBVersion(conf *DBConf) (version int64, err error) {
+	s, err := NewSession(conf)
+	if err != nil {
+		return -1, err
+	}
+	defer s.Close()
+
+	version, err = s.Version()
+	if err != nil {
+		return -1, err
+	}
+
+	return version, nil
+}
+
+func GetPreviousDBVersion(dirpath string, version int64) (previous int64, err error) {
+	previous = -1
+	sawGivenVersion := false
+
+	paths, err := readMigrationDir(dirpath)
+	if err != nil {
+		return previous, err
+	}
+
+	for _, name := range paths {
+		if v, e := NumericComponent(name); e == nil {
+			if v > previous && v < version {
+				previous = v
+			}
+			if v == version {
+				sawGivenVersion = true
+			}
+		}
+	}
+
+	if previous == -1 {
+		if sawGivenVersion {
+			// the given version is (likely) valid but we didn't find
+			// anything before it.
+			// 'previous' must reflect that no migrations have been applied.
+			previous = 0
+		} else {
+			err = ErrNoPreviousVersion
+		}
+	}
+
+	return
+}
+
+// GetPreviousDBVersionInRange is like GetPreviousDBVersion, but only
+// considers the migrations in dirpath from min to max, inclusive, as
+// WalkMigrations does. It's 0 if the given version is the first of them,
+// and ErrNoPreviousVersion if it isn't among them.
+func GetPreviousDBVersionInRange(dirpath string, version, min, max int64) (previous int64, err error) {
+	sawGivenVersion := false
+
+	err = WalkMigrations(dirpath, min, max, func(m *Migration) error {
+		if m.Version < version {
+			previous = m.Version
+		}
+		if m.Version == version {
+			sawGivenVersion = true
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	if !sawGivenVersion {
+		return -1, ErrNoPreviousVersion
+	}
+	return previous, nil
+}
+
+// GetNextDBVersion returns the lowest version of the migrations in dirpath
+// after the given one, or ErrNoNextVersion if there are none.
+func GetNextDBVersion(dirpath string, version int64) (next int64, err error) {
+	paths, err := readMigrationDir(dirpath)
+	if err != nil {
+		return -1, err
+	}
+
+	next = -1
+	for _, name := range paths {
+		if v, e := NumericComponent(name); e == nil {
+			if v > version && (next == -1 || v < next) {
+				next = v
+			}
+		}
+	}
+
+	if next == -1 {
+		return -1, ErrNoNextVersion
+	}
+	return next, nil
+}
+
+// GetPreviousAppliedVersion returns the highest version below the given one
+// which is applied in the DB, or 0 if none are. Unlike GetPreviousDBVersion,
+// it reads the version table rather than the migration files, so versions
+// which were never applied are skipped over.
+func GetPreviousAppliedVersion(conf *DBConf, db *sql.DB, version int64) (int64, error) {
+	if version <= 0 {
+		return -1, ErrNoPreviousVersion
+	}
+
+	// without any migrations given, every applied version is returned
+	applied, _, err := readMigrationsStatus(context.Background(), conf, db, nil)
+	if err != nil {
+		return -1, err
+	}
+
+	var previous int64
+	for _, m := range applied {
+		if m.Version > previous && m.Version < version {
+			previous = m.Version
+		}
+	}
+	return previous, nil
+}
+
+// helper to identify the most recent possible version
+// within a folder of migration scripts
+func GetMostRecentDBVersion(dirpath string) (version int64, err error) {
+	version = -1
+
+	paths, err := readMigrationDir(dirpath)
+	if err != nil {
+		return version, err
+	}
+
+	for _, name := range paths {
+		if v, e := NumericComponent(name); e == nil {
+			if v > version {
+				version = v
+			}
+		}
+	}
+
+	if version == -1 {
+		err = errors.New("no valid version found")
+	}
+
+	return
+}
+
+// GetMostRecentDBVersionInRange is like GetMostRecentDBVersion, but only
+// considers the migrations in dirpath from min to max, inclusive, as
+// WalkMigrations does.
+func GetMostRecentDBVersionInRange(dirpath string, min, max int64) (version int64, err error) {
+	version = -1
+
+	err = WalkMigrations(dirpath, min, max, func(m *Migration) error {
+		version = m.Version
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	if version == -1 {
+		err = errors.New("no valid version found")
+	}
+
+	return
+}
+
+// CreateMigration writes a new migration named name into dir, versioned with
+// the timestamp t, returning its path and version. An existing migration is
+// never overwritten: if another one is created with the same version at the
+// same time, e.g. by another goose process, it fails, and may be retried.
+func CreateMigration(name, migrationType, dir string, t time.Time) (path string, version int64, err error) {
+	return CreateMigrationFromTemplates(name, migrationType, dir, "", t)
+}
+
+// CreateMigrationFromTemplates is like CreateMigration, but uses
+// migration.sql.tmpl or migration.go.tmpl from templatesDir, if present,
+// instead of the default templates.
+func CreateMigrationFromTemplates(name, migrationType, dir, templatesDir string, t time.Time) (path string, version int64, err error) {
+	return CreateMigrationFromNamedTemplate(name, migrationType, dir, templatesDir, defaultTemplateName, t)
+}
+
+// CreateMigrationFromNamedTemplate is like CreateMigrationFromTemplates,
+// but uses the template with the given name: migration.<name>.<type>.tmpl
+// from templatesDir, if present, or else one registered with
+// RegisterMigrationTemplate. goose has "default", "index" and "data"
+// templates, the latter two only for SQL migrations.
+func CreateMigrationFromNamedTemplate(name, migrationType, dir, templatesDir, templateName string, t time.Time) (path string, version int64, err error) {
+	return CreateMigrationWithVersionFormat(name, migrationType, dir, templatesDir, templateName, "", t)
+}
+
+// CreateMigrationWithVersionFormat is like CreateMigrationFromNamedTemplate,
+// but versions the migration with the given format of t: "timestamp", the
+// default, for 20060102150405, "unix" for seconds since the Unix epoch or
+// "unixmilli" for milliseconds. If a migration in dir already has that
+// version, t is bumped by a second, or a millisecond, until it's unique.
+func CreateMigrationWithVersionFormat(name, migrationType, dir, templatesDir, templateName, versionFormat string, t time.Time) (path string, version int64, err error) {
+	paths, err := readMigrationDir(dir)
+	if err != nil {
+		return "", 0, err
+	}
+	existing := map[string]bool{}
+	for _, path := range paths {
+		if v, err := NumericComponent(path); err == nil {
+			existing[strconv.FormatInt(v, 10)] = true
+		}
+	}
+
+	step := time.Second
+	if versionFormat == "unixmilli" {
+		step = time.Millisecond
+	}
+	for {
+		version, err := timestampVersion(versionFormat, t)
+		if err != nil {
+			return "", 0, err
+		}
+		if !existing[version] {
+			return createMigration(name, migrationType, dir, templatesDir, templateName, version, version)
+		}
+		t = t.Add(step)
+	}
+}
+
+// CreateMigrationContent renders a new migration as CreateMigration does,
+// but returns its file name and content rather than writing it to a
+// migrations folder.
+func CreateMigrationContent(name, migrationType string, t time.Time) (filename string, content []byte, err error) {
+	timestamp := t.Format(timestampFormat)
+	return migrationContent(name, migrationType, "", defaultTemplateName, timestamp, timestamp)
+}
+
+// CreateSequentialMigration is like CreateMigration, but numbers the migration
+// sequentially (00001, 00002, ...) following the highest sequentially numbered
+// migration in dir.
+func CreateSequentialMigration(name, migrationType, dir string) (path string, version int64, err error) {
+	return CreateSequentialMigrationFromTemplates(name, migrationType, dir, "")
+}
+
+// CreateSequentialMigrationFromTemplates is like CreateSequentialMigration,
+// but uses the templates from templatesDir as CreateMigrationFromTemplates does.
+func CreateSequentialMigrationFromTemplates(name, migrationType, dir, templatesDir string) (path string, version int64, err error) {
+	return CreateSequentialMigrationFromNamedTemplate(name, migrationType, dir, templatesDir, defaultTemplateName)
+}
+
+// CreateSequentialMigrationFromNamedTemplate is like
+// CreateSequentialMigrationFromTemplates, but uses the named template as
+// CreateMigrationFromNamedTemplate does.
+func CreateSequentialMigrationFromNamedTemplate(name, migrationType, dir, templatesDir, templateName string) (path string, version int64, err error) {
+	migrations, err := CollectMigrations(dir)
 	if err != nil {
-		return -1, err
+		return "", 0, err
 	}
 
-	return version, nil
+	next := nextSequentialVersion(migrations)
+	return createMigration(name, migrationType, dir, templatesDir, templateName, fmt.Sprintf(sequentialFormat, next), strconv.FormatInt(next, 10))
 }
 
-func GetPreviousDBVersion(dirpath string, version int64) (previous int64, err error) {
-	previous = -1
-	sawGivenVersion := false
+// createMigration writes the template for a new migration named
+// prefix_name.migrationType into dir.
+// funcVersion is the migration's version as seen in Go function names.
+func createMigration(name, migrationType, dir, templatesDir, templateName, prefix, funcVersion string) (path string, version int64, err error) {
+	version, err = strconv.ParseInt(funcVersion, 10, 64)
+	if err != nil {
+		return "", 0, err
+	}
+	filename, content, err := migrationContent(name, migrationType, templatesDir, templateName, prefix, funcVersion)
+	if err != nil {
+		return "", 0, err
+	}
+
+	path = filepath.Join(CreateMigrationsDir(dir), filename)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return "", 0, fmt.Errorf("migration %s already exists, retry to create it with another version", path)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return "", 0, err
+	}
+	if err := f.Close(); err != nil {
+		return "", 0, err
+	}
 
-	filepath.Walk(dirpath, func(name string, info os.FileInfo, walkerr error) error {
+	// another goose process may have created a migration with the same
+	// version, but a different name, since the versions in dir were read
+	other, err := versionCollision(dir, path)
+	if err == nil && other != "" {
+		err = fmt.Errorf("migration %s has the same version as %s, retry to create it with another version", path, other)
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, version, nil
+}
 
-		if !info.IsDir() {
-			if v, e := NumericComponent(name); e == nil {
-				if v > previous && v < version {
-					previous = v
-				}
-				if v == version {
-					sawGivenVersion = true
-				}
+// versionCollision returns the path of a migration in dir, other than path,
+// with the same version as path, or "" if there isn't one.
+func versionCollision(dir, path string) (string, error) {
+	version, err := NumericComponent(path)
+	if err != nil {
+		return "", err
+	}
+	paths, err := readMigrationDir(dir)
+	if err != nil {
+		return "", err
+	}
+	for _, p := range paths {
+		if v, err := NumericComponent(p); err == nil && v == version && filepath.Clean(p) != filepath.Clean(path) {
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// migrationContent renders the template for a new migration, returning
+// its file name, prefix_name.migrationType, and content.
+func migrationContent(name, migrationType, templatesDir, templateName, prefix, version string) (string, []byte, error) {
+	if migrationType != "go" && migrationType != "sql" {
+		return "", nil, errors.New("migration type must be 'go' or 'sql'")
+	}
+	slug := migrationSlug(name)
+	if slug == "" {
+		return "", nil, fmt.Errorf("invalid migration name %q, it needs a letter or digit", name)
+	}
+
+	tmpl, err := migrationTemplate(migrationType, templatesDir, templateName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, version); err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("%v_%v.%v", prefix, slug, migrationType), buf.Bytes(), nil
+}
+
+// migrationSlug makes the name of a new migration safe for its file name,
+// lowercasing it and replacing each run of characters other than letters and
+// digits, such as spaces and slashes, with an underscore.
+func migrationSlug(name string) string {
+	var b bytes.Buffer
+	sep := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
 			}
+			b.WriteRune(r)
+			sep = false
+			continue
 		}
+		sep = true
+	}
+	return b.String()
+}
 
-		return nil
-	})
+// migrationTemplate returns the named template for new migrations of the
+// given type. One in templatesDir, migration.<type>.tmpl for the default and
+// migration.<name>.<type>.tmpl otherwise, is preferred over a registered one.
+func migrationTemplate(migrationType, templatesDir, templateName string) (*template.Template, error) {
+	if templatesDir != "" {
+		file := "migration." + migrationType + ".tmpl"
+		if templateName != defaultTemplateName {
+			file = "migration." + templateName + "." + migrationType + ".tmpl"
+		}
+		tpath := filepath.Join(templatesDir, file)
+		if _, err := os.Stat(tpath); err == nil {
+			return template.ParseFiles(tpath)
+		}
+	}
 
-	if previous == -1 {
-		if sawGivenVersion {
-			// the given version is (likely) valid but we didn't find
-			// anything before it.
-			// 'previous' must reflect that no migrations have been applied.
-			previous = 0
-		} else {
-			err = ErrNoPreviousVersion
+	if tmpl := migrationTemplates[templateName][migrationType]; tmpl != nil {
+		return tmpl, nil
+	}
+	return nil, fmt.Errorf("no %s migration template named %q", migrationType, templateName)
+}
+
+const (
+	timestampFormat  = "20060102150405"
+	sequentialFormat = "%05d"
+)
+
+// timestampVersion formats t as the version of a new migration, with one of
+// the formats CreateMigrationWithVersionFormat accepts.
+func timestampVersion(versionFormat string, t time.Time) (string, error) {
+	switch versionFormat {
+	case "", "timestamp":
+		return t.Format(timestampFormat), nil
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10), nil
+	case "unixmilli":
+		return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), nil
+	}
+	return "", fmt.Errorf("unknown version format %q, expected timestamp, unix or unixmilli", versionFormat)
+}
+
+// isMalformedTimestamp reports whether the version looks like a timestamp
+// version, having 14 digits from the years 1900 to 2099, but isn't a valid
+// date and time, e.g. because of a typo.
+func isMalformedTimestamp(v int64) bool {
+	s := strconv.FormatInt(v, 10)
+	if len(s) != len(timestampFormat) || !strings.HasPrefix(s, "19") && !strings.HasPrefix(s, "20") {
+		return false
+	}
+	return !isTimestampVersion(v)
+}
+
+// isTimestampVersion reports whether the version looks like one generated by
+// CreateMigration, in any of the version formats, as opposed to a sequential
+// one. Unix versions are taken to be from September 2001 onwards, when Unix
+// time reached 10 digits.
+func isTimestampVersion(v int64) bool {
+	if _, err := time.Parse(timestampFormat, strconv.FormatInt(v, 10)); err == nil {
+		return true
+	}
+	// unix seconds, or milliseconds, with 10 or 13 digits
+	return 1e9 <= v && v < 1e10 || 1e12 <= v && v < 1e13
+}
+
+// nextSequentialVersion returns the version following the highest sequential
+// version among the migrations.
+func nextSequentialVersion(migrations []*Migration) int64 {
+	var max int64
+	for _, m := range migrations {
+		if !isTimestampVersion(m.Version) && m.Version > max {
+			max = m.Version
 		}
 	}
+	return max + 1
+}
 
-	return
+// FixMigrations renames the timestamp numbered migrations in dir so that they
+// follow the sequentially numbered ones, in timestamp order.
+// The Up/Down functions of Go migrations are renamed to match.
+//
+// Renaming migrations which have already been applied will make goose
+// consider them pending, so this is meant to be run before they're applied,
+// or ConvertMigrations used to rewrite the versions recorded for them too.
+func FixMigrations(dir string) error {
+	migrations, err := CollectMigrations(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range sequentialRenumbering(migrations) {
+		if _, err := r.apply(); err != nil {
+			return err
+		}
+		logger.Printf("goose: renamed %s to %s\n", filepath.Base(r.m.Source), r.name)
+	}
+
+	return nil
 }
 
-// helper to identify the most recent possible version
-// within a folder of migration scripts
-func GetMostRecentDBVersion(dirpath string) (version int64, err error) {
-	version = -1
+// renumbering is the new version and file name of a migration.
+type renumbering struct {
+	m       *Migration
+	version int64
+	name    string
+}
+
+// sequentialRenumbering returns the renumbering of each timestamped
+// migration, in order, following on from the latest sequential version.
+func sequentialRenumbering(migrations []*Migration) []renumbering {
+	sort.Sort(migrationSorter(migrations))
 
-	filepath.Walk(dirpath, func(name string, info os.FileInfo, walkerr error) error {
-		if walkerr != nil {
-			return walkerr
+	var rs []renumbering
+	version := nextSequentialVersion(migrations)
+	for _, m := range migrations {
+		if !isTimestampVersion(m.Version) {
+			continue
 		}
 
-		if !info.IsDir() {
-			if v, e := NumericComponent(name); e == nil {
-				if v > version {
-					version = v
-				}
+		base := filepath.Base(m.Source)
+		name := fmt.Sprintf(sequentialFormat, version) + base[strings.IndexAny(base, versionSeparators):]
+		rs = append(rs, renumbering{m: m, version: version, name: name})
+		version++
+	}
+	return rs
+}
+
+// apply renames the migration's file, and the functions of a Go migration,
+// returning the path of the renamed file.
+func (r renumbering) apply() (string, error) {
+	dst := filepath.Join(filepath.Dir(r.m.Source), r.name)
+	if migrationExt(r.m.Source) == ".go" {
+		if err := renameGoMigrationFuncs(r.m.Source, r.m.Version, r.version); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Rename(r.m.Source, dst); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// renameGoMigrationFuncs rewrites the Up_<from> and Down_<from> functions in
+// the Go migration at path to Up_<to> and Down_<to>.
+func renameGoMigrationFuncs(path string, from, to int64) error {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, prefix := range []string{"Up_", "Down_"} {
+		bs = bytes.Replace(bs,
+			[]byte(fmt.Sprintf("%s%d(", prefix, from)),
+			[]byte(fmt.Sprintf("%s%d(", prefix, to)),
+			-1)
+	}
+
+	return ioutil.WriteFile(path, bs, 0644)
+}
+
+// MarkMigration records the migration with the given version as applied,
+// or rolled back, without running it, e.g. when it was applied by hand.
+// The version must be one of the migrations in conf.MigrationsDir. Nothing
+// is recorded if the migration is already in that state.
+func MarkMigration(conf *DBConf, db *sql.DB, version int64, direction Direction) (err error) {
+	ctx := context.Background()
+	if conf.NoVersioning {
+		return errors.New("can't mark migrations without versioning")
+	}
+
+	if !conf.NoLock {
+		unlock, err := lockDB(ctx, conf, db)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
 			}
+		}()
+	}
+
+	if _, err := ensureDBVersion(ctx, conf, db); err != nil {
+		return err
+	}
+
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	if _, err := getMigrationsStatus(ctx, conf, db, migrations); err != nil {
+		return err
+	}
+
+	var m *Migration
+	for _, mm := range migrations {
+		if mm.Version == version {
+			m = mm
+			break
 		}
+	}
+	if m == nil {
+		return fmt.Errorf("version %d not found in %s", version, conf.MigrationsDir)
+	}
 
+	if m.IsApplied == bool(direction) {
+		conf.logger().Printf("goose: %s is already marked %s\n", filepath.Base(m.Source), direction)
 		return nil
-	})
+	}
 
-	if version == -1 {
-		err = errors.New("no valid version found")
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %s", err)
+	}
+	return finalizeMigration(ctx, conf, txn, direction, m.Version, m.Source)
+}
+
+// ForceMigration runs the migration with the given version in direction,
+// whether or not it's already recorded in that state, and records the
+// result, e.g. to rerun a migration which partially applied once it's been
+// fixed. As goose can't tell what a partially applied migration left behind,
+// forcing it may leave the DB in a state no migration expects. The version
+// must be one of the migrations in conf.MigrationsDir, and as it may have
+// been fixed since it was applied, its checksum isn't verified.
+func ForceMigration(conf *DBConf, db *sql.DB, version int64, direction Direction) (err error) {
+	ctx := context.Background()
+	if conf.NoVersioning {
+		return errors.New("can't force migrations without versioning")
 	}
 
-	return
+	if !conf.NoLock {
+		unlock, err := lockDB(ctx, conf, db)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	if !conf.DryRun {
+		if _, err := ensureDBVersion(ctx, conf, db); err != nil {
+			return err
+		}
+	}
+
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	if _, err := getMigrationsStatus(ctx, conf, db, migrations); err != nil {
+		return err
+	}
+
+	var m *Migration
+	var others []*Migration
+	// the version being migrated to
+	var target int64
+	for _, mm := range migrations {
+		if mm.Version == version {
+			m = mm
+			continue
+		}
+		if mm.Version < version {
+			target = mm.Version
+		}
+		others = append(others, mm)
+	}
+	if m == nil {
+		return fmt.Errorf("version %d not found in %s", version, conf.MigrationsDir)
+	}
+	if direction == DirectionUp {
+		target = m.Version
+	}
+
+	if !conf.SkipVerify {
+		if err := verifyChecksums(others); err != nil {
+			return err
+		}
+	}
+
+	if !conf.JSON {
+		verb := "applying"
+		if direction == DirectionDown {
+			verb = "rolling back"
+		}
+		conf.logger().Printf("goose: forcibly %s %s\n", verb, filepath.Base(m.Source))
+	}
+	return applyMigrations(ctx, conf, db, []*Migration{m}, direction, target, &MigrationResult{})
 }
 
-func CreateMigration(name, migrationType, dir string, t time.Time) (path string, err error) {
-	if migrationType != "go" && migrationType != "sql" {
-		return "", errors.New("migration type must be 'go' or 'sql'")
+// RunMigrationFile runs the SQL migration at path in direction, as an
+// escape hatch for ad hoc operations: it needn't be in conf.MigrationsDir,
+// and is run regardless of the version table. The section for direction
+// must have statements. With record, the migration's version, from its
+// file name, is recorded as it would be by a run, and otherwise the version
+// table is left alone.
+func RunMigrationFile(conf *DBConf, db *sql.DB, path string, direction Direction, record bool) (err error) {
+	ctx := context.Background()
+	name := filepath.Base(path)
+	if migrationExt(path) != ".sql" {
+		return fmt.Errorf("%s: only sql migrations can be run from a file", name)
+	}
+
+	r, err := readSQLMigration(path)
+	if err != nil {
+		return err
+	}
+	stmts, err := parseSQLStatements(r, direction)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	if len(stmts) == 0 {
+		return fmt.Errorf("%s: the %s section has no statements", name, direction)
 	}
 
-	timestamp := t.Format("20060102150405")
-	filename := fmt.Sprintf("%v_%v.%v", timestamp, name, migrationType)
+	var version int64
+	if record {
+		if conf.NoVersioning {
+			return errors.New("can't record migrations without versioning")
+		}
+		if version, err = NumericComponent(path); err != nil {
+			return fmt.Errorf("%s: can't be recorded without a version: %s", name, err)
+		}
+	}
 
-	fpath := filepath.Join(dir, filename)
+	if !conf.NoLock {
+		unlock, err := lockDB(ctx, conf, db)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
 
-	var tmpl *template.Template
-	if migrationType == "sql" {
-		tmpl = sqlMigrationTemplate
-	} else {
-		tmpl = goMigrationTemplate
+	if record {
+		if _, err := ensureDBVersion(ctx, conf, db); err != nil {
+			return err
+		}
 	}
 
-	path, err = writeTemplateToFile(fpath, tmpl, timestamp)
+	// recording is skipped without versioning
+	rconf := *conf
+	rconf.NoVersioning = !record
+	return runSQLMigration(ctx, &rconf, db, path, version, direction)
+}
+
+// RollbackLastApplied rolls back the most recently applied migration. If
+// migrations were applied out of order, e.g. with DBConf.AllowMissing, this
+// may not be the one with the latest version, which rolling back to the
+// GetPreviousDBVersion would roll back instead.
+func RollbackLastApplied(conf *DBConf, db *sql.DB) (err error) {
+	ctx := context.Background()
+	if conf.NoVersioning {
+		return errors.New("can't roll back migrations without versioning")
+	}
 
-	return
+	if !conf.NoLock {
+		unlock, err := lockDB(ctx, conf, db)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	if _, err := ensureDBVersion(ctx, conf, db); err != nil {
+		return err
+	}
+
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	missing, recency, err := readMigrationsStatus(ctx, conf, db, migrations)
+	if err != nil {
+		return err
+	}
+
+	if !conf.SkipVerify {
+		if err := verifyChecksums(migrations); err != nil {
+			return err
+		}
+	}
+
+	applied := appliedOrder(append(migrations, missing...), recency)
+	if len(applied) == 0 {
+		return ErrNoPreviousVersion
+	}
+	m := applied[len(applied)-1]
+	if m.Source == "" {
+		return fmt.Errorf("version %d was applied last, but isn't in %s", m.Version, conf.MigrationsDir)
+	}
+	// the version being rolled back to, in applied order
+	var target int64
+	if len(applied) > 1 {
+		target = applied[len(applied)-2].Version
+	}
+
+	if !conf.JSON {
+		conf.logger().Printf("goose: rolling back the last applied migration, %s\n", filepath.Base(m.Source))
+	}
+	return applyMigrations(ctx, conf, db, []*Migration{m}, DirectionDown, target, &MigrationResult{})
+}
+
+// BaselineDBVersion initializes the version table of a DB whose schema
+// predates goose, recording every migration up to and including baseline as
+// applied, without running them, so that only later migrations are run.
+// baseline must be one of the migrations in conf.MigrationsDir, and the DB
+// must not have any migrations applied yet.
+func BaselineDBVersion(conf *DBConf, db *sql.DB, baseline int64) (err error) {
+	ctx := context.Background()
+	if conf.NoVersioning {
+		return errors.New("can't baseline a db without versioning")
+	}
+
+	if !conf.NoLock {
+		unlock, err := lockDB(ctx, conf, db)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	current, err := ensureDBVersion(ctx, conf, db)
+	if err != nil {
+		return err
+	}
+	if current != 0 {
+		return fmt.Errorf("db is already at version %d, only a db without applied migrations can be baselined", current)
+	}
+
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	if !hasVersion(migrations, baseline) {
+		return fmt.Errorf("baseline version %d not found in %s", baseline, conf.MigrationsDir)
+	}
+
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %s", err)
+	}
+	for _, m := range migrations {
+		if m.Version > baseline {
+			break
+		}
+		if err := recordMigration(ctx, conf, txn, DirectionUp, m.Version, m.Source); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+	return txn.Commit()
 }
 
 // Update the version table for the given migration,
 // and finalize the transaction.
+// No name or checksum is recorded, see FinalizeMigrationWithSource.
 func FinalizeMigration(conf *DBConf, txn *sql.Tx, direction Direction, v int64) error {
-	// XXX: drop goose_db_version table on some minimum version number?
-	stmt := conf.Driver.Dialect.insertVersionSql()
-	if _, err := txn.Exec(stmt, v, bool(direction)); err != nil {
+	return finalizeMigration(context.Background(), conf, txn, direction, v, "")
+}
+
+// FinalizeMigrationWithSource is like FinalizeMigration, but also records
+// the name and checksum of source, the path to the migration script.
+func FinalizeMigrationWithSource(conf *DBConf, txn *sql.Tx, direction Direction, v int64, source string) error {
+	return finalizeMigration(context.Background(), conf, txn, direction, v, source)
+}
+
+func finalizeMigration(ctx context.Context, conf *DBConf, txn *sql.Tx, direction Direction, v int64, source string) error {
+	if err := recordMigration(ctx, conf, txn, direction, v, source); err != nil {
 		txn.Rollback()
 		return err
 	}
 
 	return txn.Commit()
 }
+
+// recordMigration updates the version table for the migration within txn.
+func recordMigration(ctx context.Context, conf *DBConf, txn *sql.Tx, direction Direction, v int64, source string) error {
+	if conf.NoVersioning {
+		return nil
+	}
+
+	// without a source, e.g. from FinalizeMigration, neither is known
+	var name, checksum interface{}
+	if source != "" {
+		sum, err := fileChecksum(source)
+		if err != nil {
+			return err
+		}
+		name, checksum = filepath.Base(source), sum
+	}
+
+	// XXX: drop goose_db_version table on some minimum version number?
+	stmt := conf.Driver.Dialect.insertVersionSql(conf.versionTable())
+	if conf.UpsertVersions {
+		stmt = conf.Driver.Dialect.upsertVersionSql(conf.versionTable())
+	}
+	// is_applied is the migration's state after the operation, and
+	// direction the operation itself, for auditing the history
+	actor, host := conf.actor()
+	_, err := txn.ExecContext(ctx, conf.rebind(stmt), v, conf.Driver.Dialect.appliedValue(bool(direction)), name, checksum, direction.String(), actor, host)
+	return err
+}
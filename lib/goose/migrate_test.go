@@ -1,10 +1,19 @@
 package goose
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"text/template"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
@@ -158,6 +167,680 @@ func TestCollectMigrations(t *testing.T) {
 	})
 }
 
+func TestCollectMigrations_missingDir(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	assert.Empty(t, migs)
+
+	missing := filepath.Join(md, "missing")
+	_, err = CollectMigrations(missing)
+	assert.EqualError(t, err, "migrations directory does not exist: "+missing)
+
+	_, err = GetMostRecentDBVersion(md + string(os.PathListSeparator) + missing)
+	assert.EqualError(t, err, "migrations directory does not exist: "+missing)
+
+	// rather than there being no migrations to run
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: missing,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	assert.EqualError(t, err, "migrations directory does not exist: "+missing)
+}
+
+func TestCollectMigrations_duplicateVersion(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql":  [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040506_second.sql": [2]string{"SELECT 2;", "SELECT 2;"},
+	})
+	defer mdCleanup()
+
+	_, err := CollectMigrations(md)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(md, "20010203040506_first.sql"))
+	assert.Contains(t, err.Error(), filepath.Join(md, "20010203040506_second.sql"))
+}
+
+func TestCollectMigrations_invalidVersion(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql":      [2]string{"SELECT 1;", "SELECT 1;"},
+		"999999999999999999999_foo.sql": [2]string{"SELECT 2;", "SELECT 2;"},
+	})
+	defer mdCleanup()
+
+	// it mustn't vanish from the migrations
+	_, err := CollectMigrations(md)
+	assert.EqualError(t, err, filepath.Join(md, "999999999999999999999_foo.sql")+": version 999999999999999999999 is too large, the maximum is 9223372036854775807")
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.EqualError(t, problems[0], filepath.Join(md, "999999999999999999999_foo.sql")+": version 999999999999999999999 is too large, the maximum is 9223372036854775807")
+
+	// files which aren't named like migrations, or versioned 0, are still
+	// skipped
+	require.NoError(t, os.Remove(filepath.Join(md, "999999999999999999999_foo.sql")))
+	for _, name := range []string{"_foo.sql", "v2_foo.sql", "0_foo.sql", "20010203040507_foo.txt"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(md, name), []byte("SELECT 1;\n"), 0600))
+	}
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	assert.Len(t, migs, 1)
+}
+
+func TestCollectMigrations_dashSeparator(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506-add-users.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040507_add_posts.sql": [2]string{"SELECT 2;", "SELECT 2;"},
+	})
+	defer mdCleanup()
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 2)
+	assert.Equal(t, int64(20010203040506), migs[0].Version)
+	assert.Equal(t, filepath.Join(md, "20010203040506-add-users.sql"), migs[0].Source)
+	assert.Equal(t, int64(20010203040507), migs[1].Version)
+}
+
+func TestNumericComponent(t *testing.T) {
+	tests := map[string]int64{
+		"20010203040506_add_users.sql": 20010203040506,
+		"20010203040506-add-users.sql": 20010203040506,
+		"00001-add_users.go":           1,
+		"00002_add-users.go":           2,
+		"00003_add_users.sql.gz":       3,
+	}
+	for name, want := range tests {
+		v, err := NumericComponent(name)
+		if assert.NoError(t, err, name) {
+			assert.Equal(t, want, v, name)
+		}
+	}
+
+	for _, name := range []string{"20010203040506.sql", "add-users.sql", "0-zero.sql", "99999999999999999999-overflow.sql", "20010203040506-add-users.txt", "00004_add_users.go.gz", "00005_add_users.gz"} {
+		_, err := NumericComponent(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestWalkMigrations(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040508_three.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040506_one.sql":   [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040509_four.sql":  [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040507_two.sql":   [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	var versions []int64
+	err := WalkMigrations(md, 20010203040507, 20010203040508, func(m *Migration) error {
+		assert.Equal(t, md, filepath.Dir(m.Source))
+		versions = append(versions, m.Version)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{20010203040507, 20010203040508}, versions)
+
+	// an error stops the walk
+	stop := errors.New("stop")
+	versions = nil
+	err = WalkMigrations(md, 0, math.MaxInt64, func(m *Migration) error {
+		versions = append(versions, m.Version)
+		if len(versions) == 2 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, []int64{20010203040506, 20010203040507}, versions)
+}
+
+func TestCollectMigrations_subdir(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	err := os.MkdirAll(filepath.Join(md, "fixtures"), 0700)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(md, "fixtures", "123_foo.sql"), []byte("SELECT 1;"), 0600)
+	require.NoError(t, err)
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 1)
+	assert.Equal(t, int64(20010203040506), migs[0].Version)
+
+	version, err := GetMostRecentDBVersion(md)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040506), version)
+
+	previous, err := GetPreviousDBVersion(md, 20010203040506)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), previous)
+}
+
+func TestGetNextDBVersion(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_one.sql":   [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040507_two.sql":   [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040508_three.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	next, err := GetNextDBVersion(md, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040506), next)
+
+	next, err = GetNextDBVersion(md, 20010203040506)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), next)
+
+	_, err = GetNextDBVersion(md, 20010203040508)
+	assert.Equal(t, ErrNoNextVersion, err)
+}
+
+func TestGetDBVersion_bounds(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_one.sql":   [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040507_two.sql":   [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040508_three.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040509_four.sql":  [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	version, err := GetMostRecentDBVersionInRange(md, 0, 20010203040508)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040508), version)
+
+	_, err = GetMostRecentDBVersionInRange(md, 20010203040510, math.MaxInt64)
+	assert.Error(t, err)
+
+	previous, err := GetPreviousDBVersionInRange(md, 20010203040508, 20010203040507, math.MaxInt64)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), previous)
+
+	// nothing before the given version within the bounds
+	previous, err = GetPreviousDBVersionInRange(md, 20010203040507, 20010203040507, math.MaxInt64)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), previous)
+
+	// the given version is outside the bounds
+	_, err = GetPreviousDBVersionInRange(md, 20010203040509, 0, 20010203040508)
+	assert.Equal(t, ErrNoPreviousVersion, err)
+}
+
+func TestMigrationType(t *testing.T) {
+	RegisterMigrationExtension(".psql", "sql")
+	defer delete(migrationExts, ".psql")
+
+	tests := map[string]string{
+		"db/migrations/001_one.sql":    "sql",
+		"db/migrations/002_two.sql.gz": "sql",
+		"db/migrations/003_three.psql": "sql",
+		"db/migrations/004_four.go":    "go",
+		// the file no longer exists
+		"": "unknown",
+	}
+	for source, want := range tests {
+		m := &Migration{Source: source}
+		assert.Equal(t, want, m.Type(), source)
+	}
+}
+
+func TestCollectMigrations_recursive(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	files := map[string]string{
+		"billing/20010203040508_invoices.sql":  "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"users/20010203040507_users.sql":       "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"users/archive/20010203040509_old.sql": "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+	}
+	for name, contents := range files {
+		err := os.MkdirAll(filepath.Join(md, filepath.Dir(name)), 0700)
+		require.NoError(t, err)
+		err = ioutil.WriteFile(filepath.Join(md, name), []byte(contents), 0600)
+		require.NoError(t, err)
+	}
+
+	// only the top level by default
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 1)
+
+	dir := RecursiveMigrationsDir(md)
+	assert.Equal(t, filepath.Join(md, "..."), dir)
+	assert.Equal(t, dir, RecursiveMigrationsDir(dir))
+
+	migs, err = CollectMigrations(dir)
+	require.NoError(t, err)
+	var sources []string
+	for _, m := range migs {
+		sources = append(sources, m.Source)
+	}
+	assert.Equal(t, []string{
+		filepath.Join(md, "20010203040506_first.sql"),
+		filepath.Join(md, "users", "20010203040507_users.sql"),
+		filepath.Join(md, "billing", "20010203040508_invoices.sql"),
+		filepath.Join(md, "users", "archive", "20010203040509_old.sql"),
+	}, sources)
+
+	// new migrations go at the top
+	path, _, err := CreateMigration("next", "sql", dir, time.Date(2001, 2, 3, 4, 5, 10, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(md, "20010203040510_next.sql"), path)
+
+	// versions must be unique across the tree
+	err = ioutil.WriteFile(filepath.Join(md, "billing", "20010203040507_dup.sql"), []byte("-- +goose Up\nSELECT 1;\n"), 0600)
+	require.NoError(t, err)
+	_, err = CollectMigrations(dir)
+	assert.Error(t, err)
+}
+
+func TestCollectMigrations_symlink(t *testing.T) {
+	shared, sharedCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql":  [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040507_second.sql": [2]string{"SELECT 2;", "SELECT 2;"},
+	})
+	defer sharedCleanup()
+	billing, billingCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040508_invoices.sql": [2]string{"SELECT 3;", "SELECT 3;"},
+	})
+	defer billingCleanup()
+
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	// the migrations directory is a symlink to the shared migrations, which
+	// link to the billing ones, and back to themselves
+	md := filepath.Join(td, "migrations")
+	require.NoError(t, os.Symlink(shared, md))
+	require.NoError(t, os.Symlink(billing, filepath.Join(shared, "billing")))
+	require.NoError(t, os.Symlink(shared, filepath.Join(shared, "self")))
+
+	sources := func(dir string) []string {
+		migs, err := CollectMigrations(dir)
+		require.NoError(t, err)
+		var sources []string
+		for _, m := range migs {
+			sources = append(sources, m.Source)
+		}
+		return sources
+	}
+
+	// the symlinked subdirectories aren't taken for files
+	assert.Equal(t, []string{
+		filepath.Join(md, "20010203040506_first.sql"),
+		filepath.Join(md, "20010203040507_second.sql"),
+	}, sources(md))
+
+	assert.Equal(t, []string{
+		filepath.Join(md, "20010203040506_first.sql"),
+		filepath.Join(md, "20010203040507_second.sql"),
+		filepath.Join(md, "billing", "20010203040508_invoices.sql"),
+	}, sources(RecursiveMigrationsDir(md)))
+}
+
+func TestCollectMigrations_ignore(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"100_real.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	files := map[string]string{
+		"000_notes.txt": "not a migration",
+		"101_wip.sql":   "-- +goose Up\nSELECT 1;\n",
+		".gooseignore":  "# notes and unfinished migrations\n*.txt\n\n*_wip.sql\n",
+	}
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(md, name), []byte(contents), 0600)
+		require.NoError(t, err)
+	}
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 1)
+	assert.Equal(t, filepath.Join(md, "100_real.sql"), migs[0].Source)
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	err = ioutil.WriteFile(filepath.Join(md, ".gooseignore"), []byte("[\n"), 0600)
+	require.NoError(t, err)
+	_, err = CollectMigrations(md)
+	assert.EqualError(t, err, filepath.Join(md, ".gooseignore")+`: line 1: invalid pattern "["`)
+}
+
+func TestCollectMigrations_multipleDirs(t *testing.T) {
+	core, coreCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040508_third.sql": [2]string{"SELECT 3;", "SELECT 3;"},
+	})
+	defer coreCleanup()
+	svc, svcCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040507_second.sql": [2]string{"SELECT 2;", "SELECT 2;"},
+	})
+	defer svcCleanup()
+
+	dirs := core + string(os.PathListSeparator) + svc
+	migs, err := CollectMigrations(dirs)
+	require.NoError(t, err)
+	require.Len(t, migs, 3)
+	assert.Equal(t, filepath.Join(core, "20010203040506_first.sql"), migs[0].Source)
+	assert.Equal(t, filepath.Join(svc, "20010203040507_second.sql"), migs[1].Source)
+	assert.Equal(t, filepath.Join(core, "20010203040508_third.sql"), migs[2].Source)
+
+	version, err := GetMostRecentDBVersion(dirs)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040508), version)
+
+	previous, err := GetPreviousDBVersion(dirs, 20010203040508)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), previous)
+
+	// new migrations go in the first dir
+	path, _, err := CreateMigration("fourth", "sql", dirs, time.Date(2001, 2, 3, 4, 5, 9, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(core, "20010203040509_fourth.sql"), path)
+
+	err = ioutil.WriteFile(filepath.Join(svc, "20010203040506_dup.sql"), []byte("SELECT 1;"), 0600)
+	require.NoError(t, err)
+	_, err = CollectMigrations(dirs)
+	assert.Error(t, err)
+}
+
+func TestCreateMigrationContent(t *testing.T) {
+	filename, content, err := CreateMigrationContent("first", "go", time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "20010203040506_first.go", filename)
+	assert.Contains(t, string(content), "func Up_20010203040506(")
+	// an unimplemented rollback fails, rather than silently doing nothing
+	assert.Contains(t, string(content), `return errors.New("down migration not implemented")`)
+
+	_, _, err = CreateMigrationContent("first", "txt", time.Now())
+	assert.Error(t, err)
+}
+
+func TestCreateMigrationContent_name(t *testing.T) {
+	tests := map[string]string{
+		"add user table":       "add_user_table",
+		"  add   user table ":  "add_user_table",
+		"users/add_email":      "users_add_email",
+		"AddUserTable":         "addusertable",
+		"Add Index: users(id)": "add_index_users_id",
+	}
+	for name, slug := range tests {
+		filename, _, err := CreateMigrationContent(name, "sql", time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC))
+		require.NoError(t, err, name)
+		assert.Equal(t, "20010203040506_"+slug+".sql", filename, name)
+	}
+
+	_, _, err := CreateMigrationContent(" / ", "sql", time.Now())
+	assert.Error(t, err)
+}
+
+func TestCreateSequentialMigration(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	path, _, err := CreateSequentialMigration("second", "sql", md)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(md, "00001_second.sql"), path)
+
+	path, version, err := CreateSequentialMigration("third", "go", md)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(md, "00002_third.go"), path)
+	assert.Equal(t, int64(2), version)
+
+	bs, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "func Up_2(")
+	assert.Contains(t, string(bs), "func Down_2(")
+}
+
+func TestCreateMigrationFromTemplates(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	err = ioutil.WriteFile(filepath.Join(td, "migration.sql.tmpl"),
+		[]byte("-- ticket: \n-- version: {{ . }}\n-- +goose Up\n\n-- +goose Down\n"),
+		0600)
+	require.NoError(t, err)
+
+	path, _, err := CreateMigrationFromTemplates("first", "sql", md, td, time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC))
+	require.NoError(t, err)
+	bs, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "-- ticket: \n-- version: 20010203040506\n-- +goose Up\n\n-- +goose Down\n", string(bs))
+
+	// no go template in td, so the default is used
+	path, _, err = CreateSequentialMigrationFromTemplates("second", "go", md, td)
+	require.NoError(t, err)
+	bs, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "func Up_1(")
+}
+
+func TestCreateMigrationFromNamedTemplate(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	when := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	path, _, err := CreateMigrationFromNamedTemplate("add email index", "sql", md, "", "index", when)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(md, "20010203040506_add_email_index.sql"), path)
+	noTx, err := sqlNoTransaction(path)
+	require.NoError(t, err)
+	assert.True(t, noTx)
+
+	_, _, err = CreateMigrationFromNamedTemplate("backfill", "go", md, "", "data", when)
+	assert.EqualError(t, err, `no go migration template named "data"`)
+
+	// templatesDir wins over the registered templates
+	err = ioutil.WriteFile(filepath.Join(td, "migration.data.sql.tmpl"), []byte("-- custom {{ . }}\n"), 0600)
+	require.NoError(t, err)
+	path, _, err = CreateSequentialMigrationFromNamedTemplate("backfill", "sql", md, td, "data")
+	require.NoError(t, err)
+	bs, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "-- custom 1\n", string(bs))
+
+	defer delete(migrationTemplates, "table")
+	RegisterMigrationTemplate("table", "sql", template.Must(template.New("").Parse("-- table {{ . }}\n")))
+	path, _, err = CreateMigrationFromNamedTemplate("users", "sql", md, td, "table", when)
+	require.NoError(t, err)
+	bs, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	// bumped past the index migration's version
+	assert.Equal(t, "-- table 20010203040507\n", string(bs))
+}
+
+func TestCreateMigration_sameSecond(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	when := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	first, firstVersion, err := CreateMigration("foo", "sql", md, when)
+	require.NoError(t, err)
+	second, secondVersion, err := CreateMigration("foo", "sql", md, when)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(md, "20010203040506_foo.sql"), first)
+	assert.Equal(t, filepath.Join(md, "20010203040507_foo.sql"), second)
+	// the returned versions match the file names, bumped for the second
+	assert.Equal(t, int64(20010203040506), firstVersion)
+	assert.Equal(t, int64(20010203040507), secondVersion)
+
+	migrations, err := CollectMigrations(md)
+	require.NoError(t, err)
+	assert.Len(t, migrations, 2)
+}
+
+func TestCreateMigration_noDir(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	pwd, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(pwd)
+	err = os.Chdir(md)
+	require.NoError(t, err)
+
+	// without a dir, the migration is created in the current one
+	path, _, err := CreateMigration("foo", "sql", "", time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "20010203040506_foo.sql", path)
+	_, err = os.Stat(filepath.Join(md, path))
+	assert.NoError(t, err)
+}
+
+func TestCreateMigrationsDir(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	assert.Equal(t, ".", CreateMigrationsDir(""))
+	assert.Equal(t, "a", CreateMigrationsDir("a"))
+	assert.Equal(t, "a", CreateMigrationsDir(filepath.Join("a", "...")+sep+"b"))
+}
+
+func TestCreateMigration_collision(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_foo.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+	existing := filepath.Join(md, "20010203040506_foo.sql")
+	before, err := ioutil.ReadFile(existing)
+	require.NoError(t, err)
+
+	// as if created by another goose process since dir was read
+	_, _, err = createMigration("foo", "sql", md, "", defaultTemplateName, "20010203040506", "20010203040506")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+
+	_, _, err = createMigration("bar", "sql", md, "", defaultTemplateName, "20010203040506", "20010203040506")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "has the same version as "+existing)
+	_, err = os.Stat(filepath.Join(md, "20010203040506_bar.sql"))
+	assert.True(t, os.IsNotExist(err), "the colliding migration should have been removed")
+
+	after, err := ioutil.ReadFile(existing)
+	require.NoError(t, err)
+	assert.Equal(t, string(before), string(after))
+}
+
+func TestCreateMigrationWithVersionFormat(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	when := time.Date(2021, 2, 3, 4, 5, 6, 7000000, time.UTC)
+	for _, tc := range []struct {
+		format string
+		files  [2]string
+	}{
+		{"unix", [2]string{"1612325106_foo.sql", "1612325107_foo.sql"}},
+		{"unixmilli", [2]string{"1612325106007_foo.sql", "1612325106008_foo.sql"}},
+	} {
+		for _, file := range tc.files {
+			path, _, err := CreateMigrationWithVersionFormat("foo", "sql", md, "", "default", tc.format, when)
+			require.NoError(t, err)
+			assert.Equal(t, filepath.Join(md, file), path)
+		}
+	}
+
+	// they aren't mistaken for sequential versions
+	path, _, err := CreateSequentialMigration("bar", "sql", md)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(md, "00001_bar.sql"), path)
+
+	_, _, err = CreateMigrationWithVersionFormat("foo", "sql", md, "", "default", "rfc3339", when)
+	assert.EqualError(t, err, `unknown version format "rfc3339", expected timestamp, unix or unixmilli`)
+}
+
+func TestDBConf_VersionTime(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	// authored at 01:02:03 in UTC+05:30
+	when := time.Date(2021, 2, 3, 6, 32, 3, 0, time.FixedZone("IST", 5*60*60+30*60))
+
+	conf := &DBConf{MigrationsDir: md}
+	vt, err := conf.VersionTime(when)
+	require.NoError(t, err)
+	path, _, err := CreateMigration("foo", "sql", md, vt)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(md, "20210203010203_foo.sql"), path)
+
+	conf.VersionTimezone = "UTC"
+	vt, err = conf.VersionTime(when)
+	require.NoError(t, err)
+	assert.Equal(t, "20210203010203", vt.Format(timestampFormat))
+
+	conf.VersionTimezone = "Nowhere/Special"
+	_, err = conf.VersionTime(when)
+	assert.Error(t, err)
+}
+
+func TestFixMigrations(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"00001_first.sql":           [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040507_second.sql": [2]string{"SELECT 2;", "SELECT 2;"},
+	})
+	defer mdCleanup()
+
+	_, _, err := CreateMigration("third", "go", md, time.Date(2001, 2, 3, 4, 5, 8, 0, time.UTC))
+	require.NoError(t, err)
+
+	err = FixMigrations(md)
+	require.NoError(t, err)
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 3)
+	assert.Contains(t, migs, &Migration{Version: 1, Source: filepath.Join(md, "00001_first.sql")})
+	assert.Contains(t, migs, &Migration{Version: 2, Source: filepath.Join(md, "00002_second.sql")})
+	assert.Contains(t, migs, &Migration{Version: 3, Source: filepath.Join(md, "00003_third.go")})
+
+	bs, err := ioutil.ReadFile(filepath.Join(md, "00003_third.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(bs), "func Up_3(")
+	assert.Contains(t, string(bs), "func Down_3(")
+}
+
+func TestFixMigrations_dashSeparator(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506-add-users.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	err := FixMigrations(md)
+	require.NoError(t, err)
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 1)
+	assert.Equal(t, &Migration{Version: 1, Source: filepath.Join(md, "00001-add-users.sql")}, migs[0])
+}
+
 func testRunMigrationsOnDb(t *testing.T, driver DBDriver) {
 	md, mdCleanup := setupMigrationsDir(map[string][2]string{
 		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
@@ -166,126 +849,2064 @@ func testRunMigrationsOnDb(t *testing.T, driver DBDriver) {
 	})
 	defer mdCleanup()
 	conf := &DBConf{
-		Driver:        driver,
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		require.NoError(t, err)
+		values = append(values, value)
+	}
+
+	assert.Len(t, values, 2)
+	assert.Contains(t, values, "one")
+	assert.Contains(t, values, "two")
+}
+func TestRunMigrationsOnDb_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_mysql(t *testing.T) {
+	testRunMigrationsOnDb(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_postgres(t *testing.T) {
+	testRunMigrationsOnDb(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_redshift(t *testing.T) {
+	testRunMigrationsOnDb(t, getRedshiftDriver(t))
+}
+
+func testRunMigrationsOnDb_unknownTarget(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	// up
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040599, db)
+	if assert.Error(t, err) {
+		assert.Equal(t, "target version 20010203040599 not found in "+md, err.Error())
+	}
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, current)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	// down
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040500, db)
+	if assert.Error(t, err) {
+		assert.Equal(t, "target version 20010203040500 not found in "+md, err.Error())
+	}
+	current, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040507, current)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	assert.NoError(t, err)
+}
+func TestRunMigrationsOnDb_unknownTarget_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_unknownTarget(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_unknownTarget_mysql(t *testing.T) {
+	testRunMigrationsOnDb_unknownTarget(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_unknownTarget_postgres(t *testing.T) {
+	testRunMigrationsOnDb_unknownTarget(t, getPostgresDriver(t))
+}
+
+func TestNewDBConfForDB(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	conf := NewDBConfForDB(Sqlite3Dialect{}, md)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040506, current)
+
+	// go migrations can't be run without the driver info
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_go.go"),
+		[]byte("package main\n\nimport \"database/sql\"\n\nfunc Up_20010203040507(txn *sql.Tx) {}\nfunc Down_20010203040507(txn *sql.Tx) {}\n"),
+		0600)
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	assert.Error(t, err)
+}
+
+func TestNewInMemoryConf(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+	})
+	defer mdCleanup()
+
+	conf := NewInMemoryConf(md)
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	// the migrations must have run on the same, single, connection
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040507, current)
+}
+
+func TestRunMigrations_programmaticConf(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+	})
+	defer mdCleanup()
+
+	// an on disk DB, as RunMigrations opens a DB of its own
+	driver := DriverDefaults("sqlite3")
+	driver.OpenStr = filepath.Join(filepath.Dir(md), "goose.db")
+	conf := &DBConf{
+		MigrationsDir: md,
+		Driver:        driver,
+		Output:        ioutil.Discard,
+	}
+	require.NoError(t, conf.Validate())
+
+	target, err := GetMostRecentDBVersion(conf.MigrationsDir)
+	require.NoError(t, err)
+	err = RunMigrations(conf, conf.MigrationsDir, target)
+	require.NoError(t, err)
+
+	current, err := GetDBVersion(conf)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040507, current)
+}
+
+func testRunMigrationsOnDb_missingMiddle(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	// make the middle migration disappear for a moment
+	err = os.Rename(filepath.Join(md, "20010203040507_one.sql"), filepath.Join(md, "20010203040507_one.sql_"))
+	require.NoError(t, err)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		require.NoError(t, err)
+		values = append(values, value)
+	}
+
+	assert.Len(t, values, 1)
+	assert.Contains(t, values, "two")
+
+	// now put it back
+	err = os.Rename(filepath.Join(md, "20010203040507_one.sql_"), filepath.Join(md, "20010203040507_one.sql"))
+	require.NoError(t, err)
+
+	// out of order migrations are refused by default
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	if assert.Error(t, err) {
+		assert.Equal(t, "found pending migrations older than the current version 20010203040508: 20010203040507", err.Error())
+	}
+
+	conf.AllowMissing = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	rows, err = db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	defer rows.Close()
+	values = []string{}
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		require.NoError(t, err)
+		values = append(values, value)
+	}
+
+	assert.Len(t, values, 2)
+	assert.Contains(t, values, "one")
+	assert.Contains(t, values, "two")
+}
+func TestRunMigrationsOnDb_missingMiddle_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_missingMiddle(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_missingMiddle_mysql(t *testing.T) {
+	testRunMigrationsOnDb_missingMiddle(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_missingMiddle_postgres(t *testing.T) {
+	testRunMigrationsOnDb_missingMiddle(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_missingMiddle_redshift(t *testing.T) {
+	testRunMigrationsOnDb_missingMiddle(t, getRedshiftDriver(t))
+}
+
+func testRunMigrationsOnDb_outOfOrder(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	// another branch applied the later migration first
+	err = os.Rename(filepath.Join(md, "20010203040507_one.sql"), filepath.Join(md, "20010203040507_one.sql_"))
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// this branch has the earlier migration, but not the later one
+	err = os.Rename(filepath.Join(md, "20010203040507_one.sql_"), filepath.Join(md, "20010203040507_one.sql"))
+	require.NoError(t, err)
+	err = os.Rename(filepath.Join(md, "20010203040508_two.sql"), filepath.Join(md, "20010203040508_two.sql_"))
+	require.NoError(t, err)
+
+	// the DB being ahead of the migrations, nothing is run
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.EqualError(t, err, "database is ahead of migration files (version 20010203040508 applied, 20010203040507 on disk)")
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM test WHERE value = 'one'").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	conf.OutOfOrder = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		require.NoError(t, err)
+		values = append(values, value)
+	}
+	assert.Len(t, values, 2)
+	assert.Contains(t, values, "one")
+	assert.Contains(t, values, "two")
+
+	// the missing migration is left as it was
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040508, current)
+
+	// and once it's back, there's nothing left to apply
+	err = os.Rename(filepath.Join(md, "20010203040508_two.sql_"), filepath.Join(md, "20010203040508_two.sql"))
+	require.NoError(t, err)
+	res, err := RunMigrationsWithResult(context.Background(), conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	assert.Empty(t, res.Migrations)
+}
+func TestRunMigrationsOnDb_outOfOrder_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_outOfOrder(t, getSqlite3Driver(t))
+}
+
+func TestRunMigrationsOnDb_ahead(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// an older branch, without the latest migration, is checked out
+	err = os.Rename(filepath.Join(md, "20010203040508_two.sql"), filepath.Join(md, "20010203040508_two.sql_"))
+	require.NoError(t, err)
+
+	for _, target := range []int64{0, 20010203040506, 20010203040507} {
+		err = RunMigrationsOnDb(conf, conf.MigrationsDir, target, db)
+		assert.EqualError(t, err, "database is ahead of migration files (version 20010203040508 applied, 20010203040507 on disk)")
+	}
+	_, err = PlanMigrations(conf, db, 20010203040507)
+	assert.Error(t, err)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// a missing version before the latest migration isn't a problem
+	err = os.Rename(filepath.Join(md, "20010203040508_two.sql_"), filepath.Join(md, "20010203040508_two.sql"))
+	require.NoError(t, err)
+	err = os.Rename(filepath.Join(md, "20010203040507_one.sql"), filepath.Join(md, "20010203040507_one.sql_"))
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	err = os.Rename(filepath.Join(md, "20010203040507_one.sql_"), filepath.Join(md, "20010203040507_one.sql"))
+	require.NoError(t, err)
+
+	err = os.Rename(filepath.Join(md, "20010203040508_two.sql"), filepath.Join(md, "20010203040508_two.sql_"))
+	require.NoError(t, err)
+	conf.AllowAhead = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	// the migration on disk is rolled back, the missing one is left
+	err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040508, current)
+}
+func TestRunMigrationsOnDb_outOfOrder_mysql(t *testing.T) {
+	testRunMigrationsOnDb_outOfOrder(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_outOfOrder_postgres(t *testing.T) {
+	testRunMigrationsOnDb_outOfOrder(t, getPostgresDriver(t))
+}
+
+func testRunMigrationsOnDb_down(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	// up
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// down
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		require.NoError(t, err)
+		values = append(values, value)
+	}
+
+	assert.Len(t, values, 1)
+	assert.Contains(t, values, "one")
+}
+func TestRunMigrationsOnDb_down_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_down(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_down_mysql(t *testing.T) {
+	testRunMigrationsOnDb_down(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_down_postgres(t *testing.T) {
+	testRunMigrationsOnDb_down(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_down_redshift(t *testing.T) {
+	testRunMigrationsOnDb_down(t, getRedshiftDriver(t))
+}
+
+func testRunMigrationsOnDb_downToZero(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// roll back one at a time, as `goose down` does
+	for {
+		current, err := GetDBVersion(conf)
+		require.NoError(t, err)
+		if current == 0 {
+			break
+		}
+		previous, err := GetPreviousDBVersion(conf.MigrationsDir, current)
+		require.NoError(t, err)
+		err = RunMigrationsOnDb(conf, conf.MigrationsDir, previous, db)
+		require.NoError(t, err)
+	}
+
+	current, err := GetDBVersion(conf)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, current)
+
+	// without the initial record, everything is still rolled back
+	_, err = db.Exec("DELETE FROM goose_db_version WHERE version_id = 0")
+	require.NoError(t, err)
+	current, err = GetDBVersion(conf)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, current)
+}
+func TestRunMigrationsOnDb_downToZero_sqlite3(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	// GetDBVersion opens its own connection, so the DB can't be in memory
+	driver := getSqlite3Driver(t)
+	driver.OpenStr = filepath.Join(td, "goose.db")
+	testRunMigrationsOnDb_downToZero(t, driver)
+}
+func TestRunMigrationsOnDb_downToZero_mysql(t *testing.T) {
+	testRunMigrationsOnDb_downToZero(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_downToZero_postgres(t *testing.T) {
+	testRunMigrationsOnDb_downToZero(t, getPostgresDriver(t))
+}
+
+func testRunMigrationsOnDb_upsert(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	countVersions := func() int {
+		var count int
+		err := db.QueryRow("SELECT count(*) FROM goose_db_version").Scan(&count)
+		require.NoError(t, err)
+		return count
+	}
+
+	// up, down, up without upserting leaves a row for each step
+	for _, target := range []int64{20010203040507, 0, 20010203040507} {
+		err = RunMigrationsOnDb(conf, conf.MigrationsDir, target, db)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 7, countVersions())
+
+	// the old rows are removed once upserting
+	conf.UpsertVersions = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	assert.Equal(t, 3, countVersions())
+
+	for _, target := range []int64{0, 20010203040507, 20010203040506} {
+		err = RunMigrationsOnDb(conf, conf.MigrationsDir, target, db)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, countVersions())
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040506, current)
+
+	migrations, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.True(t, migrations[0].IsApplied)
+	assert.False(t, migrations[1].IsApplied)
+}
+func TestRunMigrationsOnDb_upsert_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_upsert(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_upsert_mysql(t *testing.T) {
+	testRunMigrationsOnDb_upsert(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_upsert_postgres(t *testing.T) {
+	testRunMigrationsOnDb_upsert(t, getPostgresDriver(t))
+}
+
+func testRunMigrationsOnDb_upDownUp(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	// up
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// down
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT value FROM test")
+	require.Error(t, err) // table won't exist
+
+	// up
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	rows, err = db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	defer rows.Close()
+	var values []string
+	for rows.Next() {
+		var value string
+		err := rows.Scan(&value)
+		require.NoError(t, err)
+		values = append(values, value)
+	}
+
+	assert.Len(t, values, 2)
+	assert.Contains(t, values, "one")
+	assert.Contains(t, values, "two")
+}
+func TestRunMigrationsOnDb_upDownUp_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_upDownUp(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_upDownUp_mysql(t *testing.T) {
+	testRunMigrationsOnDb_upDownUp(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_upDownUp_postgres(t *testing.T) {
+	testRunMigrationsOnDb_upDownUp(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_upDownUp_redshift(t *testing.T) {
+	testRunMigrationsOnDb_upDownUp(t, getRedshiftDriver(t))
+}
+
+func testRunMigrationsContext_cancel(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_slow.sql":  [2]string{slowQueries[driver.Name], "SELECT 1;"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(500*time.Millisecond, cancel)
+
+	start := time.Now()
+	err = RunMigrationsContext(ctx, conf, conf.MigrationsDir, 20010203040508, db)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < 10*time.Second, "migration did not abort promptly")
+}
+
+// statements which take far longer to run than the tests are willing to wait
+var slowQueries = map[string]string{
+	"sqlite3":  "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c WHERE x < 10000000000) SELECT count(*) FROM c;",
+	"mysql":    "SELECT SLEEP(60);",
+	"postgres": "SELECT pg_sleep(60);",
+}
+
+func TestRunMigrationsContext_cancel_sqlite3(t *testing.T) {
+	testRunMigrationsContext_cancel(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsContext_cancel_mysql(t *testing.T) {
+	testRunMigrationsContext_cancel(t, getMysqlDriver(t))
+}
+func TestRunMigrationsContext_cancel_postgres(t *testing.T) {
+	testRunMigrationsContext_cancel(t, getPostgresDriver(t))
+}
+
+func testMigrationStatus(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	migs, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+
+	require.Len(t, migs, 3)
+	assert.Equal(t, int64(20010203040506), migs[0].Version)
+	assert.True(t, migs[0].IsApplied)
+	assert.False(t, migs[0].TStamp.IsZero())
+	assert.Equal(t, int64(20010203040507), migs[1].Version)
+	assert.True(t, migs[1].IsApplied)
+	assert.False(t, migs[1].TStamp.IsZero())
+	assert.Equal(t, int64(20010203040508), migs[2].Version)
+	assert.False(t, migs[2].IsApplied)
+	assert.True(t, migs[2].TStamp.IsZero())
+}
+func TestMigrationStatus_sqlite3(t *testing.T) {
+	testMigrationStatus(t, getSqlite3Driver(t))
+}
+func TestMigrationStatus_mysql(t *testing.T) {
+	testMigrationStatus(t, getMysqlDriver(t))
+}
+func TestMigrationStatus_postgres(t *testing.T) {
+	testMigrationStatus(t, getPostgresDriver(t))
+}
+func TestMigrationStatus_redshift(t *testing.T) {
+	testMigrationStatus(t, getRedshiftDriver(t))
+}
+
+func testMigrationStatus_missingFile(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	err = os.Remove(filepath.Join(md, "20010203040507_one.sql"))
+	require.NoError(t, err)
+
+	migs, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+
+	require.Len(t, migs, 2)
+	assert.Equal(t, int64(20010203040506), migs[0].Version)
+	assert.Equal(t, "20010203040506_setup.sql", migs[0].Name)
+	assert.Equal(t, int64(20010203040507), migs[1].Version)
+	assert.Equal(t, "20010203040507_one.sql", migs[1].Name)
+	assert.Equal(t, "", migs[1].Source)
+	assert.True(t, migs[1].IsApplied)
+}
+func TestMigrationStatus_missingFile_sqlite3(t *testing.T) {
+	testMigrationStatus_missingFile(t, getSqlite3Driver(t))
+}
+func TestMigrationStatus_missingFile_mysql(t *testing.T) {
+	testMigrationStatus_missingFile(t, getMysqlDriver(t))
+}
+func TestMigrationStatus_missingFile_postgres(t *testing.T) {
+	testMigrationStatus_missingFile(t, getPostgresDriver(t))
+}
+func TestMigrationStatus_missingFile_redshift(t *testing.T) {
+	testMigrationStatus_missingFile(t, getRedshiftDriver(t))
+}
+
+func testRunMigrationsOnDb_dryRun(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		DryRun:        true,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	// pristine DB
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	_, err = db.Exec("SELECT * FROM goose_db_version")
+	assert.Error(t, err, "version table should not have been created")
+	_, err = db.Exec("SELECT * FROM test")
+	assert.Error(t, err, "migrations should not have been run")
+
+	// partially migrated DB
+	conf.DryRun = false
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	conf.DryRun = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040506), current)
+}
+func TestRunMigrationsOnDb_dryRun_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_dryRun(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_dryRun_mysql(t *testing.T) {
+	testRunMigrationsOnDb_dryRun(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_dryRun_postgres(t *testing.T) {
+	testRunMigrationsOnDb_dryRun(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_dryRun_redshift(t *testing.T) {
+	testRunMigrationsOnDb_dryRun(t, getRedshiftDriver(t))
+}
+
+func testRunMigrationsOnDb_noVersioning(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		NoVersioning:  true,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+	defer db.Exec("DROP TABLE test")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	_, err = db.Exec("SELECT * FROM goose_db_version")
+	assert.Error(t, err, "version table should not have been created")
+
+	var values []string
+	rows, err := db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	for rows.Next() {
+		var v string
+		require.NoError(t, rows.Scan(&v))
+		values = append(values, v)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"one"}, values)
+
+	// refuse to touch a versioned DB
+	conf.NoVersioning = false
+	_, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	defer db.Exec("DROP TABLE goose_db_version")
+
+	conf.NoVersioning = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	assert.Error(t, err)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+func TestRunMigrationsOnDb_noVersioning_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_noVersioning(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_noVersioning_mysql(t *testing.T) {
+	testRunMigrationsOnDb_noVersioning(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_noVersioning_postgres(t *testing.T) {
+	testRunMigrationsOnDb_noVersioning(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_noVersioning_redshift(t *testing.T) {
+	testRunMigrationsOnDb_noVersioning(t, getRedshiftDriver(t))
+}
+
+func TestRunMigrationsOnDb_migrationError(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_bad.sql":   [2]string{"INSERT INTO nonexistent(value) VALUES('bad');", ""},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "quitting migration")
+
+	merr, ok := err.(*MigrationError)
+	require.True(t, ok, "%v", err)
+	assert.EqualValues(t, 20010203040507, merr.Version)
+	assert.Equal(t, filepath.Join(md, "20010203040507_bad.sql"), merr.Source)
+	assert.Equal(t, DirectionUp, merr.Direction)
+	assert.False(t, merr.RolledBack)
+	assert.Contains(t, merr.Err.Error(), "nonexistent")
+}
+
+func testRunMigrationsOnDb_singleTransaction(t *testing.T, driver DBDriver) {
+	files := map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_bad.sql":   [2]string{"INSERT INTO nonexistent(value) VALUES('bad');", ""},
+	}
+	md, mdCleanup := setupMigrationsDir(files)
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:            driver,
+		MigrationsDir:     md,
+		SingleTransaction: true,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+	defer db.Exec("DROP TABLE goose_db_version")
+	defer db.Exec("DROP TABLE test")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.Error(t, err)
+	merr, ok := err.(*MigrationError)
+	require.True(t, ok, "%v", err)
+	assert.EqualValues(t, 20010203040508, merr.Version)
+	assert.True(t, merr.RolledBack)
+
+	_, err = db.Exec("SELECT * FROM test")
+	assert.Error(t, err, "the earlier migrations should have been rolled back")
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), current)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	current, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), current)
+}
+func TestRunMigrationsOnDb_singleTransaction_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_singleTransaction(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_singleTransaction_postgres(t *testing.T) {
+	testRunMigrationsOnDb_singleTransaction(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_singleTransaction_redshift(t *testing.T) {
+	testRunMigrationsOnDb_singleTransaction(t, getRedshiftDriver(t))
+}
+
+// noTransactionalDDLDialect claims DDL implicitly commits, as it does
+// with mysql.
+type noTransactionalDDLDialect struct {
+	Sqlite3Dialect
+}
+
+func (noTransactionalDDLDialect) capabilities() DialectCapabilities {
+	return DialectCapabilities{CreateTableIfNotExists: true}
+}
+
+func TestRunMigrationsOnDb_singleTransaction_noTransactionalDDL(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+	driver := getSqlite3Driver(t)
+	driver.Dialect = noTransactionalDDLDialect{}
+	conf := &DBConf{
+		Driver:            driver,
+		MigrationsDir:     md,
+		SingleTransaction: true,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "single transaction isn't supported")
+
+	_, err = db.Exec("SELECT * FROM test")
+	assert.Error(t, err, "the migration shouldn't have run")
+}
+
+func TestRunMigrationsOnDb_continueOnError(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_one.sql":   [2]string{"CREATE TABLE one(value VARCHAR(20));", "DROP TABLE one;"},
+		"20010203040507_two.sql":   [2]string{"CREATE TABLE two(value VARCHAR(20));", "DROP TABLE two;"},
+		"20010203040508_three.sql": [2]string{"CREATE TABLE three(value VARCHAR(20));", "DROP TABLE three;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// dropped by hand, so rolling back two fails
+	_, err = db.Exec("DROP TABLE two")
+	require.NoError(t, err)
+
+	conf.ContinueOnError = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	merrs, ok := err.(MigrationErrors)
+	require.True(t, ok, "%v", err)
+	require.Len(t, merrs, 1)
+	assert.Equal(t, int64(20010203040507), merrs[0].Version)
+	assert.Equal(t, DirectionDown, merrs[0].Direction)
+
+	// the migrations either side of it were still rolled back
+	for _, table := range []string{"one", "three"} {
+		_, err = db.Exec("SELECT * FROM " + table)
+		assert.Error(t, err, table)
+	}
+	migs, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	require.Len(t, migs, 3)
+	assert.False(t, migs[0].IsApplied)
+	assert.True(t, migs[1].IsApplied)
+	assert.False(t, migs[2].IsApplied)
+}
+
+func testRunMigrationsOnDb_allowMissing_current(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040508_new.sql":   [2]string{"INSERT INTO test(value) VALUES('new');", "DELETE FROM test WHERE value = 'new';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		AllowMissing:  true,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+	defer db.Exec("DROP TABLE goose_db_version")
+	defer db.Exec("DROP TABLE test")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// a migration which arrived late, e.g. from another branch
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_late.sql"),
+		[]byte("-- +goose Up\nINSERT INTO test(value) VALUES('late');\n\n-- +goose Down\nDELETE FROM test WHERE value = 'late';\n"),
+		0600)
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040508), current)
+
+	ms, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+	for _, m := range ms {
+		assert.True(t, m.IsApplied, "%d", m.Version)
+		assert.Equal(t, m.Version == 20010203040507, m.OutOfOrder, "%d", m.Version)
+	}
+
+	// nothing left to run, even without AllowMissing
+	var buf bytes.Buffer
+	conf.AllowMissing = false
+	conf.Output = &buf
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "no migrations to run. current version: 20010203040508")
+}
+func TestRunMigrationsOnDb_allowMissing_current_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_allowMissing_current(t, getSqlite3Driver(t))
+}
+func TestRunMigrationsOnDb_allowMissing_current_mysql(t *testing.T) {
+	testRunMigrationsOnDb_allowMissing_current(t, getMysqlDriver(t))
+}
+func TestRunMigrationsOnDb_allowMissing_current_postgres(t *testing.T) {
+	testRunMigrationsOnDb_allowMissing_current(t, getPostgresDriver(t))
+}
+func TestRunMigrationsOnDb_allowMissing_current_redshift(t *testing.T) {
+	testRunMigrationsOnDb_allowMissing_current(t, getRedshiftDriver(t))
+}
+
+func TestRunMigrationsWithResult(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_bad.sql":   [2]string{"INSERT INTO nonexistent(value) VALUES('bad');", ""},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	versions := func(ms []*Migration) []int64 {
+		var vs []int64
+		for _, m := range ms {
+			vs = append(vs, m.Version)
+		}
+		return vs
+	}
+
+	ctx := context.Background()
+	res, err := RunMigrationsWithResult(ctx, conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	assert.Equal(t, DirectionUp, res.Direction)
+	assert.Equal(t, []int64{20010203040506, 20010203040507}, versions(res.Migrations))
+	assert.True(t, res.Migrations[0].IsApplied)
+	assert.Equal(t, int64(20010203040507), res.Version)
+
+	// nothing to do
+	res, err = RunMigrationsWithResult(ctx, conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	assert.Empty(t, res.Migrations)
+	assert.Equal(t, int64(20010203040507), res.Version)
+
+	// the failed migration isn't included
+	res, err = RunMigrationsWithResult(ctx, conf, conf.MigrationsDir, 20010203040508, db)
+	require.Error(t, err)
+	assert.Empty(t, res.Migrations)
+	assert.Equal(t, int64(20010203040507), res.Version)
+
+	res, err = RunMigrationsWithResult(ctx, conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+	assert.Equal(t, DirectionDown, res.Direction)
+	assert.Equal(t, []int64{20010203040507, 20010203040506}, versions(res.Migrations))
+	assert.False(t, res.Migrations[0].IsApplied)
+	assert.Equal(t, int64(0), res.Version)
+
+	conf.DryRun = true
+	res, err = RunMigrationsWithResult(ctx, conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	assert.Empty(t, res.Migrations)
+	assert.Equal(t, int64(0), res.Version)
+}
+
+func TestRunMigrationsWithResult_partial(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test;"},
+		"20010203040508_bad.sql":   [2]string{"INSERT INTO nonexistent(value) VALUES('bad');", ""},
+		"20010203040509_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test;"},
+		"20010203040510_three.sql": [2]string{"INSERT INTO test(value) VALUES('three');", "DELETE FROM test;"},
+	})
+	defer mdCleanup()
+
+	versions := func(ms []*Migration) []int64 {
+		var vs []int64
+		for _, m := range ms {
+			vs = append(vs, m.Version)
+		}
+		return vs
+	}
+
+	for _, singleTransaction := range []bool{false, true} {
+		conf := &DBConf{
+			Driver:            getSqlite3Driver(t),
+			MigrationsDir:     md,
+			Output:            ioutil.Discard,
+			SingleTransaction: singleTransaction,
+		}
+		db, err := OpenDBFromDBConf(conf)
+		require.NoError(t, err)
+
+		res, err := RunMigrationsWithResult(context.Background(), conf, conf.MigrationsDir, 20010203040510, db)
+		require.Error(t, err)
+		assert.Equal(t, []int64{20010203040508}, versions(res.Failed))
+		if singleTransaction {
+			// the migrations before the failed one were rolled back with it
+			assert.Empty(t, res.Migrations)
+			assert.Equal(t, []int64{20010203040506, 20010203040507, 20010203040509, 20010203040510}, versions(res.Remaining))
+		} else {
+			assert.Equal(t, []int64{20010203040506, 20010203040507}, versions(res.Migrations))
+			assert.Equal(t, []int64{20010203040509, 20010203040510}, versions(res.Remaining))
+		}
+		db.Close()
+	}
+}
+
+func TestPlanMigrations(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+		"20010203040509_three.sql": [2]string{"INSERT INTO test(value) VALUES('three');", "DELETE FROM test WHERE value = 'three';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:          getSqlite3Driver(t),
+		MigrationsDir:   md,
+		Output:          ioutil.Discard,
+		ExcludeVersions: []int64{20010203040508},
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	versions := func(ms []*Migration) []int64 {
+		var vs []int64
+		for _, m := range ms {
+			vs = append(vs, m.Version)
+		}
+		return vs
+	}
+
+	// planning doesn't create the version table
+	plan, err := PlanMigrations(conf, db, 20010203040509)
+	require.NoError(t, err)
+	exists, err := conf.Driver.Dialect.tableExists(context.Background(), db, conf.versionTable())
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// the plan is what a run then does, up and down
+	for _, target := range []int64{20010203040509, 20010203040506, 0} {
+		plan, err = PlanMigrations(conf, db, target)
+		require.NoError(t, err)
+		res, err := RunMigrationsWithResult(context.Background(), conf, conf.MigrationsDir, target, db)
+		require.NoError(t, err)
+		assert.Equal(t, res.Direction, plan.Direction, "%d", target)
+		assert.Equal(t, versions(res.Migrations), versions(plan.Migrations), "%d", target)
+		assert.Equal(t, target, plan.Target)
+	}
+	assert.Equal(t, DirectionDown, plan.Direction)
+	assert.Equal(t, int64(20010203040506), plan.Current)
+	assert.Equal(t, []int64{20010203040506}, versions(plan.Migrations))
+
+	plan, err = PlanMigrations(conf, db, 20010203040509)
+	require.NoError(t, err)
+	assert.Equal(t, DirectionUp, plan.Direction)
+	assert.Equal(t, int64(0), plan.Current)
+	assert.Equal(t, []int64{20010203040506, 20010203040507, 20010203040509}, versions(plan.Migrations))
+
+	_, err = PlanMigrations(conf, db, 20010203040510)
+	assert.EqualError(t, err, "target version 20010203040510 not found in "+md)
+}
+
+func TestEnsureMigrated(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	conf := &DBConf{
+		Driver:        newDBDriver("sqlite3", filepath.Join(md, "goose.db")),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+	versionOf := func() int64 {
+		v, err := GetDBVersion(conf)
+		require.NoError(t, err)
+		return v
+	}
+
+	// no migrations yet
+	require.NoError(t, EnsureMigrated(conf))
+
+	writeMigration := func(name, up, down string) {
+		err := ioutil.WriteFile(filepath.Join(md, name), []byte("-- +goose Up\n"+up+"\n\n-- +goose Down\n"+down+"\n"), 0600)
+		require.NoError(t, err)
+	}
+	writeMigration("20010203040506_setup.sql", "CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;")
+	writeMigration("20010203040507_one.sql", "INSERT INTO test(value) VALUES('one');", "DELETE FROM test;")
+
+	require.NoError(t, EnsureMigrated(conf))
+	assert.Equal(t, int64(20010203040507), versionOf())
+
+	// calling it again is a no-op
+	require.NoError(t, EnsureMigrated(conf))
+	assert.Equal(t, int64(20010203040507), versionOf())
+
+	writeMigration("20010203040508_two.sql", "INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';")
+	require.NoError(t, EnsureMigrated(conf))
+	assert.Equal(t, int64(20010203040508), versionOf())
+
+	// a DB migrated further, e.g. by a newer release, isn't rolled back
+	require.NoError(t, os.Remove(filepath.Join(md, "20010203040508_two.sql")))
+	require.NoError(t, EnsureMigrated(conf))
+	assert.Equal(t, int64(20010203040508), versionOf())
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+	assert.Equal(t, 2, n)
+
+	// a failing migration's error is returned
+	writeMigration("20010203040509_bad.sql", "INSERT INTO nonexistent(value) VALUES('bad');", "")
+	err = EnsureMigratedOnDb(context.Background(), conf, db)
+	merr, ok := err.(*MigrationError)
+	require.True(t, ok, "%v", err)
+	assert.Equal(t, int64(20010203040509), merr.Version)
+}
+
+func TestMigrationStatus_latestByID(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_same.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+		"20010203040507_skew.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+
+	// applied then rolled back within the same second, and rolled back
+	// with the clock having gone backwards
+	for _, row := range []struct {
+		version int64
+		applied bool
+		tstamp  string
+	}{
+		{20010203040506, true, "2001-02-03 04:05:06"},
+		{20010203040506, false, "2001-02-03 04:05:06"},
+		{20010203040507, true, "2001-02-03 04:05:08"},
+		{20010203040507, false, "2001-02-03 04:05:07"},
+	} {
+		_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied, tstamp) VALUES (?, ?, ?)", row.version, row.applied, row.tstamp)
+		require.NoError(t, err)
+	}
+
+	ms, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	require.Len(t, ms, 2)
+	assert.False(t, ms[0].IsApplied)
+	assert.False(t, ms[1].IsApplied)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), current)
+}
+
+func TestVersionRecords(t *testing.T) {
+	conf := &DBConf{
+		Driver: getSqlite3Driver(t),
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	records, err := VersionRecords(conf, db)
+	require.NoError(t, err)
+	assert.Nil(t, records)
+
+	_, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+
+	// a duplicate, an orphan, and a record written with the clock having
+	// gone backwards
+	for _, row := range []struct {
+		version int64
+		applied bool
+		tstamp  string
+	}{
+		{20010203040506, true, "2001-02-03 04:05:06"},
+		{20010203040506, true, "2001-02-03 04:05:06"},
+		{20010203040508, true, "2001-02-03 04:05:09"},
+		{20010203040507, false, "2001-02-03 04:05:07"},
+	} {
+		_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied, tstamp) VALUES (?, ?, ?)", row.version, row.applied, row.tstamp)
+		require.NoError(t, err)
+	}
+	_, err = db.Exec("UPDATE goose_db_version SET tstamp = '2001-02-03 04:05:05' WHERE version_id = 0")
+	require.NoError(t, err)
+
+	records, err = VersionRecords(conf, db)
+	require.NoError(t, err)
+	var versions []int64
+	for _, r := range records {
+		versions = append(versions, r.Version)
+	}
+	assert.Equal(t, []int64{0, 20010203040506, 20010203040506, 20010203040507, 20010203040508}, versions)
+	assert.False(t, records[3].IsApplied)
+}
+
+func TestFinalizeMigration_noSource(t *testing.T) {
+	conf := &DBConf{
+		Driver: getSqlite3Driver(t),
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+
+	txn, err := db.Begin()
+	require.NoError(t, err)
+	require.NoError(t, FinalizeMigration(conf, txn, DirectionUp, 20010203040506))
+
+	var name, checksum sql.NullString
+	err = db.QueryRow("SELECT name, checksum FROM goose_db_version WHERE version_id = 20010203040506").Scan(&name, &checksum)
+	require.NoError(t, err)
+	assert.False(t, name.Valid)
+	assert.False(t, checksum.Valid)
+}
+
+func testRecordMigration_isApplied(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Exec("DROP TABLE goose_db_version")
+	_, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+
+	for _, direction := range []Direction{DirectionUp, DirectionDown} {
+		txn, err := db.Begin()
+		require.NoError(t, err)
+		err = recordMigration(context.Background(), conf, txn, direction, 20010203040506, filepath.Join(md, "20010203040506_setup.sql"))
+		require.NoError(t, err)
+		require.NoError(t, txn.Commit())
+
+		ms, err := MigrationStatus(conf, db)
+		require.NoError(t, err)
+		require.Len(t, ms, 1)
+		assert.Equal(t, bool(direction), ms[0].IsApplied, "%s", direction)
+	}
+}
+func TestRecordMigration_isApplied_sqlite3(t *testing.T) {
+	testRecordMigration_isApplied(t, getSqlite3Driver(t))
+}
+func TestRecordMigration_isApplied_mysql(t *testing.T) {
+	testRecordMigration_isApplied(t, getMysqlDriver(t))
+}
+func TestRecordMigration_isApplied_postgres(t *testing.T) {
+	testRecordMigration_isApplied(t, getPostgresDriver(t))
+}
+func TestRecordMigration_isApplied_redshift(t *testing.T) {
+	testRecordMigration_isApplied(t, getRedshiftDriver(t))
+}
+
+func TestMarkMigration(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = MarkMigration(conf, db, 20010203040506, DirectionUp)
+	require.NoError(t, err)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040506), current)
+	_, err = db.Exec("SELECT * FROM test")
+	assert.Error(t, err, "the migration should not have been run")
+
+	// already applied, so nothing more is recorded
+	err = MarkMigration(conf, db, 20010203040506, DirectionUp)
+	require.NoError(t, err)
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM goose_db_version WHERE version_id = 20010203040506").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	err = MarkMigration(conf, db, 20010203040506, DirectionDown)
+	require.NoError(t, err)
+	current, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), current)
+
+	err = MarkMigration(conf, db, 20010203040507, DirectionUp)
+	assert.Error(t, err)
+}
+
+func TestForceMigration(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// fixing an applied migration doesn't stop it being forced
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040508_two.sql"),
+		[]byte("-- +goose Up\nINSERT INTO test(value) VALUES('fixed');\n\n-- +goose Down\nDELETE FROM test;\n"),
+		0600)
+	require.NoError(t, err)
+
+	err = ForceMigration(conf, db, 20010203040508, DirectionUp)
+	require.NoError(t, err)
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040508), current)
+
+	// the forced run recorded the fixed migration's checksum
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	err = MarkMigration(conf, db, 20010203040508, DirectionDown)
+	require.NoError(t, err)
+	err = ForceMigration(conf, db, 20010203040508, DirectionDown)
+	require.NoError(t, err)
+	err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	current, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040506), current)
+
+	err = ForceMigration(conf, db, 20010203040507, DirectionUp)
+	assert.Error(t, err)
+}
+
+func TestRunMigrationFile(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	// the file isn't in the migrations dir
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+	hotfix := filepath.Join(td, "20200101000000_hotfix.sql")
+	err = ioutil.WriteFile(hotfix, []byte("-- +goose Up\nCREATE TABLE hotfix(id INT);\n\n-- +goose Down\nDROP TABLE hotfix;\n"), 0600)
+	require.NoError(t, err)
+
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	versionTableExists := func() bool {
+		exists, err := conf.Driver.Dialect.tableExists(context.Background(), db, conf.versionTable())
+		require.NoError(t, err)
+		return exists
+	}
+
+	// without recording it, the version table isn't touched
+	err = RunMigrationFile(conf, db, hotfix, DirectionUp, false)
+	require.NoError(t, err)
+	_, err = db.Exec("SELECT * FROM hotfix")
+	assert.NoError(t, err)
+	assert.False(t, versionTableExists())
+
+	err = RunMigrationFile(conf, db, hotfix, DirectionDown, true)
+	require.NoError(t, err)
+	_, err = db.Exec("SELECT * FROM hotfix")
+	assert.Error(t, err)
+	require.True(t, versionTableExists())
+	version, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	err = RunMigrationFile(conf, db, hotfix, DirectionUp, true)
+	require.NoError(t, err)
+	version, err = EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20200101000000), version)
+
+	// the section run must have statements
+	noDown := filepath.Join(td, "20200101000001_no_down.sql")
+	err = ioutil.WriteFile(noDown, []byte("-- +goose Up\nCREATE TABLE no_down(id INT);\n\n-- +goose Down\n"), 0600)
+	require.NoError(t, err)
+	err = RunMigrationFile(conf, db, noDown, DirectionDown, false)
+	assert.EqualError(t, err, "20200101000001_no_down.sql: the down section has no statements")
+
+	// only versioned files can be recorded
+	unversioned := filepath.Join(td, "hotfix.sql")
+	err = ioutil.WriteFile(unversioned, []byte("-- +goose Up\nCREATE TABLE unversioned(id INT);\n"), 0600)
+	require.NoError(t, err)
+	err = RunMigrationFile(conf, db, unversioned, DirectionUp, true)
+	assert.Error(t, err)
+	err = RunMigrationFile(conf, db, unversioned, DirectionUp, false)
+	assert.NoError(t, err)
+
+	err = RunMigrationFile(conf, db, filepath.Join(td, "20200101000002_hotfix.go"), DirectionUp, false)
+	assert.EqualError(t, err, "20200101000002_hotfix.go: only sql migrations can be run from a file")
+}
+
+func TestRollbackLastApplied(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RollbackLastApplied(conf, db)
+	assert.Equal(t, ErrNoPreviousVersion, err)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_one.sql"),
+		[]byte("-- +goose Up\nINSERT INTO test(value) VALUES('one');\n\n-- +goose Down\nDELETE FROM test WHERE value = 'one';\n"),
+		0600)
+	require.NoError(t, err)
+	conf.AllowMissing = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	ms, err := MigrationStatusInAppliedOrder(conf, db)
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+	assert.EqualValues(t, 20010203040506, ms[0].Version)
+	assert.EqualValues(t, 20010203040508, ms[1].Version)
+	assert.EqualValues(t, 20010203040507, ms[2].Version)
+
+	// 507 was applied last, though 508 is the current version
+	err = RollbackLastApplied(conf, db)
+	require.NoError(t, err)
+
+	var values []string
+	rows, err := db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	for rows.Next() {
+		var v string
+		require.NoError(t, rows.Scan(&v))
+		values = append(values, v)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"two"}, values)
+
+	ms, err = MigrationStatusInAppliedOrder(conf, db)
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+	assert.EqualValues(t, 20010203040507, ms[2].Version)
+	assert.False(t, ms[2].IsApplied)
+
+	err = RollbackLastApplied(conf, db)
+	require.NoError(t, err)
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040506, current)
+}
+
+func TestGetPreviousAppliedVersion(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = GetPreviousAppliedVersion(conf, db, 0)
+	assert.Equal(t, ErrNoPreviousVersion, err)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	// 507 is never applied
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_one.sql"),
+		[]byte("-- +goose Up\nINSERT INTO test(value) VALUES('one');\n\n-- +goose Down\nDELETE FROM test WHERE value = 'one';\n"),
+		0600)
+	require.NoError(t, err)
+
+	previous, err := GetPreviousDBVersion(md, 20010203040508)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040507, previous)
+
+	previous, err = GetPreviousAppliedVersion(conf, db, 20010203040508)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040506, previous)
+
+	previous, err = GetPreviousAppliedVersion(conf, db, 20010203040506)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, previous)
+}
+
+func TestBaselineDBVersion(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// the schema which existed before goose
+	_, err = db.Exec("CREATE TABLE test(value VARCHAR(20)); INSERT INTO test(value) VALUES('one');")
+	require.NoError(t, err)
+
+	err = BaselineDBVersion(conf, db, 20010203040509)
+	assert.Error(t, err, "not a migration")
+
+	err = BaselineDBVersion(conf, db, 20010203040507)
+	require.NoError(t, err)
+
+	ms, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+	assert.True(t, ms[0].IsApplied)
+	assert.True(t, ms[1].IsApplied)
+	assert.False(t, ms[2].IsApplied)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	err = BaselineDBVersion(conf, db, 20010203040507)
+	assert.Error(t, err, "already migrated")
+}
+
+func TestRunMigrationsOnDb_exclude(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql":  [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_manual.sql": [2]string{"INSERT INTO test(value) VALUES('manual');", "DELETE FROM test WHERE value = 'manual';"},
+		"20010203040508_two.sql":    [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	var buf bytes.Buffer
+	conf := &DBConf{
+		Driver:          getSqlite3Driver(t),
+		MigrationsDir:   md,
+		ExcludeVersions: []int64{20010203040507},
+		Output:          &buf,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "goose: skipping excluded migration 20010203040507_manual.sql")
+
+	var values []string
+	rows, err := db.Query("SELECT value FROM test")
+	require.NoError(t, err)
+	for rows.Next() {
+		var v string
+		require.NoError(t, rows.Scan(&v))
+		values = append(values, v)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"two"}, values)
+
+	ms, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	require.Len(t, ms, 3)
+	assert.False(t, ms[1].IsApplied)
+
+	// it may still be applied later on
+	conf.ExcludeVersions = nil
+	conf.AllowMissing = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM test WHERE value = 'manual'").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestRunMigrationsOnDb_minVersion(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+		"20010203040509_three.sql": [2]string{"INSERT INTO test(value) VALUES('three');", "DELETE FROM test WHERE value = 'three';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
 		MigrationsDir: md,
+		Output:        ioutil.Discard,
 	}
 
 	db, err := OpenDBFromDBConf(conf)
 	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
 
-	db.Exec("DROP TABLE goose_db_version")
-	db.Exec("DROP TABLE test")
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
 
+	conf.MinVersion = 20010203040508
 	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
 	require.NoError(t, err)
 
+	var values []string
 	rows, err := db.Query("SELECT value FROM test")
 	require.NoError(t, err)
-	defer rows.Close()
-	var values []string
 	for rows.Next() {
-		var value string
-		err := rows.Scan(&value)
-		require.NoError(t, err)
-		values = append(values, value)
+		var v string
+		require.NoError(t, rows.Scan(&v))
+		values = append(values, v)
 	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"two"}, values)
 
-	assert.Len(t, values, 2)
-	assert.Contains(t, values, "one")
-	assert.Contains(t, values, "two")
-}
-func TestRunMigrationsOnDb_sqlite3(t *testing.T) {
-	testRunMigrationsOnDb(t, getSqlite3Driver(t))
-}
-func TestRunMigrationsOnDb_mysql(t *testing.T) {
-	testRunMigrationsOnDb(t, getMysqlDriver(t))
-}
-func TestRunMigrationsOnDb_postgres(t *testing.T) {
-	testRunMigrationsOnDb(t, getPostgresDriver(t))
-}
-func TestRunMigrationsOnDb_redshift(t *testing.T) {
-	testRunMigrationsOnDb(t, getRedshiftDriver(t))
+	ms, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	require.Len(t, ms, 4)
+	assert.False(t, ms[1].IsApplied)
+	assert.True(t, ms[2].IsApplied)
+	assert.False(t, ms[3].IsApplied)
 }
 
-func testRunMigrationsOnDb_missingMiddle(t *testing.T, driver DBDriver) {
+func TestRunMigrationsOnDb_migrationType(t *testing.T) {
 	md, mdCleanup := setupMigrationsDir(map[string][2]string{
 		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
-		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
 		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
 	})
 	defer mdCleanup()
+	err := ioutil.WriteFile(filepath.Join(md, "20010203040507_go.go"),
+		[]byte("package main\n\nimport \"database/sql\"\n\nfunc Up_20010203040507(txn *sql.Tx) {}\nfunc Down_20010203040507(txn *sql.Tx) {}\n"),
+		0600)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
 	conf := &DBConf{
-		Driver:        driver,
+		Driver:        getSqlite3Driver(t),
 		MigrationsDir: md,
+		MigrationType: "sql",
+		Output:        &buf,
 	}
 
 	db, err := OpenDBFromDBConf(conf)
 	require.NoError(t, err)
+	defer db.Close()
 
-	db.Exec("DROP TABLE goose_db_version")
-	db.Exec("DROP TABLE test")
+	// the later sql migration may depend on the go one, so isn't applied
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "goose: skipping 20010203040507_go.go, only sql migrations are being run")
+	assert.Contains(t, buf.String(), "goose: skipping 20010203040508_two.sql, which may depend on 20010203040507_go.go")
 
-	// make the middle migration disappear for a moment
-	err = os.Rename(filepath.Join(md, "20010203040507_one.sql"), filepath.Join(md, "20010203040507_one.sql_"))
+	current, err := EnsureDBVersion(conf, db)
 	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040506, current)
 
+	conf.MigrationType = "rb"
 	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	assert.Error(t, err)
+}
+
+func TestRunMigrationsOnDb_hooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks use sh")
+	}
+
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_bad.sql":   [2]string{"INSERT INTO nonexistent(value) VALUES('bad');", ""},
+	})
+	defer mdCleanup()
+	hookLog := filepath.Join(md, "hooks.log")
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		BeforeMigrate: `echo "before $GOOSE_DIRECTION $GOOSE_TARGET" >> ` + hookLog,
+		AfterMigrate:  `echo "after $GOOSE_DIRECTION $GOOSE_TARGET $GOOSE_STATUS" >> ` + hookLog + `; exit 1`,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
 	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
 
-	rows, err := db.Query("SELECT value FROM test")
+	// the afterMigrate hook failing doesn't fail the run
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
 	require.NoError(t, err)
-	defer rows.Close()
-	var values []string
-	for rows.Next() {
-		var value string
-		err := rows.Scan(&value)
-		require.NoError(t, err)
-		values = append(values, value)
-	}
 
-	assert.Len(t, values, 1)
-	assert.Contains(t, values, "two")
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.Error(t, err)
 
-	// now put it back
-	err = os.Rename(filepath.Join(md, "20010203040507_one.sql_"), filepath.Join(md, "20010203040507_one.sql"))
+	// nothing to run, so no hooks
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
 	require.NoError(t, err)
 
-	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	log, err := ioutil.ReadFile(hookLog)
 	require.NoError(t, err)
+	assert.Equal(t, "before up 20010203040506\n"+
+		"after up 20010203040506 ok\n"+
+		"before up 20010203040507\n"+
+		"after up 20010203040507 failed\n", string(log))
 
-	rows, err = db.Query("SELECT value FROM test")
+	// the beforeMigrate hook failing aborts the run
+	conf.BeforeMigrate = "exit 1"
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.Error(t, err)
+
+	current, err := EnsureDBVersion(conf, db)
 	require.NoError(t, err)
-	defer rows.Close()
-	values = []string{}
-	for rows.Next() {
-		var value string
-		err := rows.Scan(&value)
-		require.NoError(t, err)
-		values = append(values, value)
-	}
+	assert.Equal(t, int64(20010203040506), current)
+}
 
-	assert.Len(t, values, 2)
-	assert.Contains(t, values, "one")
-	assert.Contains(t, values, "two")
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "1.2s", formatDuration(1234*time.Millisecond))
+	assert.Equal(t, "2m3.5s", formatDuration(123456*time.Millisecond))
+	assert.Equal(t, "15ms", formatDuration(15400*time.Microsecond))
+	assert.Equal(t, "250µs", formatDuration(250300*time.Nanosecond))
 }
-func TestRunMigrationsOnDb_missingMiddle_sqlite3(t *testing.T) {
-	testRunMigrationsOnDb_missingMiddle(t, getSqlite3Driver(t))
+
+func TestApplyMigrationsInTxn_unsupported(t *testing.T) {
+	ms := []*Migration{{Version: 1, Source: "1_setup.sql"}}
+	conf := &DBConf{Driver: newDBDriver("mysql", "")}
+	err := applyMigrationsInTxn(context.Background(), conf, nil, ms, DirectionUp)
+	assert.Error(t, err)
+	conf = &DBConf{Driver: newDBDriver("mariadb", "")}
+	err = applyMigrationsInTxn(context.Background(), conf, nil, ms, DirectionUp)
+	assert.Error(t, err)
+
+	ms = append(ms, &Migration{Version: 2, Source: "2_data.go"})
+	conf = &DBConf{Driver: getSqlite3Driver(t)}
+	err = applyMigrationsInTxn(context.Background(), conf, nil, ms, DirectionUp)
+	assert.Error(t, err)
 }
-func TestRunMigrationsOnDb_missingMiddle_mysql(t *testing.T) {
-	testRunMigrationsOnDb_missingMiddle(t, getMysqlDriver(t))
+
+func testRunMigrationsOnDb_schema(t *testing.T, driver DBDriver, createSchema string) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		Schema:        "goose_test",
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE goose_test.goose_db_version")
+	db.Exec("DROP TABLE test")
+	_, err = db.Exec(createSchema)
+	require.NoError(t, err)
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM goose_test.goose_db_version").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
 }
-func TestRunMigrationsOnDb_missingMiddle_postgres(t *testing.T) {
-	testRunMigrationsOnDb_missingMiddle(t, getPostgresDriver(t))
+func TestRunMigrationsOnDb_schema_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_schema(t, getSqlite3Driver(t), "ATTACH DATABASE ':memory:' AS goose_test")
 }
-func TestRunMigrationsOnDb_missingMiddle_redshift(t *testing.T) {
-	testRunMigrationsOnDb_missingMiddle(t, getRedshiftDriver(t))
+func TestRunMigrationsOnDb_schema_postgres(t *testing.T) {
+	testRunMigrationsOnDb_schema(t, getPostgresDriver(t), "CREATE SCHEMA IF NOT EXISTS goose_test")
 }
 
-func testRunMigrationsOnDb_down(t *testing.T, driver DBDriver) {
+func testRunMigrationsOnDb_modified(t *testing.T, driver DBDriver) {
 	md, mdCleanup := setupMigrationsDir(map[string][2]string{
 		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
 		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
-		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
 	})
 	defer mdCleanup()
 	conf := &DBConf{
@@ -299,98 +2920,272 @@ func testRunMigrationsOnDb_down(t *testing.T, driver DBDriver) {
 	db.Exec("DROP TABLE goose_db_version")
 	db.Exec("DROP TABLE test")
 
-	// up
-	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
 	require.NoError(t, err)
 
-	// down
+	// re-running without changes is fine
 	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
 	require.NoError(t, err)
 
-	rows, err := db.Query("SELECT value FROM test")
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_one.sql"),
+		[]byte("-- +goose Up\nINSERT INTO test(value) VALUES('uno');\n"), 0600)
 	require.NoError(t, err)
-	defer rows.Close()
-	var values []string
-	for rows.Next() {
-		var value string
-		err := rows.Scan(&value)
-		require.NoError(t, err)
-		values = append(values, value)
-	}
 
-	assert.Len(t, values, 1)
-	assert.Contains(t, values, "one")
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migration 20010203040507 has been modified since it was applied")
+
+	conf.SkipVerify = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	assert.NoError(t, err)
 }
-func TestRunMigrationsOnDb_down_sqlite3(t *testing.T) {
-	testRunMigrationsOnDb_down(t, getSqlite3Driver(t))
+func TestRunMigrationsOnDb_modified_sqlite3(t *testing.T) {
+	testRunMigrationsOnDb_modified(t, getSqlite3Driver(t))
 }
-func TestRunMigrationsOnDb_down_mysql(t *testing.T) {
-	testRunMigrationsOnDb_down(t, getMysqlDriver(t))
+func TestRunMigrationsOnDb_modified_mysql(t *testing.T) {
+	testRunMigrationsOnDb_modified(t, getMysqlDriver(t))
 }
-func TestRunMigrationsOnDb_down_postgres(t *testing.T) {
-	testRunMigrationsOnDb_down(t, getPostgresDriver(t))
+func TestRunMigrationsOnDb_modified_postgres(t *testing.T) {
+	testRunMigrationsOnDb_modified(t, getPostgresDriver(t))
 }
-func TestRunMigrationsOnDb_down_redshift(t *testing.T) {
-	testRunMigrationsOnDb_down(t, getRedshiftDriver(t))
+func TestRunMigrationsOnDb_modified_redshift(t *testing.T) {
+	testRunMigrationsOnDb_modified(t, getRedshiftDriver(t))
 }
 
-func testRunMigrationsOnDb_upDownUp(t *testing.T, driver DBDriver) {
+func TestEnsureDBVersion_upgradeTable(t *testing.T) {
+	conf := &DBConf{
+		Driver: getSqlite3Driver(t),
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	// the version table as created by older versions of goose
+	_, err = db.Exec(`CREATE TABLE goose_db_version (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	);`)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1), (20010203040506, 1)")
+	require.NoError(t, err)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040506), current)
+
+	_, err = db.Exec("SELECT checksum, name, direction, actor, actor_host FROM goose_db_version")
+	assert.NoError(t, err)
+}
+
+func TestRunMigrationsOnDb_actor(t *testing.T) {
 	md, mdCleanup := setupMigrationsDir(map[string][2]string{
 		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
-		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
-		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test;"},
 	})
 	defer mdCleanup()
 	conf := &DBConf{
-		Driver:        driver,
+		Driver:        getSqlite3Driver(t),
 		MigrationsDir: md,
+		Output:        ioutil.Discard,
+		Actor:         "deploy-bot",
+		ActorHost:     "ci-runner-3",
 	}
 
 	db, err := OpenDBFromDBConf(conf)
 	require.NoError(t, err)
+	defer db.Close()
 
-	db.Exec("DROP TABLE goose_db_version")
-	db.Exec("DROP TABLE test")
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
 
-	// up
-	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	// by default, the OS user and hostname are recorded
+	conf.Actor, conf.ActorHost = "", ""
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
 	require.NoError(t, err)
+	wantActor, wantHost := conf.actor()
+	assert.NotEmpty(t, wantHost)
 
-	// down
-	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	migs, err := MigrationStatus(conf, db)
 	require.NoError(t, err)
+	require.Len(t, migs, 2)
+	assert.Equal(t, "deploy-bot", migs[0].Actor)
+	assert.Equal(t, "ci-runner-3", migs[0].ActorHost)
+	assert.Equal(t, wantActor, migs[1].Actor)
+	assert.Equal(t, wantHost, migs[1].ActorHost)
 
-	rows, err := db.Query("SELECT value FROM test")
-	require.Error(t, err) // table won't exist
+	// rolling back records who did it
+	conf.Actor, conf.ActorHost = "oncall", "laptop"
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+	migs, err = MigrationStatus(conf, db)
+	require.NoError(t, err)
+	assert.False(t, migs[1].IsApplied)
+	assert.Equal(t, "oncall", migs[1].Actor)
+	assert.Equal(t, "laptop", migs[1].ActorHost)
 
-	// up
-	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	records, err := VersionRecords(conf, db)
 	require.NoError(t, err)
+	require.NotEmpty(t, records)
+	assert.Equal(t, "oncall", records[len(records)-1].Actor)
+}
 
-	rows, err = db.Query("SELECT value FROM test")
+func TestRunMigrationsOnDb_direction(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT is_applied, direction FROM goose_db_version WHERE version_id = 20010203040506 ORDER BY id")
 	require.NoError(t, err)
 	defer rows.Close()
-	var values []string
+	var history []string
 	for rows.Next() {
-		var value string
-		err := rows.Scan(&value)
-		require.NoError(t, err)
-		values = append(values, value)
+		var applied bool
+		var direction string
+		require.NoError(t, rows.Scan(&applied, &direction))
+		history = append(history, fmt.Sprintf("%v %s", applied, direction))
 	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []string{"true up", "false down"}, history)
+}
 
-	assert.Len(t, values, 2)
-	assert.Contains(t, values, "one")
-	assert.Contains(t, values, "two")
+// scanVersionsDialect always finds the current version by scanning the
+// version table.
+type scanVersionsDialect struct {
+	Sqlite3Dialect
 }
-func TestRunMigrationsOnDb_upDownUp_sqlite3(t *testing.T) {
-	testRunMigrationsOnDb_upDownUp(t, getSqlite3Driver(t))
+
+func (scanVersionsDialect) currentVersionSql(table string) string {
+	return ""
 }
-func TestRunMigrationsOnDb_upDownUp_mysql(t *testing.T) {
-	testRunMigrationsOnDb_upDownUp(t, getMysqlDriver(t))
+
+func TestDBVersion_rolledBack(t *testing.T) {
+	for _, dialect := range []SqlDialect{Sqlite3Dialect{}, scanVersionsDialect{}} {
+		driver := getSqlite3Driver(t)
+		driver.Dialect = dialect
+		conf := &DBConf{
+			Driver: driver,
+		}
+
+		db, err := OpenDBFromDBConf(conf)
+		require.NoError(t, err)
+		defer db.Close()
+
+		_, err = EnsureDBVersion(conf, db)
+		require.NoError(t, err)
+
+		// 3 and 4 were rolled back, and 2 was reapplied after being rolled back
+		for _, row := range [][2]int64{{1, 1}, {2, 1}, {3, 1}, {3, 0}, {2, 0}, {2, 1}, {4, 1}, {4, 0}} {
+			_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (?, ?)", row[0], row[1])
+			require.NoError(t, err)
+		}
+
+		current, err := dbVersion(context.Background(), conf, db)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), current, "%T", dialect)
+
+		// everything rolled back
+		_, err = db.Exec("DELETE FROM goose_db_version")
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (1, 1), (1, 0)")
+		require.NoError(t, err)
+
+		current, err = dbVersion(context.Background(), conf, db)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), current, "%T", dialect)
+	}
 }
-func TestRunMigrationsOnDb_upDownUp_postgres(t *testing.T) {
-	testRunMigrationsOnDb_upDownUp(t, getPostgresDriver(t))
+
+// createTableDialect creates the version table without IF NOT EXISTS.
+type createTableDialect struct {
+	Sqlite3Dialect
 }
-func TestRunMigrationsOnDb_upDownUp_redshift(t *testing.T) {
-	testRunMigrationsOnDb_upDownUp(t, getRedshiftDriver(t))
+
+func (createTableDialect) createVersionTableSql(table string) string {
+	return "CREATE TABLE " + table + " (id INTEGER PRIMARY KEY AUTOINCREMENT, version_id INTEGER NOT NULL, is_applied INTEGER NOT NULL, tstamp TIMESTAMP DEFAULT (datetime('now')), name TEXT NULL, checksum TEXT NULL, direction TEXT NULL, actor TEXT NULL, actor_host TEXT NULL);"
+}
+
+func TestCreateVersionTable_exists(t *testing.T) {
+	for _, dialect := range []SqlDialect{Sqlite3Dialect{}, createTableDialect{}} {
+		driver := getSqlite3Driver(t)
+		driver.Dialect = dialect
+		conf := &DBConf{
+			Driver: driver,
+		}
+
+		db, err := OpenDBFromDBConf(conf)
+		require.NoError(t, err)
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		// as if another process created the table first
+		for i := 0; i < 2; i++ {
+			err = createVersionTable(context.Background(), conf, db)
+			assert.NoError(t, err, "%T", dialect)
+		}
+
+		current, err := EnsureDBVersion(conf, db)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), current)
+	}
+}
+
+func TestEnsureDBVersion_noInitialVersion(t *testing.T) {
+	for _, noInitial := range []bool{false, true} {
+		md, mdCleanup := setupMigrationsDir(map[string][2]string{
+			"001_foo.sql": {"CREATE TABLE foo (id INTEGER);", "DROP TABLE foo;"},
+		})
+		defer mdCleanup()
+
+		conf := &DBConf{
+			MigrationsDir:    md,
+			Driver:           getSqlite3Driver(t),
+			NoInitialVersion: noInitial,
+		}
+		db, err := OpenDBFromDBConf(conf)
+		require.NoError(t, err)
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		current, err := EnsureDBVersion(conf, db)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), current)
+
+		var rows int
+		err = db.QueryRow("SELECT COUNT(*) FROM goose_db_version WHERE version_id = 0").Scan(&rows)
+		require.NoError(t, err)
+		if noInitial {
+			assert.Equal(t, 0, rows)
+		} else {
+			assert.Equal(t, 1, rows)
+		}
+
+		err = RunMigrationsOnDb(conf, md, 1, db)
+		require.NoError(t, err, "noInitialVersion=%t", noInitial)
+		current, err = EnsureDBVersion(conf, db)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), current)
+
+		err = RunMigrationsOnDb(conf, md, 0, db)
+		require.NoError(t, err, "noInitialVersion=%t", noInitial)
+		current, err = EnsureDBVersion(conf, db)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), current)
+	}
 }
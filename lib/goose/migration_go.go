@@ -1,87 +1,68 @@
 package goose
 
 import (
-	"bytes"
 	"encoding/gob"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"os"
-	"os/exec"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"path/filepath"
 	"strings"
 )
 
-type templateData struct {
-	Version    int64
-	Import     string
-	Conf       string // gob encoded DBConf
-	Direction  Direction
-	Func       string
-	InsertStmt string
-}
-
 func init() {
 	gob.Register(PostgresDialect{})
 	gob.Register(MySqlDialect{})
+	gob.Register(MariaDBDialect{})
 	gob.Register(Sqlite3Dialect{})
+	gob.Register(RedshiftDialect{})
+	gob.Register(OracleDialect{})
+	gob.Register(PlaceholderDialect{})
 }
 
-//
-// Run a .go migration.
-//
-// In order to do this, we copy a modified version of the
-// original .go migration, and execute it via `go run` along
-// with a main() of our own creation.
-//
-func runGoMigration(conf *DBConf, path string, version int64, direction Direction) error {
-	// everything gets written to a temp dir, and zapped afterwards
-	d, e := ioutil.TempDir("", "goose")
-	if e != nil {
-		log.Fatal(e)
-	}
-	defer os.RemoveAll(d)
-
-	var bb bytes.Buffer
-	if err := gob.NewEncoder(&bb).Encode(conf); err != nil {
-		return err
-	}
-
-	// XXX: there must be a better way of making this byte array
-	// available to the generated code...
-	// but for now, print an array literal of the gob bytes
-	var sb bytes.Buffer
-	sb.WriteString("[]byte{ ")
-	for _, b := range bb.Bytes() {
-		sb.WriteString(fmt.Sprintf("0x%02x, ", b))
-	}
-	sb.WriteString("}")
+// goMigrationFunc returns the name of the function implementing the given
+// direction of a Go migration.
+func goMigrationFunc(direction Direction, version int64) string {
+	return fmt.Sprintf("%v_%v", strings.Title(direction.String()), version)
+}
 
-	td := &templateData{
-		Version:    version,
-		Import:     conf.Driver.Import,
-		Conf:       sb.String(),
-		Direction:  direction,
-		Func:       fmt.Sprintf("%v_%v", strings.ToTitle(direction.String()), version),
-		InsertStmt: conf.Driver.Dialect.insertVersionSql(),
+// goMigrationFuncs parses the Go migration at path, and returns its top level
+// funcs by name.
+func goMigrationFuncs(path string) (map[string]*ast.FuncDecl, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+	if err != nil {
+		return nil, err
 	}
 
-	main, e := writeTemplateToFile(filepath.Join(d, "goose_main.go"), goMigrationDriverTemplate, td)
-	if e != nil {
-		log.Fatal(e)
+	funcs := map[string]*ast.FuncDecl{}
+	for _, decl := range f.Decls {
+		if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil {
+			funcs[fd.Name.Name] = fd
+		}
 	}
+	return funcs, nil
+}
 
-	outpath := filepath.Join(d, filepath.Base(path))
-	if _, e = copyFile(outpath, path); e != nil {
-		log.Fatal(e)
-	}
+// returnsError reports whether the migration func returns an error. Otherwise
+// it returns nothing, as migration funcs originally did.
+func returnsError(fn *ast.FuncDecl) bool {
+	return fn.Type.Results.NumFields() == 1
+}
 
-	cmd := exec.Command("go", "run", main, outpath)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if e = cmd.Run(); e != nil {
-		log.Fatal("`go run` failed: ", e)
+// validMigrationFunc reports whether fn returns nothing or an error, as the
+// generated main expects.
+func validMigrationFunc(fn *ast.FuncDecl) bool {
+	results := fn.Type.Results
+	switch results.NumFields() {
+	case 0:
+		return true
+	case 1:
+		ident, ok := results.List[0].Type.(*ast.Ident)
+		return ok && ident.Name == "error"
 	}
+	return false
+}
 
-	return nil
+func errGoMigrationsUnsupported(path string) error {
+	return fmt.Errorf("%s: go migrations are not supported by this build of goose", filepath.Base(path))
 }
@@ -0,0 +1,247 @@
+// +build !nogomigrations
+
+package goose
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// goMigrationsSupported is false when built with the nogomigrations tag.
+const goMigrationsSupported = true
+
+type templateData struct {
+	Version  int64
+	Import   string
+	Conf     string // gob encoded DBConf
+	UpFunc   string
+	DownFunc string
+	// whether the funcs return an error, rather than nothing
+	UpReturnsError   bool
+	DownReturnsError bool
+	InsertStmt       string
+	Source           string
+}
+
+// Run a .go migration.
+//
+// In order to do this, we copy a modified version of the
+// original .go migration, and execute it via `go run` along
+// with a main() of our own creation.
+func runGoMigration(ctx context.Context, conf *DBConf, path string, version int64, direction Direction) (err error) {
+	if conf.Driver.Import == "" || conf.Driver.Name == "" {
+		return fmt.Errorf("%s: go migrations need the driver's name and import path to open the DB", filepath.Base(path))
+	}
+
+	funcs, err := goMigrationFuncs(path)
+	if err != nil {
+		return err
+	}
+	upFunc := goMigrationFunc(DirectionUp, version)
+	downFunc := goMigrationFunc(DirectionDown, version)
+	for _, name := range []string{upFunc, downFunc} {
+		if funcs[name] == nil {
+			return fmt.Errorf("%s: missing func %s", filepath.Base(path), name)
+		}
+		if !validMigrationFunc(funcs[name]) {
+			return fmt.Errorf("%s: func %s must return an error or nothing", filepath.Base(path), name)
+		}
+	}
+
+	// everything gets written to a temp dir, and zapped afterwards, unless
+	// it's kept to debug a failure
+	d, e := ioutil.TempDir("", "goose")
+	if e != nil {
+		log.Fatal(e)
+	}
+	defer func() {
+		if err != nil && conf.KeepTemp {
+			conf.logger().Printf("goose: kept the generated goose_main.go and %s in %s\n", filepath.Base(path), d)
+			return
+		}
+		os.RemoveAll(d)
+	}()
+
+	// the output and observer can't be sent to the migration
+	encConf := *conf
+	encConf.Output = nil
+	encConf.Observer = nil
+
+	var bb bytes.Buffer
+	if err := gob.NewEncoder(&bb).Encode(&encConf); err != nil {
+		return err
+	}
+
+	// XXX: there must be a better way of making this byte array
+	// available to the generated code...
+	// but for now, print an array literal of the gob bytes
+	var sb bytes.Buffer
+	sb.WriteString("[]byte{ ")
+	for _, b := range bb.Bytes() {
+		sb.WriteString(fmt.Sprintf("0x%02x, ", b))
+	}
+	sb.WriteString("}")
+
+	td := &templateData{
+		Version:          version,
+		Import:           conf.Driver.Import,
+		Conf:             sb.String(),
+		UpFunc:           upFunc,
+		DownFunc:         downFunc,
+		UpReturnsError:   returnsError(funcs[upFunc]),
+		DownReturnsError: returnsError(funcs[downFunc]),
+		InsertStmt:       conf.rebind(conf.Driver.Dialect.insertVersionSql(conf.versionTable())),
+		Source:           path,
+	}
+
+	main, e := writeTemplateToFile(filepath.Join(d, "goose_main.go"), goMigrationDriverTemplate, td)
+	if e != nil {
+		log.Fatal(e)
+	}
+
+	// go run needs the .go extension, which a registered one may not be
+	base := filepath.Base(path)
+	outpath := filepath.Join(d, strings.TrimSuffix(base, filepath.Ext(base))+".go")
+	if _, e = copyFile(outpath, path); e != nil {
+		log.Fatal(e)
+	}
+
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if conf.Output != nil {
+		stdout, stderr = conf.Output, conf.Output
+	}
+
+	goCmd, goFlags := conf.goCommand()
+	var cmd *exec.Cmd
+	if conf.CompileGoMigrations {
+		bin, err := goBinaries.build(ctx, stdout, stderr, goCmd, goFlags, main, outpath)
+		if err != nil {
+			return err
+		}
+		cmd = exec.CommandContext(ctx, bin, direction.String())
+	} else {
+		args := append([]string{"run"}, goFlags...)
+		cmd = exec.CommandContext(ctx, goCmd, append(args, main, outpath, direction.String())...)
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if e = cmd.Run(); e != nil {
+		if conf.CompileGoMigrations {
+			return fmt.Errorf("running %s failed: %s", filepath.Base(path), e)
+		}
+		return fmt.Errorf("`go run` failed: %s", e)
+	}
+
+	return nil
+}
+
+// goCommand returns the go tool, and the extra flags for it, that Go
+// migrations are run or built with, from DBConf.GoCommand and GoFlags, or
+// else the GOOSE_GO_CMD and GOOSE_GO_FLAGS environment variables.
+func (c *DBConf) goCommand() (string, []string) {
+	goCmd := c.GoCommand
+	if goCmd == "" {
+		goCmd = os.Getenv("GOOSE_GO_CMD")
+	}
+	if goCmd == "" {
+		goCmd = "go"
+	}
+	goFlags := c.GoFlags
+	if goFlags == nil {
+		goFlags = strings.Fields(os.Getenv("GOOSE_GO_FLAGS"))
+	}
+	return goCmd, goFlags
+}
+
+// goBinaryCache holds the binaries built for Go migrations, keyed by the hash
+// of their sources, so that each is only built once per process.
+type goBinaryCache struct {
+	mu   sync.Mutex
+	dir  string
+	bins map[string]string
+}
+
+var goBinaries = &goBinaryCache{}
+
+// build returns the path of a binary built from the given Go files, with
+// goCmd and goFlags, building it if it isn't already cached.
+func (c *goBinaryCache) build(ctx context.Context, stdout, stderr io.Writer, goCmd string, goFlags []string, srcs ...string) (string, error) {
+	h := sha256.New()
+	// another toolchain, or flags, may build another binary
+	fmt.Fprintf(h, "%s %q\n", goCmd, goFlags)
+	for _, src := range srcs {
+		bs, err := ioutil.ReadFile(src)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %d\n", filepath.Base(src), len(bs))
+		h.Write(bs)
+	}
+	key := hex.EncodeToString(h.Sum(nil))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if bin, ok := c.bins[key]; ok {
+		return bin, nil
+	}
+
+	if c.dir == "" {
+		dir, err := ioutil.TempDir("", "goose-bin")
+		if err != nil {
+			return "", err
+		}
+		c.dir = dir
+		c.bins = map[string]string{}
+	}
+
+	bin := filepath.Join(c.dir, key)
+	if runtime.GOOS == "windows" {
+		bin += ".exe"
+	}
+
+	args := append(append([]string{"build"}, goFlags...), "-o", bin)
+	cmd := exec.CommandContext(ctx, goCmd, append(args, srcs...)...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("`go build` failed: %s", err)
+	}
+
+	c.bins[key] = bin
+	return bin, nil
+}
+
+// cleanup removes all the cached binaries.
+func (c *goBinaryCache) cleanup() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(c.dir)
+	c.dir = ""
+	c.bins = nil
+	return err
+}
+
+// CleanupGoMigrationCache removes the binaries built for Go migrations when
+// DBConf.CompileGoMigrations is set. It should be called once migrating is
+// done.
+func CleanupGoMigrationCache() error {
+	return goBinaries.cleanup()
+}
@@ -0,0 +1,20 @@
+// +build nogomigrations
+
+package goose
+
+import (
+	"context"
+)
+
+// Go migrations are compiled out by the nogomigrations tag, for binaries
+// which run without a Go toolchain.
+const goMigrationsSupported = false
+
+func runGoMigration(ctx context.Context, conf *DBConf, path string, version int64, direction Direction) error {
+	return errGoMigrationsUnsupported(path)
+}
+
+// CleanupGoMigrationCache does nothing, as Go migrations aren't supported.
+func CleanupGoMigrationCache() error {
+	return nil
+}
@@ -0,0 +1,39 @@
+// +build nogomigrations
+
+package goose
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMigrationsOnDb_goMigrationsDisabled(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+
+	err := ioutil.WriteFile(filepath.Join(md, "20010203040507_go.go"),
+		[]byte("package main\n\nimport \"database/sql\"\n\nfunc Up_20010203040507(txn *sql.Tx) {}\nfunc Down_20010203040507(txn *sql.Tx) {}\n"),
+		0600)
+	require.NoError(t, err)
+
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	assert.EqualError(t, err, "20010203040507_go.go: go migrations are not supported by this build of goose")
+
+	// nothing was run
+	_, err = db.Exec("SELECT * FROM test")
+	assert.Error(t, err)
+}
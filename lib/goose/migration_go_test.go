@@ -0,0 +1,216 @@
+// +build !nogomigrations
+
+package goose
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoBinaryCache(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("building needs the go tool")
+	}
+
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	src := filepath.Join(td, "main.go")
+	err = ioutil.WriteFile(src, []byte("package main\n\nfunc main() { println(1) }\n"), 0600)
+	require.NoError(t, err)
+
+	c := &goBinaryCache{}
+	defer c.cleanup()
+
+	bin, err := c.build(context.Background(), ioutil.Discard, ioutil.Discard, "go", nil, src)
+	require.NoError(t, err)
+	require.NoError(t, exec.Command(bin).Run())
+
+	// the same source is only built once
+	require.NoError(t, os.Remove(bin))
+	again, err := c.build(context.Background(), ioutil.Discard, ioutil.Discard, "go", nil, src)
+	require.NoError(t, err)
+	assert.Equal(t, bin, again)
+
+	err = ioutil.WriteFile(src, []byte("package main\n\nfunc main() { println(2) }\n"), 0600)
+	require.NoError(t, err)
+	changed, err := c.build(context.Background(), ioutil.Discard, ioutil.Discard, "go", nil, src)
+	require.NoError(t, err)
+	assert.NotEqual(t, bin, changed)
+
+	dir := c.dir
+	require.NoError(t, c.cleanup())
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunGoMigration_error(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go migrations need the go tool")
+	}
+
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	migrations := map[string]string{
+		// the original form, without an error
+		"001_noerror.go": `package main
+
+import "database/sql"
+
+func Up_1(txn *sql.Tx) {
+	txn.Exec("CREATE TABLE one(value TEXT)")
+}
+
+func Down_1(txn *sql.Tx) {}
+`,
+		"002_error.go": `package main
+
+import (
+	"database/sql"
+	"errors"
+)
+
+func Up_2(txn *sql.Tx) error {
+	if _, err := txn.Exec("CREATE TABLE two(value TEXT)"); err != nil {
+		return err
+	}
+	return errors.New("oops")
+}
+
+func Down_2(txn *sql.Tx) error {
+	return nil
+}
+`,
+	}
+	for name, src := range migrations {
+		err := ioutil.WriteFile(filepath.Join(md, name), []byte(src), 0600)
+		require.NoError(t, err)
+	}
+
+	driver := newDBDriver("sqlite3", filepath.Join(md, "goose.db"))
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 2, db)
+	assert.Error(t, err)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, current)
+
+	_, err = db.Exec("SELECT * FROM one")
+	assert.NoError(t, err)
+	// the failed migration's changes were rolled back with its version
+	_, err = db.Exec("SELECT * FROM two")
+	assert.Error(t, err)
+}
+
+func TestRunGoMigration_keepTemp(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go migrations need the go tool")
+	}
+
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	err := ioutil.WriteFile(filepath.Join(md, "001_broken.go"), []byte(`package main
+
+import "database/sql"
+
+func Up_1(txn *sql.Tx) {
+	undefined()
+}
+
+func Down_1(txn *sql.Tx) {}
+`), 0600)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	conf := &DBConf{
+		Driver:        newDBDriver("sqlite3", filepath.Join(md, "goose.db")),
+		MigrationsDir: md,
+		Output:        &buf,
+		KeepTemp:      true,
+	}
+
+	err = runGoMigration(context.Background(), conf, filepath.Join(md, "001_broken.go"), 1, DirectionUp)
+	require.Error(t, err)
+
+	m := regexp.MustCompile(`goose: kept the generated goose_main.go and 001_broken.go in (.*)\n`).FindStringSubmatch(buf.String())
+	require.NotNil(t, m, buf.String())
+	defer os.RemoveAll(m[1])
+	for _, name := range []string{"goose_main.go", "001_broken.go"} {
+		_, err = os.Stat(filepath.Join(m[1], name))
+		assert.NoError(t, err)
+	}
+}
+
+func TestRunGoMigration_goCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake go tool is a shell script")
+	}
+
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	err := ioutil.WriteFile(filepath.Join(md, "001_one.go"), []byte(`package main
+
+import "database/sql"
+
+func Up_1(txn *sql.Tx) {}
+
+func Down_1(txn *sql.Tx) {}
+`), 0600)
+	require.NoError(t, err)
+
+	// a go tool recording how it's run
+	argsFile := filepath.Join(md, "args.txt")
+	goCmd := filepath.Join(md, "fakego")
+	err = ioutil.WriteFile(goCmd, []byte("#!/bin/sh\necho \"$@\" >> "+argsFile+"\n"), 0700)
+	require.NoError(t, err)
+
+	conf := &DBConf{
+		Driver:        newDBDriver("sqlite3", filepath.Join(md, "goose.db")),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+		GoCommand:     goCmd,
+		GoFlags:       []string{"-mod=vendor", "-tags=integration"},
+	}
+	err = runGoMigration(context.Background(), conf, filepath.Join(md, "001_one.go"), 1, DirectionUp)
+	require.NoError(t, err)
+
+	c := &goBinaryCache{}
+	defer c.cleanup()
+	goCmd, goFlags := conf.goCommand()
+	_, err = c.build(context.Background(), ioutil.Discard, ioutil.Discard, goCmd, goFlags, filepath.Join(md, "001_one.go"))
+	require.NoError(t, err)
+
+	bs, err := ioutil.ReadFile(argsFile)
+	require.NoError(t, err)
+	assert.Regexp(t, `^run -mod=vendor -tags=integration \S+/goose_main.go \S+/001_one.go up\nbuild -mod=vendor -tags=integration -o \S+ \S+/001_one.go\n$`, string(bs))
+
+	// the flags default to the environment's
+	defer os.Setenv("GOOSE_GO_FLAGS", os.Getenv("GOOSE_GO_FLAGS"))
+	os.Setenv("GOOSE_GO_FLAGS", " -mod=mod  -v ")
+	_, goFlags = (&DBConf{}).goCommand()
+	assert.Equal(t, []string{"-mod=mod", "-v"}, goFlags)
+}
@@ -3,16 +3,182 @@ package goose
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
 const sqlCmdPrefix = "-- +goose "
 
+// gzipExt follows .sql in the names of gzip compressed SQL migrations, e.g.
+// 001_init.sql.gz.
+const gzipExt = ".gz"
+
+// migrationExts maps the extensions added with RegisterMigrationExtension
+// to the type of their migrations, .sql or .go.
+var migrationExts = map[string]string{}
+
+// RegisterMigrationExtension makes files with the extension ext, e.g.
+// ".psql", migrations of the given type, "sql" or "go", in addition to .sql
+// and .go files, so they're collected and run as such. It isn't safe to call
+// concurrently with collecting or running migrations.
+func RegisterMigrationExtension(ext, migrationType string) {
+	if migrationType != "sql" && migrationType != "go" {
+		panic(fmt.Sprintf("goose: unknown migration type %q for %s, expected sql or go", migrationType, ext))
+	}
+	migrationExts[ext] = "." + migrationType
+}
+
+// migrationExt returns the type of the migration at path, .sql or .go, or
+// otherwise its extension. Compressed .sql.gz scripts are .sql, as are those
+// with an extension registered as sql, and split migrations.
+func migrationExt(path string) string {
+	ext := filepath.Ext(path)
+	if ext == gzipExt && migrationExt(strings.TrimSuffix(path, ext)) == ".sql" {
+		return ".sql"
+	}
+	if t, ok := migrationExts[ext]; ok {
+		return t
+	}
+	if ext != ".sql" && ext != ".go" && isSplitMigration(path) {
+		return ".sql"
+	}
+	return ext
+}
+
+// The files of a split SQL migration, which is a directory named like a
+// migration file, e.g. 00001_add_users/, holding its Up statements in
+// up.sql and its Down statements in down.sql, as other migration tools
+// lay them out.
+const (
+	splitUpFile   = "up.sql"
+	splitDownFile = "down.sql"
+)
+
+// isSplitMigration reports whether path is the directory of a split SQL
+// migration. Its down.sql may be missing, leaving the Down section empty.
+func isSplitMigration(path string) bool {
+	info, err := os.Stat(filepath.Join(path, splitUpFile))
+	return err == nil && !info.IsDir()
+}
+
+// openSplitMigration reads the split migration in dir as a single script,
+// annotated with the Up and Down sections of its files.
+func openSplitMigration(dir string) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	for _, section := range []struct{ cmd, file string }{{"Up", splitUpFile}, {"Down", splitDownFile}} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, section.file))
+		if os.IsNotExist(err) && section.file == splitDownFile {
+			err = nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(sqlCmdPrefix + section.cmd + "\n")
+		buf.Write(b)
+		if len(b) > 0 && b[len(b)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+// SplitSQLMigration moves the SQL migration at path, e.g. one just created
+// by CreateMigration, into a split migration: a directory named like it,
+// without the .sql extension, holding its Up section in up.sql and its Down
+// section in down.sql. It returns the directory's path. Any lines before
+// the Up section, such as a '-- +goose NO TRANSACTION' annotation, are kept
+// at the top of up.sql.
+func SplitSQLMigration(path string) (string, error) {
+	if filepath.Ext(path) != ".sql" {
+		return "", fmt.Errorf("%s: only uncompressed .sql migrations can be split", filepath.Base(path))
+	}
+	script, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var up, down bytes.Buffer
+	section := &up
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, sqlCmdPrefix) {
+			switch strings.TrimSpace(line[len(sqlCmdPrefix):]) {
+			case "Up":
+				section = &up
+				continue
+			case "Down":
+				section = &down
+				continue
+			}
+		}
+		section.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	dir := strings.TrimSuffix(path, ".sql")
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return "", err
+	}
+	for file, b := range map[string][]byte{splitUpFile: up.Bytes(), splitDownFile: down.Bytes()} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), b, 0666); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	if err := os.Remove(path); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// openMigration opens the migration at path, decompressing it if it's
+// gzipped, or joining its files if it's split.
+func openMigration(path string) (io.ReadCloser, error) {
+	if isSplitMigration(path) {
+		return openSplitMigration(path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != gzipExt {
+		return f, nil
+	}
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %s", filepath.Base(path), err)
+	}
+	return gzipFile{zr, f}, nil
+}
+
+// gzipFile reads a gzipped file, closing the file with the reader.
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
 // Checks the line to see if the line has a statement-ending semicolon
 // or if the line contains a double-dash comment.
 func endsWithSemicolon(line string) bool {
@@ -41,7 +207,133 @@ func endsWithSemicolon(line string) bool {
 // within a statement. For these cases, we provide the explicit annotations
 // 'StatementBegin' and 'StatementEnd' to allow the script to
 // tell us to ignore semicolons.
-func splitSQLStatements(r io.Reader, direction Direction) (stmts []string) {
+func splitSQLStatements(r io.Reader, direction Direction) []string {
+	stmts, err := parseSQLStatements(r, direction)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return stmts
+}
+
+// ParseSQLMigration splits the SQL migration read from r into the
+// statements goose runs for its Up and Down sections, exactly as they're
+// run, and reports whether it's annotated with '-- +goose NO TRANSACTION'.
+// References to environment variables allowed by '-- +goose ENV' are left
+// as written, as they're only expanded when the migration is run.
+func ParseSQLMigration(r io.Reader) (up []string, down []string, noTransaction bool, err error) {
+	script, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if up, err = parseSQLStatements(bytes.NewReader(script), DirectionUp); err != nil {
+		return nil, nil, false, err
+	}
+	if down, err = parseSQLStatements(bytes.NewReader(script), DirectionDown); err != nil {
+		return nil, nil, false, err
+	}
+	if noTransaction, err = hasSQLAnnotation(bytes.NewReader(script), sqlNoTransactionCmd); err != nil {
+		return nil, nil, false, err
+	}
+	return up, down, noTransaction, nil
+}
+
+// DefaultDestructiveKeywords are the keywords of the statements
+// DestructiveStatements finds when no others are given.
+var DefaultDestructiveKeywords = []string{"DROP TABLE", "DROP COLUMN"}
+
+// DestructiveStatements returns the statements of the Down section of the
+// SQL migration read from r which contain any of the keywords, e.g. DROP
+// TABLE, ignoring case and how the words are spaced, and comments. The
+// statements are returned without their comment lines, such as goose
+// annotations. With no keywords, DefaultDestructiveKeywords are looked for.
+func DestructiveStatements(r io.Reader, keywords []string) ([]string, error) {
+	_, down, _, err := ParseSQLMigration(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(keywords) == 0 {
+		keywords = DefaultDestructiveKeywords
+	}
+
+	var destructive []string
+	for _, stmt := range down {
+		stmt = stripSQLCommentLines(stmt)
+		normalized := " " + strings.Join(strings.Fields(strings.ToUpper(stripSQLLineComments(stmt))), " ") + " "
+		for _, k := range keywords {
+			k = " " + strings.Join(strings.Fields(strings.ToUpper(k)), " ") + " "
+			if strings.Contains(normalized, k) {
+				destructive = append(destructive, stmt)
+				break
+			}
+		}
+	}
+	return destructive, nil
+}
+
+// stripSQLCommentLines returns stmt without its blank and comment lines.
+func stripSQLCommentLines(stmt string) string {
+	var lines []string
+	for _, line := range strings.Split(stmt, "\n") {
+		if isSQLStatementLine(line) {
+			lines = append(lines, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// stripSQLLineComments removes the -- comments at the end of stmt's lines,
+// leaving any -- within quotes alone.
+func stripSQLLineComments(stmt string) string {
+	lines := strings.Split(stmt, "\n")
+	for i, line := range lines {
+		var quote byte
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+			switch {
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case c == '\'' || c == '"':
+				quote = c
+			case c == '-' && strings.HasPrefix(line[j:], "--"):
+				line = line[:j]
+			}
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// checkDestructive returns an error if any of the SQL migrations to roll
+// back has destructive statements, for DBConf.Protected.
+func checkDestructive(conf *DBConf, ms []*Migration) error {
+	var destructive []string
+	for _, m := range ms {
+		if migrationExt(m.Source) != ".sql" {
+			continue
+		}
+		r, err := readSQLMigration(m.Source)
+		if err != nil {
+			return err
+		}
+		stmts, err := DestructiveStatements(r, conf.DestructiveKeywords)
+		if err != nil {
+			return fmt.Errorf("%s: %s", filepath.Base(m.Source), err)
+		}
+		if len(stmts) > 0 {
+			destructive = append(destructive, filepath.Base(m.Source))
+		}
+	}
+	if len(destructive) > 0 {
+		return fmt.Errorf("refusing to roll back %s in a protected environment, as they destroy data; confirm to run them", strings.Join(destructive, ", "))
+	}
+	return nil
+}
+
+// parseSQLStatements is splitSQLStatements, returning an error for scripts
+// it can't split rather than exiting.
+func parseSQLStatements(r io.Reader, direction Direction) (stmts []string, err error) {
 	var buf bytes.Buffer
 	scanner := bufio.NewScanner(r)
 
@@ -56,6 +348,8 @@ func splitSQLStatements(r io.Reader, direction Direction) (stmts []string) {
 
 	for scanner.Scan() {
 
+		// the scanner drops the \r of CRLF line endings, so scripts authored
+		// on Windows are split just as they are with \n endings
 		line := scanner.Text()
 
 		// handle any goose-specific commands
@@ -106,7 +400,7 @@ func splitSQLStatements(r io.Reader, direction Direction) (stmts []string) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		log.Fatalf("scanning migration: %v", err)
+		return nil, fmt.Errorf("scanning migration: %v", err)
 	}
 
 	// diagnose likely migration script errors
@@ -119,11 +413,11 @@ func splitSQLStatements(r io.Reader, direction Direction) (stmts []string) {
 	}
 
 	if upSections == 0 && downSections == 0 {
-		log.Fatalf(`ERROR: no Up/Down annotations found, so no statements were executed.
+		return nil, errors.New(`ERROR: no Up/Down annotations found, so no statements were executed.
 			See https://github.com/cloudcom/goose for details.`)
 	}
 
-	return
+	return stmts, nil
 }
 
 // Run a migration specified in raw SQL.
@@ -134,34 +428,306 @@ func splitSQLStatements(r io.Reader, direction Direction) (stmts []string) {
 //
 // All statements following an Up or Down directive are grouped together
 // until another direction directive is found.
-func runSQLMigration(conf *DBConf, db *sql.DB, scriptFile string, v int64, direction Direction) error {
-
-	txn, err := db.Begin()
+//
+// Scripts annotated with '-- +goose NO TRANSACTION' are run outside of a
+// transaction, see runSQLMigrationNoTx.
+func runSQLMigration(ctx context.Context, conf *DBConf, db *sql.DB, scriptFile string, v int64, direction Direction) error {
+	noTx, err := sqlNoTransaction(scriptFile)
 	if err != nil {
-		log.Fatal("db.Begin:", err)
+		return err
+	}
+	if noTx {
+		return runSQLMigrationNoTx(ctx, conf, db, scriptFile, v, direction)
+	}
+
+	backoff := conf.RetryBackoff
+	for retry := 1; ; retry++ {
+		err = runSQLMigrationTx(ctx, conf, db, scriptFile, v, direction)
+		if err == nil || retry > conf.MaxRetries || !conf.Driver.Dialect.isRetryable(err) {
+			return err
+		}
+
+		if !conf.JSON {
+			conf.logger().Printf("goose: %s, retrying %s (%d of %d)\n", err, filepath.Base(scriptFile), retry, conf.MaxRetries)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
 	}
+}
 
-	f, err := os.Open(scriptFile)
+// runSQLMigrationTx runs the script, and records the version, in one
+// transaction.
+func runSQLMigrationTx(ctx context.Context, conf *DBConf, db *sql.DB, scriptFile string, v int64, direction Direction) error {
+	txn, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("db.Begin: %s", err)
 	}
 
-	// find each statement, checking annotations for up/down direction
-	// and execute each of them in the current transaction.
 	// Commits the transaction if successfully applied each statement and
 	// records the version into the version table or returns an error and
 	// rolls back the transaction.
-	for _, query := range splitSQLStatements(f, direction) {
-		if _, err = txn.Exec(query); err != nil {
-			txn.Rollback()
-			log.Fatalf("FAIL %s (%v), quitting migration.", filepath.Base(scriptFile), err)
-			return err
-		}
+	if err = execSQLMigration(ctx, conf, txn, scriptFile, v, direction); err != nil {
+		txn.Rollback()
+		return err
+	}
+
+	if err = finalizeMigration(ctx, conf, txn, direction, v, scriptFile); err != nil {
+		return wrapError(err, "error finalizing migration %s (%s)", filepath.Base(scriptFile), err)
+	}
+
+	return nil
+}
+
+// runSQLMigrationNoTx runs the statements of the script one by one, each
+// committing on its own, and then records the version. They're all run on
+// the same connection, as statements like sqlite's PRAGMA foreign_keys only
+// affect the connection they're run on, and are ignored within a
+// transaction. If a statement fails, the earlier ones stay applied.
+func runSQLMigrationNoTx(ctx context.Context, conf *DBConf, db *sql.DB, scriptFile string, v int64, direction Direction) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = execSQLMigration(ctx, conf, conn, scriptFile, v, direction); err != nil {
+		return err
+	}
+
+	txn, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("db.Begin: %s", err)
+	}
+	if err = finalizeMigration(ctx, conf, txn, direction, v, scriptFile); err != nil {
+		return fmt.Errorf("error finalizing migration %s (%v)", filepath.Base(scriptFile), err)
+	}
+
+	return nil
+}
+
+// sqlExecer is implemented by *sql.Tx and *sql.Conn.
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// execSQLMigration executes the statements of the script for the given
+// direction with ex, leaving it to the caller to commit or roll back any
+// transaction.
+func execSQLMigration(ctx context.Context, conf *DBConf, ex sqlExecer, scriptFile string, v int64, direction Direction) error {
+	r, err := readSQLMigration(scriptFile)
+	if err != nil {
+		return err
 	}
 
-	if err = FinalizeMigration(conf, txn, direction, v); err != nil {
-		log.Fatalf("error finalizing migration %s, quitting. (%v)", filepath.Base(scriptFile), err)
+	// find each statement, checking annotations for up/down direction
+	// and execute each of them with ex.
+	rewriter, _ := conf.Driver.Dialect.(statementRewriter)
+	queries := splitSQLStatements(r, direction)
+	if splitter, ok := conf.Driver.Dialect.(statementSplitter); ok {
+		var split []string
+		for _, query := range queries {
+			split = append(split, splitter.splitStatement(query)...)
+		}
+		queries = split
+	}
+	for i, query := range queries {
+		if rewriter != nil {
+			query = rewriter.rewriteStatement(query)
+		}
+		if conf.PrintSQL {
+			printStatement(conf.logger(), conf, v, scriptFile, direction, query)
+		}
+		if _, err = ex.ExecContext(ctx, query); err != nil {
+			return wrapError(err, "migration %s: statement %d failed: %s (%s)", filepath.Base(scriptFile), i+1, err, statementSummary(query))
+		}
 	}
 
 	return nil
 }
+
+// isSQLStatementLine reports whether line is part of a statement, rather
+// than blank or a comment.
+func isSQLStatementLine(line string) bool {
+	line = strings.TrimSpace(line)
+	return line != "" && !strings.HasPrefix(line, "--")
+}
+
+// sqlDownEmpty reports whether the script has no statements to run when
+// it's rolled back.
+func sqlDownEmpty(scriptFile string) (bool, error) {
+	f, err := openMigration(scriptFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	down := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, sqlCmdPrefix) {
+			switch strings.TrimSpace(line[len(sqlCmdPrefix):]) {
+			case "Up":
+				down = false
+			case "Down":
+				down = true
+			}
+			continue
+		}
+		if down && isSQLStatementLine(line) {
+			return false, nil
+		}
+	}
+	return true, scanner.Err()
+}
+
+// warnEmptyDown warns, before the migration is applied, if it's a SQL
+// migration which can't be rolled back.
+func warnEmptyDown(out Logger, m *Migration, direction Direction) {
+	if direction != DirectionUp || migrationExt(m.Source) != ".sql" {
+		return
+	}
+	if empty, err := sqlDownEmpty(m.Source); err == nil && empty {
+		out.Printf("goose: WARNING: %s has an empty Down section, so it can't be rolled back\n", filepath.Base(m.Source))
+	}
+}
+
+// the annotation for running a script outside of a transaction
+const sqlNoTransactionCmd = "NO TRANSACTION"
+
+// sqlNoTransaction reports whether the script is annotated with
+// '-- +goose NO TRANSACTION'.
+func sqlNoTransaction(scriptFile string) (bool, error) {
+	return sqlAnnotated(scriptFile, sqlNoTransactionCmd)
+}
+
+// sqlAnnotated reports whether the script has the '-- +goose <cmd>'
+// annotation.
+func sqlAnnotated(scriptFile, cmd string) (bool, error) {
+	f, err := openMigration(scriptFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	return hasSQLAnnotation(f, cmd)
+}
+
+// hasSQLAnnotation reports whether the script read from r has the
+// '-- +goose <cmd>' annotation.
+func hasSQLAnnotation(r io.Reader, cmd string) (bool, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, sqlCmdPrefix) && strings.TrimSpace(line[len(sqlCmdPrefix):]) == cmd {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// the length statements are truncated to in errors
+const maxStatementSummary = 100
+
+// statementSummary collapses the whitespace in a statement, and truncates
+// it, to be included in an error.
+func statementSummary(stmt string) string {
+	s := strings.Join(strings.Fields(stmt), " ")
+	if len(s) > maxStatementSummary {
+		s = s[:maxStatementSummary-3] + "..."
+	}
+	return s
+}
+
+// matches $VAR and ${VAR}
+var sqlEnvVarRegexp = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+var sqlEnvVarNameRegexp = regexp.MustCompile(`^\w+$`)
+
+// readSQLMigration reads the script, expanding the environment variables
+// listed by any '-- +goose ENV NAME...' annotations. Any other $ are kept
+// as is.
+func readSQLMigration(scriptFile string) (io.Reader, error) {
+	f, err := openMigration(scriptFile)
+	if err != nil {
+		return nil, err
+	}
+	script, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Base(scriptFile), err)
+	}
+
+	allowed, err := sqlEnvVars(script)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filepath.Base(scriptFile), err)
+	}
+	if len(allowed) == 0 {
+		return bytes.NewReader(script), nil
+	}
+
+	var missing []string
+	script = sqlEnvVarRegexp.ReplaceAllFunc(script, func(ref []byte) []byte {
+		m := sqlEnvVarRegexp.FindSubmatch(ref)
+		name := string(m[1]) + string(m[2])
+		if !allowed[name] {
+			return ref
+		}
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return []byte(v)
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%s: environment variables not set: %s", filepath.Base(scriptFile), strings.Join(missing, ", "))
+	}
+
+	return bytes.NewReader(script), nil
+}
+
+// sqlEnvVars returns the variable names listed by the script's
+// '-- +goose ENV' annotations.
+func sqlEnvVars(script []byte) (map[string]bool, error) {
+	vars := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	for scanner.Scan() {
+		names, ok, err := parseSQLEnvAnnotation(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		for _, name := range names {
+			vars[name] = true
+		}
+	}
+	return vars, scanner.Err()
+}
+
+// parseSQLEnvAnnotation returns the names listed if line is a
+// '-- +goose ENV' annotation.
+func parseSQLEnvAnnotation(line string) (names []string, ok bool, err error) {
+	if !strings.HasPrefix(line, sqlCmdPrefix) {
+		return nil, false, nil
+	}
+	fields := strings.Fields(line[len(sqlCmdPrefix):])
+	if len(fields) == 0 || fields[0] != "ENV" {
+		return nil, false, nil
+	}
+
+	names = fields[1:]
+	if len(names) == 0 {
+		return nil, true, fmt.Errorf("'-- +goose ENV' lists no variables")
+	}
+	for _, name := range names {
+		if !sqlEnvVarNameRegexp.MatchString(name) {
+			return nil, true, fmt.Errorf("invalid variable name %q in '-- +goose ENV'", name)
+		}
+	}
+	return names, true, nil
+}
@@ -1,8 +1,17 @@
 package goose
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSemicolons(t *testing.T) {
@@ -86,6 +95,78 @@ func TestSplitStatements(t *testing.T) {
 	}
 }
 
+func TestParseSQLMigration(t *testing.T) {
+	up, down, noTx, err := ParseSQLMigration(strings.NewReader(`-- +goose Up
+CREATE TABLE post (id int);
+-- +goose StatementBegin
+CREATE FUNCTION touch() RETURNS trigger AS $$
+BEGIN
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION touch();
+DROP TABLE post;
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"-- +goose Up\nCREATE TABLE post (id int);\n",
+		"-- +goose StatementBegin\nCREATE FUNCTION touch() RETURNS trigger AS $$\nBEGIN\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql;\n-- +goose StatementEnd\n",
+	}, up)
+	assert.Equal(t, []string{
+		"-- +goose Down\nDROP FUNCTION touch();\n",
+		"DROP TABLE post;\n",
+	}, down)
+	assert.False(t, noTx)
+
+	up, down, noTx, err = ParseSQLMigration(strings.NewReader(`-- +goose NO TRANSACTION
+-- +goose Up
+CREATE INDEX CONCURRENTLY post_id ON post (id);
+
+-- +goose Down
+DROP INDEX post_id;
+`))
+	require.NoError(t, err)
+	assert.Len(t, up, 1)
+	assert.Len(t, down, 1)
+	assert.True(t, noTx)
+
+	_, _, _, err = ParseSQLMigration(strings.NewReader("SELECT 1;\n"))
+	assert.Error(t, err, "no Up/Down annotations")
+}
+
+func TestParseSQLMigration_crlf(t *testing.T) {
+	// as authored on Windows
+	script := "-- +goose NO TRANSACTION\r\n" +
+		"-- +goose Up\r\n" +
+		"CREATE TABLE post (id int);\r\n" +
+		"-- +goose StatementBegin\r\n" +
+		"CREATE FUNCTION touch() RETURNS trigger AS $$\r\n" +
+		"BEGIN\r\n" +
+		"  RETURN NEW;\r\n" +
+		"END;\r\n" +
+		"$$ LANGUAGE plpgsql;\r\n" +
+		"-- +goose StatementEnd\r\n" +
+		"\r\n" +
+		"-- +goose Down\r\n" +
+		"DROP FUNCTION touch();\r\n" +
+		"DROP TABLE post;\r\n"
+	up, down, noTx, err := ParseSQLMigration(strings.NewReader(script))
+	require.NoError(t, err)
+
+	// the same as the Unix line endings
+	wantUp, wantDown, wantNoTx, err := ParseSQLMigration(strings.NewReader(strings.Replace(script, "\r\n", "\n", -1)))
+	require.NoError(t, err)
+	assert.Equal(t, wantUp, up)
+	assert.Equal(t, wantDown, down)
+	assert.Equal(t, wantNoTx, noTx)
+	assert.Len(t, up, 2)
+	assert.Len(t, down, 2)
+	assert.True(t, noTx)
+}
+
 var functxt = `-- +goose Up
 CREATE TABLE IF NOT EXISTS histories (
   id                BIGSERIAL  PRIMARY KEY,
@@ -145,3 +226,616 @@ CREATE TABLE fancier_post (
 -- +goose Down
 DROP TABLE fancier_post;
 `
+
+func TestReadSQLMigration_env(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	os.Setenv("GOOSE_TEST_TABLESPACE", "fast_ssd")
+	defer os.Unsetenv("GOOSE_TEST_TABLESPACE")
+	os.Setenv("GOOSE_TEST_OTHER", "other")
+	defer os.Unsetenv("GOOSE_TEST_OTHER")
+
+	path := filepath.Join(td, "001_env.sql")
+	err = ioutil.WriteFile(path, []byte(`-- +goose ENV GOOSE_TEST_TABLESPACE
+-- +goose Up
+CREATE TABLE post (body text DEFAULT '$GOOSE_TEST_OTHER $1') TABLESPACE ${GOOSE_TEST_TABLESPACE};
+
+-- +goose Down
+DROP TABLE post;
+`), 0600)
+	require.NoError(t, err)
+
+	r, err := readSQLMigration(path)
+	require.NoError(t, err)
+	stmts := splitSQLStatements(r, DirectionUp)
+	require.Len(t, stmts, 1)
+	assert.Contains(t, stmts[0], "CREATE TABLE post (body text DEFAULT '$GOOSE_TEST_OTHER $1') TABLESPACE fast_ssd;\n")
+
+	os.Unsetenv("GOOSE_TEST_TABLESPACE")
+	_, err = readSQLMigration(path)
+	assert.Error(t, err)
+}
+
+func TestReadSQLMigration_noEnv(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	os.Setenv("GOOSE_TEST_TABLESPACE", "fast_ssd")
+	defer os.Unsetenv("GOOSE_TEST_TABLESPACE")
+
+	// without the annotation, $ is never expanded
+	path := filepath.Join(td, "001_env.sql")
+	script := "-- +goose Up\nSELECT '$GOOSE_TEST_TABLESPACE';\n"
+	err = ioutil.WriteFile(path, []byte(script), 0600)
+	require.NoError(t, err)
+
+	r, err := readSQLMigration(path)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, script, string(b))
+}
+
+func TestRegisterMigrationExtension(t *testing.T) {
+	RegisterMigrationExtension(".psql", "sql")
+	defer delete(migrationExts, ".psql")
+
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+	err := ioutil.WriteFile(filepath.Join(md, "20010203040507_one.psql"),
+		[]byte("-- +goose Up\nINSERT INTO test(value) VALUES('one');\n\n-- +goose Down\nDELETE FROM test;\n"),
+		0600)
+	require.NoError(t, err)
+	// not registered, so not a migration
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040508_two.mysql"), []byte("SELECT 1;"), 0600)
+	require.NoError(t, err)
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 2)
+	assert.Equal(t, int64(20010203040507), migs[1].Version)
+	assert.Equal(t, ".sql", migrationExt(migs[1].Source))
+
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	var value string
+	err = db.QueryRow("SELECT value FROM test").Scan(&value)
+	require.NoError(t, err)
+	assert.Equal(t, "one", value)
+
+	assert.Panics(t, func() { RegisterMigrationExtension(".txt", "text") })
+}
+
+func TestDestructiveStatements(t *testing.T) {
+	script := `-- +goose Up
+CREATE TABLE a (id int);
+DROP TABLE old_a;
+
+-- +goose Down
+drop   table a;
+ALTER TABLE b
+    DROP COLUMN c;
+ALTER TABLE b ADD COLUMN dropped int;
+DELETE FROM b;
+`
+	stmts, err := DestructiveStatements(strings.NewReader(script), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"drop   table a;", "ALTER TABLE b\n    DROP COLUMN c;"}, stmts)
+
+	stmts, err = DestructiveStatements(strings.NewReader(script), []string{"delete from"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"DELETE FROM b;"}, stmts)
+
+	stmts, err = DestructiveStatements(strings.NewReader("-- +goose Up\nDROP TABLE a;\n-- +goose Down\nSELECT 1;\n"), nil)
+	require.NoError(t, err)
+	assert.Empty(t, stmts)
+
+	// keywords in comments don't count
+	stmts, err = DestructiveStatements(strings.NewReader(`-- +goose Up
+SELECT 1;
+
+-- +goose Down
+-- DROP TABLE a once nothing reads it
+UPDATE b SET c = 1 -- rather than DROP TABLE b
+;
+`), nil)
+	require.NoError(t, err)
+	assert.Empty(t, stmts)
+}
+
+func TestRunMigrationsOnDb_protected(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+		Protected:     true,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	// only the DROP TABLE needs confirming
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "refusing to roll back 20010203040506_setup.sql")
+	_, err = db.Exec("SELECT * FROM test")
+	require.NoError(t, err, "the migration shouldn't have run")
+
+	conf.ConfirmDestructive = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+	_, err = db.Exec("SELECT * FROM test")
+	assert.Error(t, err)
+}
+
+func TestRunMigrationsOnDb_gzip(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte("-- +goose Up\nINSERT INTO test(value) VALUES('one');\n\n-- +goose Down\nDELETE FROM test;\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_one.sql.gz"), buf.Bytes(), 0600)
+	require.NoError(t, err)
+
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	var value string
+	err = db.QueryRow("SELECT value FROM test").Scan(&value)
+	require.NoError(t, err)
+	assert.Equal(t, "one", value)
+
+	// compressing an applied migration doesn't count as modifying it
+	setup := filepath.Join(md, "20010203040506_setup.sql")
+	script, err := ioutil.ReadFile(setup)
+	require.NoError(t, err)
+	buf.Reset()
+	zw = gzip.NewWriter(&buf)
+	_, err = zw.Write(script)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	err = ioutil.WriteFile(setup+".gz", buf.Bytes(), 0600)
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(setup))
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+	_, err = db.Exec("SELECT * FROM test")
+	assert.Error(t, err, "the setup migration should have been rolled back")
+}
+
+func TestParseSQLEnvAnnotation(t *testing.T) {
+	names, ok, err := parseSQLEnvAnnotation("-- +goose ENV ROLE TABLESPACE")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ROLE", "TABLESPACE"}, names)
+
+	_, ok, _ = parseSQLEnvAnnotation("-- +goose Up")
+	assert.False(t, ok)
+
+	_, ok, err = parseSQLEnvAnnotation("-- +goose ENV")
+	assert.True(t, ok)
+	assert.Error(t, err)
+
+	_, ok, err = parseSQLEnvAnnotation("-- +goose ENV $ROLE")
+	assert.True(t, ok)
+	assert.Error(t, err)
+}
+
+func TestRunSQLMigration_statementError(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040507_one.sql": [2]string{
+			"CREATE TABLE test(value VARCHAR(20));\nINSERT INTO\n  nonexistent(value) VALUES('one');",
+			"DROP TABLE test;",
+		},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migration 20010203040507_one.sql: statement 2 failed: no such table: nonexistent (INSERT INTO nonexistent(value) VALUES('one');)")
+}
+
+// testRunSQLMigration_sameLine runs a migration with several statements on
+// a line, which mysql only accepts in one Exec with multiStatements set in
+// the DSN.
+func testRunSQLMigration_sameLine(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_same_line.sql": [2]string{
+			"CREATE TABLE goose_same_line(value VARCHAR(20));\n" +
+				"INSERT INTO goose_same_line(value) VALUES('one;'); INSERT INTO goose_same_line(value) VALUES('two');",
+			"DROP TABLE goose_same_line;",
+		},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Exec("DROP TABLE goose_same_line")
+	db.Exec("DROP TABLE goose_db_version")
+	defer db.Exec("DROP TABLE goose_same_line")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	var count int
+	err = db.QueryRow("SELECT count(*) FROM goose_same_line").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+func TestRunSQLMigration_sameLine_sqlite3(t *testing.T) {
+	testRunSQLMigration_sameLine(t, getSqlite3Driver(t))
+}
+func TestRunSQLMigration_sameLine_mysql(t *testing.T) {
+	testRunSQLMigration_sameLine(t, getMysqlDriver(t))
+}
+
+// retryDialect fails the first statements it's asked to rewrite, with an
+// error it considers retryable if retryable is set.
+type retryDialect struct {
+	Sqlite3Dialect
+	failures  *int
+	retryable bool
+}
+
+func (d retryDialect) rewriteStatement(stmt string) string {
+	if *d.failures > 0 {
+		*d.failures--
+		return "SELECT * FROM serialization_failure;"
+	}
+	return stmt
+}
+
+func (d retryDialect) isRetryable(err error) bool {
+	return d.retryable && strings.Contains(err.Error(), "serialization_failure")
+}
+
+func TestRunSQLMigration_retry(t *testing.T) {
+	for _, retryable := range []bool{true, false} {
+		md, mdCleanup := setupMigrationsDir(map[string][2]string{
+			"20010203040507_one.sql": [2]string{
+				"CREATE TABLE test(value VARCHAR(20));\nINSERT INTO test(value) VALUES('one');",
+				"DROP TABLE test;",
+			},
+		})
+		defer mdCleanup()
+
+		failures := 1
+		driver := getSqlite3Driver(t)
+		driver.Dialect = retryDialect{failures: &failures, retryable: retryable}
+		var out bytes.Buffer
+		conf := &DBConf{
+			Driver:        driver,
+			MigrationsDir: md,
+			Output:        &out,
+			MaxRetries:    2,
+			RetryBackoff:  time.Millisecond,
+		}
+
+		db, err := OpenDBFromDBConf(conf)
+		require.NoError(t, err)
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+
+		err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+		current, e := EnsureDBVersion(conf, db)
+		require.NoError(t, e)
+		if !retryable {
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "no such table: serialization_failure")
+			assert.NotContains(t, out.String(), "retrying")
+			assert.Equal(t, int64(0), current)
+			continue
+		}
+
+		require.NoError(t, err)
+		assert.Contains(t, out.String(), "retrying 20010203040507_one.sql (1 of 2)")
+		assert.Equal(t, int64(20010203040507), current)
+
+		// the failed attempt was rolled back, so the row is inserted once
+		var count int
+		err = db.QueryRow("SELECT count(*) FROM test").Scan(&count)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		// giving up after MaxRetries
+		failures = 3
+		err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+		require.Error(t, err)
+		assert.Contains(t, out.String(), "(2 of 2)")
+		assert.Equal(t, 0, failures)
+	}
+}
+
+func TestRunSQLMigration_printSQL(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040507_one.sql": [2]string{
+			"CREATE TABLE test(value VARCHAR(20));\nINSERT INTO test(value) VALUES('one');",
+			"DROP TABLE test;",
+		},
+	})
+	defer mdCleanup()
+
+	var out bytes.Buffer
+	conf := NewInMemoryConf(md)
+	conf.PrintSQL = true
+	conf.Output = &out
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	// exactly as sent, including the comments within the statement
+	assert.Contains(t, out.String(), "SQL   20010203040507 up: -- +goose Up\nCREATE TABLE test(value VARCHAR(20));\n"+
+		"SQL   20010203040507 up: INSERT INTO test(value) VALUES('one');\n"+
+		"OK    20010203040507_one.sql")
+
+	out.Reset()
+	conf.JSON = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"type":"statement","version":20010203040507,"source":"`+filepath.Join(md, "20010203040507_one.sql")+`","direction":"down","statement":"-- +goose Down\nDROP TABLE test;\n"}`, lines[0])
+}
+
+func TestRunSQLMigration_noTransaction(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{
+			"CREATE TABLE parent(id INTEGER PRIMARY KEY);\n" +
+				"CREATE TABLE child(parent_id INTEGER REFERENCES parent(id));\n" +
+				"INSERT INTO parent(id) VALUES(1);\n" +
+				"INSERT INTO child(parent_id) VALUES(1);",
+			"DROP TABLE child;\nDROP TABLE parent;",
+		},
+	})
+	defer mdCleanup()
+
+	// sqlite's documented way of altering a table, by rebuilding it
+	rebuild := `-- +goose Up
+PRAGMA foreign_keys=OFF;
+CREATE TABLE parent_new(id INTEGER PRIMARY KEY, name TEXT NOT NULL DEFAULT '');
+INSERT INTO parent_new(id) SELECT id FROM parent;
+DROP TABLE parent;
+ALTER TABLE parent_new RENAME TO parent;
+PRAGMA foreign_keys=ON;
+
+-- +goose Down
+SELECT 1;
+`
+	conf := NewInMemoryConf(md)
+	conf.SqliteForeignKeys = true
+	conf.Output = ioutil.Discard
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+
+	// within a transaction, the pragma is ignored and dropping parent fails
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_rebuild.sql"), []byte(rebuild), 0600)
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "FOREIGN KEY constraint failed")
+
+	err = ioutil.WriteFile(filepath.Join(md, "20010203040507_rebuild.sql"), []byte("-- +goose NO TRANSACTION\n"+rebuild), 0600)
+	require.NoError(t, err)
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+
+	var name string
+	err = db.QueryRow("SELECT name FROM parent WHERE id = 1").Scan(&name)
+	require.NoError(t, err)
+	assert.Equal(t, "", name)
+
+	var foreignKeys bool
+	err = db.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys)
+	require.NoError(t, err)
+	assert.True(t, foreignKeys)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.EqualValues(t, 20010203040507, current)
+
+	// it can't be part of a single transaction
+	conf.SingleTransaction = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "annotated with '-- +goose NO TRANSACTION'")
+}
+
+func TestRunMigrationsOnDb_emptyDown(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "-- TODO"},
+	})
+	defer mdCleanup()
+
+	var buf bytes.Buffer
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        &buf,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "goose: WARNING: 20010203040507_one.sql has an empty Down section, so it can't be rolled back\n")
+	assert.NotContains(t, buf.String(), "20010203040506_setup.sql has an empty Down section")
+
+	// new migrations start with an empty Down section
+	_, content, err := CreateMigrationContent("two", "sql", time.Now())
+	require.NoError(t, err)
+	path := filepath.Join(md, "20010203040508_two.sql")
+	require.NoError(t, ioutil.WriteFile(path, content, 0600))
+	empty, err := sqlDownEmpty(path)
+	require.NoError(t, err)
+	assert.True(t, empty)
+}
+
+func TestStatementSummary(t *testing.T) {
+	assert.Equal(t, "SELECT 1;", statementSummary("\n  SELECT\n\t1;\n"))
+
+	long := statementSummary("SELECT '" + strings.Repeat("x", 200) + "';")
+	assert.Len(t, long, maxStatementSummary)
+	assert.True(t, strings.HasSuffix(long, "..."))
+}
+
+func TestRunMigrationsOnDb_split(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+	})
+	defer mdCleanup()
+
+	files := map[string]string{
+		"20010203040507_data/up.sql":   "INSERT INTO test(value) VALUES('one');\nINSERT INTO test(value) VALUES('two');\n",
+		"20010203040507_data/down.sql": "DELETE FROM test;",
+		// without a down.sql, the Down section is empty
+		"20010203040508-more/up.sql": "-- +goose NO TRANSACTION\nINSERT INTO test(value) VALUES('three');\n",
+		// not a migration, as it has no up.sql
+		"20010203040509_fixtures/data.sql": "SELECT 1;\n",
+	}
+	for name, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Join(md, filepath.Dir(name)), 0700))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(md, name), []byte(contents), 0600))
+	}
+
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, migs, 3)
+	assert.Equal(t, filepath.Join(md, "20010203040507_data"), migs[1].Source)
+	assert.Equal(t, "sql", migs[1].Type())
+	assert.Equal(t, filepath.Join(md, "20010203040508-more"), migs[2].Source)
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.Contains(t, problems[0].Error(), "20010203040508-more")
+
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	count := func() int {
+		var n int
+		require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM test").Scan(&n))
+		return n
+	}
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count())
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count())
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count())
+
+	// the checksums of applied split migrations are verified too
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(md, "20010203040507_data", "down.sql"), []byte("DELETE FROM test WHERE value = 'one';"), 0600))
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040508, db)
+	assert.EqualError(t, err, "migration 20010203040507 has been modified since it was applied (20010203040507_data)")
+}
+
+func TestSplitSQLMigration(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	path, _, err := CreateMigrationFromNamedTemplate("add index", "sql", td, "", "index", time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC))
+	require.NoError(t, err)
+
+	dir, err := SplitSQLMigration(path)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(td, "20010203040506_add_index"), dir)
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	up, err := ioutil.ReadFile(filepath.Join(dir, "up.sql"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(up), "-- +goose NO TRANSACTION\n"), string(up))
+	assert.NotContains(t, string(up), "-- +goose Up")
+	down, err := ioutil.ReadFile(filepath.Join(dir, "down.sql"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(down), "-- +goose Down")
+
+	migs, err := CollectMigrations(td)
+	require.NoError(t, err)
+	require.Len(t, migs, 1)
+	assert.Equal(t, dir, migs[0].Source)
+
+	_, err = SplitSQLMigration(dir)
+	assert.Error(t, err)
+}
@@ -0,0 +1,28 @@
+package goose
+
+import "time"
+
+// Observer is notified around each migration goose runs, e.g. to export
+// metrics, without parsing its output. Dry runs aren't observed.
+type Observer interface {
+	// OnMigrationStart is called before the migration is run.
+	OnMigrationStart(m *Migration, direction Direction)
+	// OnMigrationEnd is called once it's finished, with how long it took
+	// and the error it failed with, if any. With DBConf.SingleTransaction
+	// it's called before the transaction is committed.
+	OnMigrationEnd(m *Migration, direction Direction, duration time.Duration, err error)
+}
+
+// observeStart calls the DBConf's Observer, if any.
+func (c *DBConf) observeStart(m *Migration, direction Direction) {
+	if c.Observer != nil {
+		c.Observer.OnMigrationStart(m, direction)
+	}
+}
+
+// observeEnd calls the DBConf's Observer, if any.
+func (c *DBConf) observeEnd(m *Migration, direction Direction, duration time.Duration, err error) {
+	if c.Observer != nil {
+		c.Observer.OnMigrationEnd(m, direction, duration, err)
+	}
+}
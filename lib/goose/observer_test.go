@@ -0,0 +1,69 @@
+package goose
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingObserver records the calls made to it.
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) OnMigrationStart(m *Migration, direction Direction) {
+	o.events = append(o.events, fmt.Sprintf("start %d %v", m.Version, direction))
+}
+
+func (o *recordingObserver) OnMigrationEnd(m *Migration, direction Direction, duration time.Duration, err error) {
+	o.events = append(o.events, fmt.Sprintf("end %d %v %t", m.Version, direction, err != nil))
+}
+
+func TestObserver(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_fail.sql":  [2]string{"INSERT INTO nonexistent(value) VALUES('one');", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	obs := &recordingObserver{}
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+		Observer:      obs,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.Error(t, err)
+	assert.Equal(t, []string{
+		"start 20010203040506 up",
+		"end 20010203040506 up false",
+		"start 20010203040507 up",
+		"end 20010203040507 up true",
+	}, obs.events)
+
+	// dry runs aren't observed
+	obs.events = nil
+	conf.DryRun = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+	assert.Empty(t, obs.events)
+
+	conf.DryRun = false
+	conf.SingleTransaction = true
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 0, db)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"start 20010203040506 down",
+		"end 20010203040506 down false",
+	}, obs.events)
+}
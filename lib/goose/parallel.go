@@ -0,0 +1,156 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// the annotation for running a NO TRANSACTION script concurrently with the
+// consecutive scripts also annotated with it, see DBConf.Parallelism
+const sqlParallelCmd = "PARALLEL"
+
+// parallelGroup returns the migrations at the start of ms which can be run
+// concurrently: SQL migrations annotated with both NO TRANSACTION and
+// PARALLEL.
+func parallelGroup(ms []*Migration) ([]*Migration, error) {
+	for i, m := range ms {
+		ok, err := isParallelMigration(m)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return ms[:i], nil
+		}
+	}
+	return ms, nil
+}
+
+func isParallelMigration(m *Migration) (bool, error) {
+	if migrationExt(m.Source) != ".sql" {
+		return false, nil
+	}
+	if ok, err := sqlAnnotated(m.Source, sqlParallelCmd); err != nil || !ok {
+		return false, err
+	}
+	return sqlNoTransaction(m.Source)
+}
+
+// applyParallelGroup runs the migrations of group concurrently, each on its
+// own connection, with at most conf.Parallelism at once. Once they've all
+// succeeded, their versions are recorded in one transaction. If one fails,
+// no more are started, and none are recorded, even those which succeeded,
+// as the group fails as a whole.
+func applyParallelGroup(ctx context.Context, conf *DBConf, db *sql.DB, group []*Migration, direction Direction) error {
+	// the migrations report their statements, with DBConf.PrintSQL, at once
+	gconf := *conf
+	if conf.Output != nil {
+		gconf.Output = &syncWriter{w: conf.Output}
+	}
+	out := gconf.logger()
+
+	var mu sync.Mutex // guards failed, and serializes the observer
+	failed := false
+	errs := make([]error, len(group))
+	durations := make([]time.Duration, len(group))
+	started := 0
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, conf.Parallelism)
+	for i, m := range group {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			break
+		}
+
+		started++
+		wg.Add(1)
+		go func(i int, m *Migration) {
+			defer func() { <-sem; wg.Done() }()
+
+			mu.Lock()
+			warnEmptyDown(out, m, direction)
+			gconf.observeStart(m, direction)
+			mu.Unlock()
+
+			start := time.Now()
+			err := execSQLMigrationOnConn(ctx, &gconf, db, m, direction)
+
+			mu.Lock()
+			errs[i], durations[i] = err, time.Since(start)
+			failed = failed || err != nil
+			gconf.observeEnd(m, direction, durations[i], err)
+			mu.Unlock()
+		}(i, m)
+	}
+	wg.Wait()
+
+	if failed || ctx.Err() != nil {
+		for i, m := range group[:started] {
+			printMigrationResult(out, &gconf, m, direction, durations[i], errs[i])
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for i, err := range errs {
+			if err != nil {
+				m := group[i]
+				return &MigrationError{Version: m.Version, Source: m.Source, Direction: direction, Err: err}
+			}
+		}
+	}
+
+	if err := recordMigrations(ctx, conf, db, group, direction); err != nil {
+		return wrapError(err, "error recording the migrations from %s to %s (%s)", filepath.Base(group[0].Source), filepath.Base(group[len(group)-1].Source), err)
+	}
+	for i, m := range group {
+		printMigrationResult(out, &gconf, m, direction, durations[i], nil)
+	}
+	return nil
+}
+
+// execSQLMigrationOnConn runs the statements of the migration, one by one,
+// on a connection of its own.
+func execSQLMigrationOnConn(ctx context.Context, conf *DBConf, db *sql.DB, m *Migration, direction Direction) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return execSQLMigration(ctx, conf, conn, m.Source, m.Version, direction)
+}
+
+// recordMigrations updates the version table for the migrations in one
+// transaction.
+func recordMigrations(ctx context.Context, conf *DBConf, db *sql.DB, ms []*Migration, direction Direction) error {
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if err := recordMigration(ctx, conf, txn, direction, m.Version, m.Source); err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+// syncWriter serializes the writes to w.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
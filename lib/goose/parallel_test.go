@@ -0,0 +1,108 @@
+package goose
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeParallelMigration writes a NO TRANSACTION migration annotated
+// PARALLEL to md.
+func writeParallelMigration(t *testing.T, md, name, up, down string) {
+	err := ioutil.WriteFile(filepath.Join(md, name),
+		[]byte("-- +goose NO TRANSACTION\n-- +goose PARALLEL\n-- +goose Up\n"+up+"\n\n-- +goose Down\n"+down+"\n"),
+		0600)
+	require.NoError(t, err)
+}
+
+func TestParallelGroup(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040509_after.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+	writeParallelMigration(t, md, "20010203040507_one.sql", "SELECT 1;", "SELECT 1;")
+	writeParallelMigration(t, md, "20010203040508_two.sql", "SELECT 2;", "SELECT 2;")
+
+	ms, err := CollectMigrations(md)
+	require.NoError(t, err)
+
+	group, err := parallelGroup(ms)
+	require.NoError(t, err)
+	assert.Empty(t, group)
+
+	group, err = parallelGroup(ms[1:])
+	require.NoError(t, err)
+	assert.Equal(t, ms[1:3], group)
+}
+
+func testRunMigrations_parallel(t *testing.T, driver DBDriver) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040510_after.sql": [2]string{"INSERT INTO test(value) VALUES('after');", "DELETE FROM test WHERE value = 'after';"},
+	})
+	defer mdCleanup()
+	for _, v := range []string{"07", "08", "09"} {
+		writeParallelMigration(t, md, "200102030405"+v+"_shard.sql",
+			"INSERT INTO test(value) VALUES('"+v+"');",
+			"DELETE FROM test WHERE value = '"+v+"';")
+	}
+
+	conf := &DBConf{
+		Driver:        driver,
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+		Parallelism:   2,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	db.Exec("DROP TABLE goose_db_version")
+	db.Exec("DROP TABLE test")
+
+	res, err := RunMigrationsWithResult(context.Background(), conf, conf.MigrationsDir, 20010203040510, db)
+	require.NoError(t, err)
+	assert.Len(t, res.Migrations, 5)
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM test").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	migrations, err := MigrationStatus(conf, db)
+	require.NoError(t, err)
+	for _, m := range migrations {
+		assert.True(t, m.IsApplied, "%d", m.Version)
+	}
+
+	// a failure fails the whole group, so none of it is recorded
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040506, db)
+	require.NoError(t, err)
+	writeParallelMigration(t, md, "20010203040508_shard.sql", "INSERT INTO nonexistent(value) VALUES('08');", "SELECT 1;")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040510, db)
+	merr, ok := err.(*MigrationError)
+	require.True(t, ok, "%v", err)
+	assert.Equal(t, int64(20010203040508), merr.Version)
+
+	migrations, err = MigrationStatus(conf, db)
+	require.NoError(t, err)
+	for _, m := range migrations[1:] {
+		assert.False(t, m.IsApplied, "%d", m.Version)
+	}
+}
+func TestRunMigrations_parallel_sqlite3(t *testing.T) {
+	testRunMigrations_parallel(t, getSqlite3Driver(t))
+}
+func TestRunMigrations_parallel_mysql(t *testing.T) {
+	testRunMigrations_parallel(t, getMysqlDriver(t))
+}
+func TestRunMigrations_parallel_postgres(t *testing.T) {
+	testRunMigrations_parallel(t, getPostgresDriver(t))
+}
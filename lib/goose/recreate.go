@@ -0,0 +1,122 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// RecreateVersionTable drops the version table of db and creates it again
+// with the dialect's current schema, for a table which is corrupt or was
+// created by an old version of goose. The versions applied beforehand are
+// recorded as applied again, with their names and checksums, so the DB
+// stays at the same version, which is returned. Their history, including
+// the order they were applied in, is lost: they're recorded in version
+// order.
+//
+// It runs in a single transaction, so with dialects with transactional DDL
+// a failure leaves the old table as it was. With the others, such as mysql,
+// a failure may leave the table dropped, or partly filled.
+func RecreateVersionTable(conf *DBConf, db *sql.DB) (version int64, err error) {
+	ctx := context.Background()
+	if conf.NoVersioning {
+		return 0, errors.New("can't recreate the version table without versioning")
+	}
+
+	if !conf.NoLock {
+		unlock, err := lockDB(ctx, conf, db)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			if e := unlock(); e != nil && err == nil {
+				err = e
+			}
+		}()
+	}
+
+	// the old table may be missing columns the status is read from
+	if err := upgradeVersionTable(ctx, conf, db); err != nil {
+		return 0, err
+	}
+	current, err := dbVersion(ctx, conf, db)
+	if err == ErrTableDoesNotExist {
+		return 0, fmt.Errorf("%s doesn't exist, there's nothing to recreate", conf.versionTable())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return 0, err
+	}
+	missing, err := getMigrationsStatus(ctx, conf, db, migrations)
+	if err != nil {
+		return 0, err
+	}
+	var applied []*Migration
+	for _, m := range append(migrations, missing...) {
+		if m.IsApplied {
+			applied = append(applied, m)
+		}
+	}
+	sort.Sort(migrationSorter(applied))
+
+	d := conf.Driver.Dialect
+	table := conf.versionTable()
+	txn, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("db.Begin: %s", err)
+	}
+	if _, err := txn.ExecContext(ctx, "DROP TABLE "+quoteTable(d, table)); err != nil {
+		txn.Rollback()
+		return 0, fmt.Errorf("dropping %s: %s", table, err)
+	}
+	if _, err := txn.ExecContext(ctx, d.createVersionTableSql(table)); err != nil {
+		txn.Rollback()
+		return 0, fmt.Errorf("creating migration table: %s", err)
+	}
+	if !conf.NoInitialVersion {
+		if _, err := txn.ExecContext(ctx, conf.rebind(d.insertVersionSql(table)), 0, d.appliedValue(true), nil, nil, nil, nil, nil); err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("inserting first migration: %s", err)
+		}
+	}
+	for _, m := range applied {
+		if err := restampVersion(ctx, conf, txn, m); err != nil {
+			txn.Rollback()
+			return 0, fmt.Errorf("recording version %d: %s", m.Version, err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		return 0, err
+	}
+	return current, nil
+}
+
+// restampVersion records the applied migration m in the recreated version
+// table, keeping the name, checksum and actor it was recorded with. Rows
+// which had no checksum still have none, rather than one of the file as it
+// is now.
+func restampVersion(ctx context.Context, conf *DBConf, txn *sql.Tx, m *Migration) error {
+	var name, checksum, actor, host interface{}
+	if m.Name != "" {
+		name = m.Name
+	} else if m.Source != "" {
+		name = filepath.Base(m.Source)
+	}
+	if m.Checksum != "" {
+		checksum = m.Checksum
+	}
+	if m.Actor != "" {
+		actor, host = m.Actor, m.ActorHost
+	}
+
+	d := conf.Driver.Dialect
+	_, err := txn.ExecContext(ctx, conf.rebind(d.insertVersionSql(conf.versionTable())), m.Version, d.appliedValue(true), name, checksum, DirectionUp.String(), actor, host)
+	return err
+}
@@ -0,0 +1,105 @@
+package goose
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecreateVersionTable(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test WHERE value = 'one';"},
+		"20010203040508_two.sql":   [2]string{"INSERT INTO test(value) VALUES('two');", "DELETE FROM test WHERE value = 'two';"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	}
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = RecreateVersionTable(conf, db)
+	assert.EqualError(t, err, "goose_db_version doesn't exist, there's nothing to recreate")
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040507, db)
+	require.NoError(t, err)
+	migs, err := CollectMigrations(md)
+	require.NoError(t, err)
+	_, err = getMigrationsStatus(context.Background(), conf, db, migs)
+	require.NoError(t, err)
+	checksum := migs[0].Checksum
+	require.NotEmpty(t, checksum)
+
+	// replace it with a table as created by older versions of goose, which
+	// also records a version without a migration, and one rolled back
+	_, err = db.Exec("DROP TABLE goose_db_version")
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE goose_db_version (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version_id INTEGER NOT NULL,
+		is_applied INTEGER NOT NULL,
+		tstamp TIMESTAMP DEFAULT (datetime('now'))
+	);`)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO goose_db_version (version_id, is_applied) VALUES (0, 1), (20010203040505, 1), (20010203040506, 1), (20010203040508, 1), (20010203040507, 1), (20010203040508, 0)")
+	require.NoError(t, err)
+	_, err = db.Exec("ALTER TABLE goose_db_version ADD COLUMN checksum TEXT NULL")
+	require.NoError(t, err)
+	_, err = db.Exec("UPDATE goose_db_version SET checksum = ? WHERE version_id = 20010203040506", checksum)
+	require.NoError(t, err)
+
+	version, err := RecreateVersionTable(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), version)
+
+	// it has the current schema
+	_, err = db.Exec("SELECT id, version_id, is_applied, tstamp, name, checksum, direction FROM goose_db_version")
+	require.NoError(t, err)
+
+	rows, err := db.Query("SELECT version_id, is_applied, name, checksum FROM goose_db_version ORDER BY id")
+	require.NoError(t, err)
+	defer rows.Close()
+	type row struct {
+		version  int64
+		applied  bool
+		name     string
+		checksum string
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		var name, checksum *string
+		require.NoError(t, rows.Scan(&r.version, &r.applied, &name, &checksum))
+		if name != nil {
+			r.name = *name
+		}
+		if checksum != nil {
+			r.checksum = *checksum
+		}
+		got = append(got, r)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []row{
+		{0, true, "", ""},
+		{20010203040505, true, "", ""},
+		{20010203040506, true, "20010203040506_setup.sql", checksum},
+		{20010203040507, true, "20010203040507_one.sql", ""},
+	}, got)
+
+	current, err := EnsureDBVersion(conf, db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), current)
+
+	// migrating carries on from where it was
+	res, err := RunMigrationsWithResult(context.Background(), conf, conf.MigrationsDir, 20010203040508, db)
+	require.NoError(t, err)
+	require.Len(t, res.Migrations, 1)
+	assert.Equal(t, int64(20010203040508), res.Migrations[0].Version)
+}
@@ -0,0 +1,150 @@
+package goose
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// RunLogEntry is the JSON object appended to DBConf.LogFile, on a line of
+// its own, for each run of the migrations, whether it succeeds or not.
+// Migrations holds a MigrationReport for each migration which ran, in the
+// order they ran. Host is where the DB is, from its open string, without
+// any credentials.
+type RunLogEntry struct {
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Env        string            `json:"env,omitempty"`
+	Driver     string            `json:"driver"`
+	Host       string            `json:"host,omitempty"`
+	Direction  string            `json:"direction"`
+	Target     int64             `json:"target"`
+	Migrations []MigrationReport `json:"migrations"`
+	Version    int64             `json:"version"`
+	OK         bool              `json:"ok"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// runLog is the Observer recording the migrations of a run for
+// DBConf.LogFile, passing the calls on to the DBConf's own Observer.
+type runLog struct {
+	next  Observer
+	entry RunLogEntry
+}
+
+// startRunLog starts recording a run of the migrations of conf, until
+// finish is called.
+func startRunLog(conf *DBConf) *runLog {
+	l := &runLog{
+		next: conf.Observer,
+		entry: RunLogEntry{
+			Start:      time.Now().UTC(),
+			Env:        conf.Env,
+			Driver:     conf.Driver.Name,
+			Host:       dsnHost(conf.Driver.Name, conf.Driver.OpenStr),
+			Migrations: []MigrationReport{},
+		},
+	}
+	conf.Observer = l
+	return l
+}
+
+func (l *runLog) OnMigrationStart(m *Migration, direction Direction) {
+	if l.next != nil {
+		l.next.OnMigrationStart(m, direction)
+	}
+}
+
+func (l *runLog) OnMigrationEnd(m *Migration, direction Direction, duration time.Duration, err error) {
+	r := MigrationReport{
+		Type:       "migration",
+		Version:    m.Version,
+		Source:     m.Source,
+		Direction:  direction.String(),
+		DurationMs: durationMs(duration),
+		OK:         err == nil,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	l.entry.Migrations = append(l.entry.Migrations, r)
+
+	if l.next != nil {
+		l.next.OnMigrationEnd(m, direction, duration, err)
+	}
+}
+
+// finish restores the DBConf's Observer, and appends the entry for the run,
+// which ended with res and err, to conf.LogFile.
+func (l *runLog) finish(conf *DBConf, target int64, res *MigrationResult, err error) error {
+	conf.Observer = l.next
+
+	l.entry.End = time.Now().UTC()
+	l.entry.Direction = res.Direction.String()
+	l.entry.Target = target
+	l.entry.Version = res.Version
+	l.entry.OK = err == nil
+	if err != nil {
+		l.entry.Error = err.Error()
+	}
+
+	b, err := json.Marshal(l.entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(conf.LogFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// dsnHost returns the host, or for sqlite the file, of the DB the open
+// string is for, leaving out any credentials, or "" if it isn't given.
+func dsnHost(driverName, openStr string) string {
+	if driverName == "sqlite3" {
+		path := strings.TrimPrefix(openStr, "file:")
+		if i := strings.Index(path, "?"); i != -1 {
+			path = path[:i]
+		}
+		return path
+	}
+
+	if strings.Contains(openStr, "://") {
+		u, err := url.Parse(openStr)
+		if err != nil {
+			return ""
+		}
+		return u.Host
+	}
+
+	// lib/pq key=value pairs
+	for _, f := range strings.Fields(openStr) {
+		if strings.HasPrefix(f, "host=") {
+			return strings.Trim(strings.TrimPrefix(f, "host="), "'")
+		}
+	}
+
+	// user:pass@tcp(host:port)/db with mysql, user/pass@host:port/service
+	// with oracle
+	i := strings.LastIndex(openStr, "@")
+	if i == -1 {
+		return ""
+	}
+	host := openStr[i+1:]
+	if j := strings.Index(host, "("); j != -1 {
+		if k := strings.Index(host, ")"); k > j {
+			return host[j+1 : k]
+		}
+	}
+	if j := strings.IndexAny(host, "/?"); j != -1 {
+		host = host[:j]
+	}
+	return host
+}
@@ -0,0 +1,69 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Session holds a DB opened from a DBConf, so that a program running
+// several operations, e.g. status, then up, then status again, reuses the
+// same connection pool rather than opening the DB for each one.
+//
+// Callers must Close() the session.
+type Session struct {
+	Conf *DBConf
+	DB   *sql.DB
+}
+
+// NewSession opens the DB of conf, as OpenDBFromDBConf does.
+func NewSession(conf *DBConf) (*Session, error) {
+	db, err := OpenDBFromDBConf(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Conf: conf, DB: db}, nil
+}
+
+// Close closes the session's DB.
+func (s *Session) Close() error {
+	return s.DB.Close()
+}
+
+// Migrate migrates the DB to target, as RunMigrationsWithResult does.
+func (s *Session) Migrate(ctx context.Context, target int64) (*MigrationResult, error) {
+	return RunMigrationsWithResult(ctx, s.Conf, s.Conf.MigrationsDir, target, s.DB)
+}
+
+// Up applies every pending migration, up to the most recent.
+func (s *Session) Up(ctx context.Context) (*MigrationResult, error) {
+	target, err := GetMostRecentDBVersion(s.Conf.MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	return s.Migrate(ctx, target)
+}
+
+// Down rolls back the migration of the DB's current version.
+func (s *Session) Down(ctx context.Context) (*MigrationResult, error) {
+	current, err := s.Version()
+	if err != nil {
+		return nil, err
+	}
+	previous, err := GetPreviousDBVersion(s.Conf.MigrationsDir, current)
+	if err != nil {
+		return nil, err
+	}
+	return s.Migrate(ctx, previous)
+}
+
+// Status returns the migrations, with whether each is applied, as
+// MigrationStatus does.
+func (s *Session) Status() ([]*Migration, error) {
+	return MigrationStatus(s.Conf, s.DB)
+}
+
+// Version returns the DB version, creating the version table if it doesn't
+// exist yet.
+func (s *Session) Version() (int64, error) {
+	return EnsureDBVersion(s.Conf, s.DB)
+}
@@ -0,0 +1,61 @@
+package goose
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_one.sql":   [2]string{"INSERT INTO test(value) VALUES('one');", "DELETE FROM test;"},
+	})
+	defer mdCleanup()
+
+	// an in-memory DB only lasts as long as its connection, so each
+	// operation sees the previous ones' changes only if the pool is reused
+	s, err := NewSession(&DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+		Output:        ioutil.Discard,
+	})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	migrations, err := s.Status()
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.False(t, migrations[0].IsApplied)
+	assert.False(t, migrations[1].IsApplied)
+
+	res, err := s.Up(ctx)
+	require.NoError(t, err)
+	assert.Len(t, res.Migrations, 2)
+
+	migrations, err = s.Status()
+	require.NoError(t, err)
+	assert.True(t, migrations[0].IsApplied)
+	assert.True(t, migrations[1].IsApplied)
+
+	version, err := s.Version()
+	require.NoError(t, err)
+	assert.Equal(t, int64(20010203040507), version)
+
+	res, err = s.Down(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, DirectionDown, res.Direction)
+	require.Len(t, res.Migrations, 1)
+	assert.Equal(t, int64(20010203040507), res.Migrations[0].Version)
+
+	res, err = s.Migrate(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.Version)
+
+	require.NoError(t, s.Close())
+	_, err = s.Version()
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package goose
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DumpSchema returns the statements recreating the schema of db, such as
+// its tables, indexes and views, leaving out the version table. It's only
+// supported with the postgres and sqlite3 dialects.
+func DumpSchema(conf *DBConf, db *sql.DB) ([]string, error) {
+	dumper, ok := conf.Driver.Dialect.(schemaDumper)
+	if !ok {
+		return nil, errSchemaDumpUnsupported
+	}
+	return dumper.dumpSchema(context.Background(), db, conf.versionTable())
+}
+
+// SquashMigrations writes a SQL migration to w recreating the schema of db,
+// which must be migrated to exactly version to, so that it can replace the
+// migrations in conf.MigrationsDir up to and including to as a new baseline
+// with that version. The migration's header explains how to adopt it.
+//
+// As the schema is dumped, rather than the migrations being replayed, any
+// rows inserted by the migrations aren't in the baseline, and objects the
+// dialect can't dump are missing, so it must be reviewed before the
+// migrations are replaced.
+func SquashMigrations(w io.Writer, conf *DBConf, db *sql.DB, to int64) error {
+	migrations, err := CollectMigrations(conf.MigrationsDir)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, m := range migrations {
+		if m.Version == to {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("version %d not found in %s", to, conf.MigrationsDir)
+	}
+
+	current, err := ensureDBVersion(context.Background(), conf, db)
+	if err != nil {
+		return err
+	}
+	if current != to {
+		return fmt.Errorf("db is at version %d, rather than %d, so its schema isn't that of the migrations being squashed", current, to)
+	}
+
+	stmts, err := DumpSchema(conf, db)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, `-- Squashed from the migrations up to version %[1]d by goose squash.
+-- Review it, then replace those migrations with it, keeping its version.
+-- Databases already migrated to version %[1]d ran the migrations it
+-- replaces, so record its checksum on them, without running it, with:
+--   goose mark %[1]d down && goose mark %[1]d
+-- +goose Up
+`, to); err != nil {
+		return err
+	}
+	for _, stmt := range stmts {
+		if _, err := fmt.Fprintln(w, squashedStatement(stmt)); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprint(w, `
+-- +goose Down
+-- the baseline can't be rolled back
+SELECT 1;
+`)
+	return err
+}
+
+// squashedStatement annotates stmt with StatementBegin and StatementEnd if it
+// has semicolons other than the one ending it, such as a trigger's body.
+func squashedStatement(stmt string) string {
+	stmt = strings.TrimSpace(stmt)
+	if !strings.Contains(strings.TrimSuffix(stmt, ";"), ";") {
+		return stmt
+	}
+	return sqlCmdPrefix + "StatementBegin\n" + stmt + "\n" + sqlCmdPrefix + "StatementEnd"
+}
@@ -0,0 +1,77 @@
+package goose
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSquashMigrations(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_setup.sql": [2]string{"CREATE TABLE test(value VARCHAR(20));", "DROP TABLE test;"},
+		"20010203040507_index.sql": [2]string{"CREATE INDEX test_value ON test(value);", "DROP INDEX test_value;"},
+		"20010203040508_trigger.sql": [2]string{
+			"-- +goose StatementBegin\nCREATE TRIGGER test_upper AFTER INSERT ON test BEGIN UPDATE test SET value = upper(value); END;\n-- +goose StatementEnd",
+			"DROP TRIGGER test_upper;",
+		},
+		"20010203040509_view.sql": [2]string{"CREATE VIEW test_view AS SELECT value FROM test;", "DROP VIEW test_view;"},
+	})
+	defer mdCleanup()
+	conf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: md,
+	}
+
+	db, err := OpenDBFromDBConf(conf)
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = RunMigrationsOnDb(conf, conf.MigrationsDir, 20010203040509, db)
+	require.NoError(t, err)
+
+	// the db must be at the version squashed to
+	var buf bytes.Buffer
+	err = SquashMigrations(&buf, conf, db, 20010203040508)
+	assert.EqualError(t, err, "db is at version 20010203040509, rather than 20010203040508, so its schema isn't that of the migrations being squashed")
+	err = SquashMigrations(&buf, conf, db, 20010203040510)
+	assert.EqualError(t, err, "version 20010203040510 not found in "+md)
+
+	buf.Reset()
+	err = SquashMigrations(&buf, conf, db, 20010203040509)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "goose mark 20010203040509 down && goose mark 20010203040509\n")
+	assert.NotContains(t, buf.String(), "goose_db_version")
+
+	// the squashed baseline recreates the schema
+	squashedDir, squashedCleanup := setupMigrationsDir(nil)
+	defer squashedCleanup()
+	err = ioutil.WriteFile(filepath.Join(squashedDir, "20010203040509_squashed.sql"), buf.Bytes(), 0600)
+	require.NoError(t, err)
+	squashedConf := &DBConf{
+		Driver:        getSqlite3Driver(t),
+		MigrationsDir: squashedDir,
+	}
+	squashedDB, err := OpenDBFromDBConf(squashedConf)
+	require.NoError(t, err)
+	defer squashedDB.Close()
+
+	err = RunMigrationsOnDb(squashedConf, squashedConf.MigrationsDir, 20010203040509, squashedDB)
+	require.NoError(t, err)
+
+	want, err := DumpSchema(conf, db)
+	require.NoError(t, err)
+	require.Len(t, want, 4)
+	got, err := DumpSchema(squashedConf, squashedDB)
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestDumpSchema_unsupported(t *testing.T) {
+	conf := &DBConf{Driver: DBDriver{Name: "mysql", Dialect: MySqlDialect{}}}
+	_, err := DumpSchema(conf, nil)
+	assert.Equal(t, errSchemaDumpUnsupported, err)
+}
@@ -0,0 +1,246 @@
+package goose
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// SSLConf holds the TLS settings used to connect to the DB. The fields
+// follow the postgres sslmode, sslrootcert, sslcert and sslkey
+// parameters, and are translated into the equivalent mysql settings.
+type SSLConf struct {
+	// Mode is one of disable, require, verify-ca or verify-full.
+	// postgres additionally accepts allow and prefer.
+	Mode     string
+	RootCert string
+	Cert     string
+	Key      string
+}
+
+// the name the mysql TLS config is registered under
+const mysqlTLSConfigName = "goose"
+
+func (c SSLConf) isSet() bool {
+	return c != SSLConf{}
+}
+
+// validate checks that the configured cert files exist.
+func (c SSLConf) validate() error {
+	files := []struct {
+		name string
+		path string
+	}{
+		{"sslrootcert", c.RootCert},
+		{"sslcert", c.Cert},
+		{"sslkey", c.Key},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return fmt.Errorf("%s: %s", f.name, err)
+		}
+	}
+
+	if (c.Cert == "") != (c.Key == "") {
+		return errors.New("sslcert and sslkey must be given together")
+	}
+	return nil
+}
+
+// applySSL validates the SSL settings and adds them to the driver's
+// open string.
+func applySSL(drv DBDriver, c SSLConf) (string, error) {
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+
+	switch drv.Name {
+	case "postgres":
+		return postgresSSLOpenStr(drv.OpenStr, c)
+	case "mysql":
+		return mysqlSSLOpenStr(drv.OpenStr, c)
+	}
+	return "", fmt.Errorf("ssl options are not supported with the %s driver", drv.Name)
+}
+
+// postgresSSLOpenStr adds the SSL params to a lib/pq open string.
+func postgresSSLOpenStr(openStr string, c SSLConf) (string, error) {
+	params := [][2]string{
+		{"sslmode", c.Mode},
+		{"sslrootcert", c.RootCert},
+		{"sslcert", c.Cert},
+		{"sslkey", c.Key},
+	}
+
+	return setPostgresParams(openStr, params)
+}
+
+// setPostgresParams adds the params with non-empty values to a lib/pq open
+// string, which may be either a URL or a list of key=value pairs.
+func setPostgresParams(openStr string, params [][2]string) (string, error) {
+	if strings.Contains(openStr, "://") {
+		u, err := url.Parse(openStr)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		for _, p := range params {
+			if p[1] != "" {
+				q.Set(p[0], p[1])
+			}
+		}
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	for _, p := range params {
+		if p[1] != "" {
+			openStr += " " + p[0] + "=" + quotePostgresValue(p[1])
+		}
+	}
+	return strings.TrimSpace(openStr), nil
+}
+
+// redshiftMaxIdleTime is how long redshift connections are kept idle in the
+// pool, unless DBConf.ConnMaxLifetime is set. Redshift is usually reached
+// through NAT gateways or load balancers, which silently drop connections
+// idle for longer than about 5 minutes, leaving the pool to hand out a dead
+// connection after a long migration.
+const redshiftMaxIdleTime = 4 * time.Minute
+
+// redshiftOpenStr sets the sslmode of a lib/pq open string for redshift to
+// require, as clusters are reached over the network, and may be set to reject
+// unencrypted connections. lib/pq already defaults to require, but forks of it
+// used with the driver's import, like libpq itself, may only prefer SSL. An
+// sslmode in openStr, from DBConf.SSL, or in $PGSSLMODE is kept.
+func redshiftOpenStr(openStr string) (string, error) {
+	if os.Getenv("PGSSLMODE") != "" {
+		return openStr, nil
+	}
+	set, err := hasPostgresParam(openStr, "sslmode")
+	if err != nil || set {
+		return openStr, err
+	}
+	return setPostgresParams(openStr, [][2]string{{"sslmode", "require"}})
+}
+
+// hasPostgresParam reports whether the lib/pq open string, a URL or a list
+// of key=value pairs, sets the param.
+func hasPostgresParam(openStr, key string) (bool, error) {
+	if strings.Contains(openStr, "://") {
+		u, err := url.Parse(openStr)
+		if err != nil {
+			return false, err
+		}
+		_, ok := u.Query()[key]
+		return ok, nil
+	}
+
+	for _, f := range strings.Fields(openStr) {
+		if strings.HasPrefix(f, key+"=") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// quotePostgresValue quotes a value in a key=value open string if needed.
+func quotePostgresValue(v string) string {
+	if !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `'`, `\'`, -1)
+	return "'" + v + "'"
+}
+
+// mysqlSSLOpenStr registers a TLS config built from the SSL settings
+// with go-sql-driver/mysql, and refers to it from the DSN.
+func mysqlSSLOpenStr(openStr string, c SSLConf) (string, error) {
+	if c.Mode == "disable" {
+		return setMySQLDSNParam(openStr, "tls", "false")
+	}
+
+	cfg, err := mysqlTLSConfig(c)
+	if err != nil {
+		return "", err
+	}
+	if err := mysql.RegisterTLSConfig(mysqlTLSConfigName, cfg); err != nil {
+		return "", err
+	}
+	return setMySQLDSNParam(openStr, "tls", mysqlTLSConfigName)
+}
+
+func mysqlTLSConfig(c SSLConf) (*tls.Config, error) {
+	cfg := &tls.Config{}
+
+	if c.RootCert != "" {
+		pem, err := ioutil.ReadFile(c.RootCert)
+		if err != nil {
+			return nil, fmt.Errorf("sslrootcert: %s", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("sslrootcert: no certificates found in %s", c.RootCert)
+		}
+	}
+
+	if c.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("sslcert: %s", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch c.Mode {
+	case "require":
+		cfg.InsecureSkipVerify = true
+	case "verify-ca":
+		// verify the chain, but not the host name
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyCertChain(cfg.RootCAs)
+	case "", "verify-full":
+	default:
+		return nil, fmt.Errorf("unsupported sslmode %q for mysql", c.Mode)
+	}
+
+	return cfg, nil
+}
+
+func verifyCertChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no server certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
@@ -0,0 +1,131 @@
+package goose
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSLConf_validate(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	cert := filepath.Join(td, "client.crt")
+	err = ioutil.WriteFile(cert, []byte("\n"), 0600)
+	require.NoError(t, err)
+
+	err = SSLConf{RootCert: filepath.Join(td, "missing.crt")}.validate()
+	assert.Error(t, err)
+
+	err = SSLConf{Cert: cert}.validate()
+	assert.Error(t, err, "sslcert without sslkey")
+
+	err = SSLConf{Mode: "verify-full", RootCert: cert}.validate()
+	assert.NoError(t, err)
+}
+
+func TestApplySSL_postgres(t *testing.T) {
+	ssl := SSLConf{Mode: "verify-full"}
+
+	got, err := applySSL(newDBDriver("postgres", "user=goose dbname=goose"), ssl)
+	require.NoError(t, err)
+	assert.Equal(t, "user=goose dbname=goose sslmode=verify-full", got)
+
+	got, err = applySSL(newDBDriver("postgres", "postgres://goose@localhost/goose?sslmode=disable"), ssl)
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://goose@localhost/goose?sslmode=verify-full", got)
+
+	assert.Equal(t, `'/my certs/ca.crt'`, quotePostgresValue("/my certs/ca.crt"))
+}
+
+func TestApplySSL_mysql(t *testing.T) {
+	got, err := applySSL(newDBDriver("mysql", "goose@/goose?parseTime=true"), SSLConf{Mode: "require"})
+	require.NoError(t, err)
+	assert.Equal(t, "goose@/goose?parseTime=true&tls=goose", got)
+
+	cfg, err := mysql.ParseDSN(got)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.TLS)
+	assert.True(t, cfg.TLS.InsecureSkipVerify)
+
+	got, err = applySSL(newDBDriver("mysql", "goose@/goose"), SSLConf{Mode: "disable"})
+	require.NoError(t, err)
+	assert.Equal(t, "goose@/goose?tls=false", got)
+
+	_, err = applySSL(newDBDriver("mysql", "goose@/goose"), SSLConf{Mode: "prefer"})
+	assert.Error(t, err)
+}
+
+func TestApplySSL_mysqlBadRootCert(t *testing.T) {
+	td, err := ioutil.TempDir("", "goose-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(td)
+
+	rootCert := filepath.Join(td, "ca.crt")
+	err = ioutil.WriteFile(rootCert, []byte("not a cert\n"), 0600)
+	require.NoError(t, err)
+
+	_, err = applySSL(newDBDriver("mysql", "goose@/goose"), SSLConf{RootCert: rootCert})
+	assert.Error(t, err)
+}
+
+func TestApplySSL_unsupported(t *testing.T) {
+	_, err := applySSL(newDBDriver("sqlite3", ":memory:"), SSLConf{Mode: "require"})
+	assert.Error(t, err)
+}
+
+func TestNewDBConf_ssl(t *testing.T) {
+	confPath, _, clean := setupDBConf(t, "dbconf.yaml", "certs")
+	defer clean()
+
+	err := ioutil.WriteFile(confPath,
+		[]byte(`
+myenv:
+	driver: postgres
+	open: foo
+	sslmode: verify-ca
+	sslrootcert: certs/ca.crt
+	sslcert: /etc/goose/client.crt
+	sslkey: /etc/goose/client.key
+`),
+		0700)
+	require.NoError(t, err)
+
+	dbconf, err := NewDBConf(filepath.Dir(confPath), "myenv")
+	require.NoError(t, err)
+
+	assert.Equal(t, SSLConf{
+		Mode:     "verify-ca",
+		RootCert: filepath.Join(filepath.Dir(confPath), "certs", "ca.crt"),
+		Cert:     "/etc/goose/client.crt",
+		Key:      "/etc/goose/client.key",
+	}, dbconf.SSL)
+}
+
+func TestRedshiftOpenStr(t *testing.T) {
+	defer os.Setenv("PGSSLMODE", os.Getenv("PGSSLMODE"))
+	os.Unsetenv("PGSSLMODE")
+
+	got, err := redshiftOpenStr("user=goose dbname=goose")
+	require.NoError(t, err)
+	assert.Equal(t, "user=goose dbname=goose sslmode=require", got)
+
+	got, err = redshiftOpenStr("postgres://goose@example.com:5439/goose")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://goose@example.com:5439/goose?sslmode=require", got)
+
+	got, err = redshiftOpenStr("postgres://goose@example.com:5439/goose?sslmode=verify-full")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://goose@example.com:5439/goose?sslmode=verify-full", got)
+
+	os.Setenv("PGSSLMODE", "disable")
+	got, err = redshiftOpenStr("user=goose dbname=goose")
+	require.NoError(t, err)
+	assert.Equal(t, "user=goose dbname=goose", got)
+}
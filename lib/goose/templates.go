@@ -1,7 +1,9 @@
 // Code generated by go-bindata.
 // sources:
 // templates/migration-main.go.tmpl
+// templates/migration.data.sql.tmpl
 // templates/migration.go.tmpl
+// templates/migration.index.sql.tmpl
 // templates/migration.sql.tmpl
 // DO NOT EDIT!
 
@@ -53,6 +55,7 @@ import (
 	"log"
 	"bytes"
 	"encoding/gob"
+	"os"
 
 	_ "{{.Import}}"
 	"github.com/CloudCom/goose/lib/goose"
@@ -60,6 +63,13 @@ import (
 
 func main() {
 
+	// the direction is given on the command line, so a built binary may
+	// be run both up and down
+	if len(os.Args) != 2 || (os.Args[1] != "up" && os.Args[1] != "down") {
+		log.Fatal("usage: ", os.Args[0], " up|down")
+	}
+	direction := goose.Direction(os.Args[1] == "up")
+
 	var conf goose.DBConf
 	buf := bytes.NewBuffer({{ .Conf }})
 	if err := gob.NewDecoder(buf).Decode(&conf); err != nil {
@@ -77,9 +87,18 @@ func main() {
 		log.Fatal("db.Begin:", err)
 	}
 
-	{{ .Func }}(txn)
+	// the migration's funcs may return an error, or nothing
+	if direction == goose.DirectionUp {
+		{{ if .UpReturnsError }}err = {{ end }}{{ .UpFunc }}(txn)
+	} else {
+		{{ if .DownReturnsError }}err = {{ end }}{{ .DownFunc }}(txn)
+	}
+	if err != nil {
+		txn.Rollback()
+		log.Fatal("migration failed: ", err)
+	}
 
-	err = goose.FinalizeMigration(&conf, txn, {{ .Direction }}, {{ .Version }})
+	err = goose.FinalizeMigrationWithSource(&conf, txn, direction, {{ .Version }}, {{ printf "%q" .Source }})
 	if err != nil {
 		log.Fatal("Commit() failed:", err)
 	}
@@ -102,20 +121,52 @@ func templatesMigrationMainGoTmpl() (*asset, error) {
 	return a, nil
 }
 
+var _templatesMigrationDataSqlTmpl = []byte(`-- +goose Up
+-- Backfill or transform existing rows here. Keep the statements
+-- idempotent, so the migration can be rerun if it's interrupted.
+-- UPDATE table SET new_column = old_column WHERE new_column IS NULL;
+
+
+-- +goose Down
+-- Undo the data change, or SELECT 1; if it can't be undone.
+-- UPDATE table SET new_column = NULL;
+
+
+`)
+
+func templatesMigrationDataSqlTmplBytes() ([]byte, error) {
+	return _templatesMigrationDataSqlTmpl, nil
+}
+
+func templatesMigrationDataSqlTmpl() (*asset, error) {
+	bytes, err := templatesMigrationDataSqlTmplBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/migration.data.sql.tmpl", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _templatesMigrationGoTmpl = []byte(`package main
 
 import (
 	"database/sql"
+	"errors"
 )
 
-// Up is executed when this migration is applied
-func Up_{{ . }}(txn *sql.Tx) {
-
+// Up is executed when this migration is applied.
+// Returning an error rolls back the transaction.
+func Up_{{ . }}(txn *sql.Tx) error {
+	return nil
 }
 
-// Down is executed when this migration is rolled back
-func Down_{{ . }}(txn *sql.Tx) {
-
+// Down is executed when this migration is rolled back.
+// Returning an error rolls back the transaction.
+// Until it's implemented, rolling back fails rather than silently doing nothing.
+func Down_{{ . }}(txn *sql.Tx) error {
+	return errors.New("down migration not implemented")
 }
 {{/* vim: set ft=go.gotexttmpl: */}}
 `)
@@ -135,12 +186,44 @@ func templatesMigrationGoTmpl() (*asset, error) {
 	return a, nil
 }
 
+var _templatesMigrationIndexSqlTmpl = []byte(`-- +goose NO TRANSACTION
+-- Indexes are built outside of a transaction, so that they may be built
+-- concurrently, e.g. with postgres' CREATE INDEX CONCURRENTLY. If a
+-- statement fails, the ones before it stay applied.
+
+-- +goose Up
+-- CREATE INDEX CONCURRENTLY IF NOT EXISTS table_column_idx ON table (column);
+
+
+-- +goose Down
+-- DROP INDEX CONCURRENTLY IF EXISTS table_column_idx;
+
+
+`)
+
+func templatesMigrationIndexSqlTmplBytes() ([]byte, error) {
+	return _templatesMigrationIndexSqlTmpl, nil
+}
+
+func templatesMigrationIndexSqlTmpl() (*asset, error) {
+	bytes, err := templatesMigrationIndexSqlTmplBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "templates/migration.index.sql.tmpl", size: 0, mode: os.FileMode(0), modTime: time.Unix(0, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _templatesMigrationSqlTmpl = []byte(`-- +goose Up
 -- SQL in section 'Up' is executed when this migration is applied
 
 
 -- +goose Down
 -- SQL section 'Down' is executed when this migration is rolled back
+-- TODO: undo the Up section. goose warns about migrations whose Down
+-- section is left empty, as they can't be rolled back.
 
 
 `)
@@ -212,9 +295,11 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"templates/migration-main.go.tmpl": templatesMigrationMainGoTmpl,
-	"templates/migration.go.tmpl":      templatesMigrationGoTmpl,
-	"templates/migration.sql.tmpl":     templatesMigrationSqlTmpl,
+	"templates/migration-main.go.tmpl":   templatesMigrationMainGoTmpl,
+	"templates/migration.data.sql.tmpl":  templatesMigrationDataSqlTmpl,
+	"templates/migration.go.tmpl":        templatesMigrationGoTmpl,
+	"templates/migration.index.sql.tmpl": templatesMigrationIndexSqlTmpl,
+	"templates/migration.sql.tmpl":       templatesMigrationSqlTmpl,
 }
 
 // AssetDir returns the file names below a certain
@@ -259,9 +344,11 @@ type bintree struct {
 
 var _bintree = &bintree{nil, map[string]*bintree{
 	"templates": &bintree{nil, map[string]*bintree{
-		"migration-main.go.tmpl": &bintree{templatesMigrationMainGoTmpl, map[string]*bintree{}},
-		"migration.go.tmpl":      &bintree{templatesMigrationGoTmpl, map[string]*bintree{}},
-		"migration.sql.tmpl":     &bintree{templatesMigrationSqlTmpl, map[string]*bintree{}},
+		"migration-main.go.tmpl":   &bintree{templatesMigrationMainGoTmpl, map[string]*bintree{}},
+		"migration.data.sql.tmpl":  &bintree{templatesMigrationDataSqlTmpl, map[string]*bintree{}},
+		"migration.go.tmpl":        &bintree{templatesMigrationGoTmpl, map[string]*bintree{}},
+		"migration.index.sql.tmpl": &bintree{templatesMigrationIndexSqlTmpl, map[string]*bintree{}},
+		"migration.sql.tmpl":       &bintree{templatesMigrationSqlTmpl, map[string]*bintree{}},
 	}},
 }}
 
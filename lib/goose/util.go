@@ -1,6 +1,7 @@
 package goose
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"text/template"
@@ -38,3 +39,36 @@ func copyFile(dst, src string) (int64, error) {
 
 	return io.Copy(df, sf)
 }
+
+// wrappedError is an error with its own message, wrapping the error it was
+// caused by, like those of fmt.Errorf's %w, which needs Go 1.13.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// wrapError returns an error with the message formatted from format and
+// args, wrapping err.
+func wrapError(err error, format string, args ...interface{}) error {
+	return &wrappedError{msg: fmt.Sprintf(format, args...), err: err}
+}
+
+// rootCause returns the error at the end of err's chain of wrapped errors,
+// e.g. the driver's error a statement failed with.
+func rootCause(err error) error {
+	for {
+		w, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return err
+		}
+		err = w.Unwrap()
+	}
+}
@@ -0,0 +1,158 @@
+package goose
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// ValidateMigrations checks the migrations in dirpath without connecting to a
+// DB, and returns every problem found: unparsable file names, duplicate
+// versions, timestamp versions which aren't valid times, SQL migrations
+// missing their Up or Down sections, or with an empty Down section, and Go
+// migrations not defining their Up and Down functions.
+func ValidateMigrations(dirpath string) ([]error, error) {
+	paths, err := readMigrationDir(dirpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []error
+	versions := map[int64]string{}
+	for _, path := range paths {
+		ext := migrationExt(path)
+		if ext != ".sql" && ext != ".go" {
+			continue
+		}
+
+		v, err := NumericComponent(path)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%s: %s", path, err))
+			continue
+		}
+		if other, ok := versions[v]; ok {
+			problems = append(problems, fmt.Errorf("%s: version %d is also used by %s", path, v, other))
+			continue
+		}
+		versions[v] = path
+		if isMalformedTimestamp(v) {
+			problems = append(problems, fmt.Errorf("%s: version %d looks like a timestamp, but isn't a valid date and time", path, v))
+		}
+
+		var errs []string
+		if ext == ".sql" {
+			errs, err = validateSQLMigration(path)
+		} else {
+			errs, err = validateGoMigration(path, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range errs {
+			problems = append(problems, fmt.Errorf("%s: %s", path, e))
+		}
+	}
+
+	return problems, nil
+}
+
+// validateSQLMigration checks the annotations of the script at path are
+// usable by runSQLMigration.
+func validateSQLMigration(path string) ([]string, error) {
+	f, err := openMigration(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var problems []string
+	var up, down, inDown, downStatements, inStatement, noTx, parallel bool
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, sqlCmdPrefix) {
+			if inDown && isSQLStatementLine(line) {
+				downStatements = true
+			}
+			continue
+		}
+
+		if _, ok, err := parseSQLEnvAnnotation(line); ok {
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("line %d: %s", n, err))
+			}
+			continue
+		}
+
+		switch cmd := strings.TrimSpace(line[len(sqlCmdPrefix):]); cmd {
+		case sqlNoTransactionCmd:
+			noTx = true
+		case sqlParallelCmd:
+			parallel = true
+		case "Up", "Down":
+			if inStatement {
+				problems = append(problems, fmt.Sprintf("line %d: '-- +goose %s' within a statement", n, cmd))
+			}
+			if cmd == "Up" {
+				up = true
+			} else {
+				down = true
+			}
+			inDown = cmd == "Down"
+		case "StatementBegin":
+			if inStatement {
+				problems = append(problems, fmt.Sprintf("line %d: nested '-- +goose StatementBegin'", n))
+			}
+			inStatement = true
+		case "StatementEnd":
+			if !inStatement {
+				problems = append(problems, fmt.Sprintf("line %d: '-- +goose StatementEnd' with no StatementBegin", n))
+			}
+			inStatement = false
+		default:
+			problems = append(problems, fmt.Sprintf("line %d: unknown annotation %q", n, cmd))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if inStatement {
+		problems = append(problems, "'-- +goose StatementBegin' with no matching StatementEnd")
+	}
+	if parallel && !noTx {
+		problems = append(problems, "'-- +goose PARALLEL' without '-- +goose NO TRANSACTION'")
+	}
+	if !up {
+		problems = append(problems, "missing '-- +goose Up' section")
+	}
+	if !down {
+		problems = append(problems, "missing '-- +goose Down' section")
+	} else if !downStatements {
+		problems = append(problems, "empty '-- +goose Down' section, the migration can't be rolled back")
+	}
+
+	return problems, nil
+}
+
+// validateGoMigration checks the Go migration at path parses and defines the
+// functions runGoMigration calls.
+func validateGoMigration(path string, version int64) ([]string, error) {
+	funcs, err := goMigrationFuncs(path)
+	if err != nil {
+		return []string{err.Error()}, nil
+	}
+
+	var problems []string
+	for _, direction := range []Direction{DirectionUp, DirectionDown} {
+		name := goMigrationFunc(direction, version)
+		fn := funcs[name]
+		if fn == nil {
+			problems = append(problems, fmt.Sprintf("missing func %s", name))
+		} else if !validMigrationFunc(fn) {
+			problems = append(problems, fmt.Sprintf("func %s must return an error or nothing", name))
+		}
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,116 @@
+package goose
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMigrations(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_first.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	files := map[string]string{
+		"20010203040507_noDown.sql":    "-- +goose Up\nSELECT 1;\n",
+		"20010203040507_dup.sql":       "-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"20010203040508_begin.sql":     "-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"abc_bad.sql":                  "-- +goose Up\n-- +goose Down\n",
+		"20010203040509_funcs.go":      "package main\n\nimport \"database/sql\"\n\nfunc Up_20010203040509(txn *sql.Tx) {}\n",
+		"20010203040510_good.go":       "package main\n\nimport \"database/sql\"\n\nfunc Up_20010203040510(txn *sql.Tx) {}\nfunc Down_20010203040510(txn *sql.Tx) {}\n",
+		"20010203040511_invalid.go":    "package main\n\nfunc Up_20010203040511(\n",
+		"20010203040512_noTx.sql":      "-- +goose NO TRANSACTION\n-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"20010203040513_emptyDown.sql": "-- +goose Up\nSELECT 1;\n-- +goose Down\n-- nothing to undo\n\n",
+		"20010203040514_par.sql":       "-- +goose PARALLEL\n-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"20010203040515_parNoTx.sql":   "-- +goose NO TRANSACTION\n-- +goose PARALLEL\n-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+		"README.md":                    "not a migration",
+	}
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(md, name), []byte(contents), 0600)
+		require.NoError(t, err)
+	}
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+
+	var msgs []string
+	for _, p := range problems {
+		msgs = append(msgs, p.Error())
+	}
+	assert.Len(t, msgs, 8, "%q", msgs)
+	assert.Contains(t, msgs, filepath.Join(md, "20010203040507_noDown.sql")+": version 20010203040507 is also used by "+filepath.Join(md, "20010203040507_dup.sql"))
+	assert.Contains(t, msgs, filepath.Join(md, "20010203040508_begin.sql")+": line 4: '-- +goose Down' within a statement")
+	assert.Contains(t, msgs, filepath.Join(md, "20010203040508_begin.sql")+": '-- +goose StatementBegin' with no matching StatementEnd")
+	assert.Contains(t, msgs, filepath.Join(md, "abc_bad.sql")+`: strconv.ParseInt: parsing "abc": invalid syntax`)
+	assert.Contains(t, msgs, filepath.Join(md, "20010203040509_funcs.go")+": missing func Down_20010203040509")
+	assert.Contains(t, msgs, filepath.Join(md, "20010203040513_emptyDown.sql")+": empty '-- +goose Down' section, the migration can't be rolled back")
+	assert.Contains(t, msgs, filepath.Join(md, "20010203040514_par.sql")+": '-- +goose PARALLEL' without '-- +goose NO TRANSACTION'")
+	assert.Contains(t, msgs[4], filepath.Join(md, "20010203040511_invalid.go")+": ")
+	assert.Contains(t, msgs[4], "expected ')'")
+}
+
+func TestValidateMigrations_malformedTimestamp(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(map[string][2]string{
+		"20010203040506_ok.sql":    [2]string{"SELECT 1;", "SELECT 1;"},
+		"20011303040506_month.sql": [2]string{"SELECT 1;", "SELECT 1;"},
+		"00002_sequential.sql":     [2]string{"SELECT 1;", "SELECT 1;"},
+	})
+	defer mdCleanup()
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.EqualError(t, problems[0], filepath.Join(md, "20011303040506_month.sql")+": version 20011303040506 looks like a timestamp, but isn't a valid date and time")
+}
+
+func TestValidateMigrations_missingUp(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	err := ioutil.WriteFile(filepath.Join(md, "001_noUp.sql"), []byte("SELECT 1;\n"), 0600)
+	require.NoError(t, err)
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, problems, 2)
+	assert.EqualError(t, problems[0], filepath.Join(md, "001_noUp.sql")+": missing '-- +goose Up' section")
+	assert.EqualError(t, problems[1], filepath.Join(md, "001_noUp.sql")+": missing '-- +goose Down' section")
+}
+
+func TestValidateMigrations_goResults(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	err := ioutil.WriteFile(filepath.Join(md, "001_results.go"),
+		[]byte("package main\n\nimport \"database/sql\"\n\nfunc Up_1(txn *sql.Tx) error { return nil }\nfunc Down_1(txn *sql.Tx) int { return 0 }\n"),
+		0600)
+	require.NoError(t, err)
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.EqualError(t, problems[0], filepath.Join(md, "001_results.go")+": func Down_1 must return an error or nothing")
+}
+
+func TestValidateMigrations_env(t *testing.T) {
+	md, mdCleanup := setupMigrationsDir(nil)
+	defer mdCleanup()
+
+	files := map[string]string{
+		"001_env.sql":    "-- +goose ENV ROLE\n-- +goose Up\nGRANT SELECT ON t TO $ROLE;\n-- +goose Down\nSELECT 1;\n",
+		"002_noVars.sql": "-- +goose ENV\n-- +goose Up\nSELECT 1;\n-- +goose Down\nSELECT 1;\n",
+	}
+	for name, contents := range files {
+		err := ioutil.WriteFile(filepath.Join(md, name), []byte(contents), 0600)
+		require.NoError(t, err)
+	}
+
+	problems, err := ValidateMigrations(md)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	assert.EqualError(t, problems[0], filepath.Join(md, "002_noVars.sql")+": line 1: '-- +goose ENV' lists no variables")
+}
@@ -35,29 +35,10 @@ func setup() {
 	dsn := os.Getenv("REDSHIFT_DATABASE_DSN")
 
 	newdb := "goose-" + strconv.FormatInt(time.Now().UnixNano(), 36)
-	var newDSN string
-
-	if strings.HasPrefix(dsn, "postgres://") {
-		u, err := url.Parse(dsn)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not parse $REDSHIFT_DATABASE_DSN\n")
-			os.Exit(1)
-		}
-		u.Path = newdb
-		newDSN = u.String()
-	} else {
-		foundDBName := false
-		for _, f := range strings.Fields(dsn) {
-			kv := strings.SplitN(f, "=", 2)
-			if kv[0] == "dbname" {
-				f = "dbname=" + newdb
-				foundDBName = true
-			}
-			newDSN = newDSN + f + " "
-		}
-		if !foundDBName {
-			newDSN = newDSN + "dbname=" + newdb
-		}
+	newDSN, err := setDSNDBName(dsn, newdb)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not parse $REDSHIFT_DATABASE_DSN\n")
+		os.Exit(1)
 	}
 
 	db, err := sql.Open("postgres", dsn)
@@ -78,30 +59,24 @@ func setup() {
 func destroy() {
 	dsn := os.Getenv("REDSHIFT_DATABASE_DSN")
 
-	var dbname string
-
-	if strings.HasPrefix(dsn, "postgres://") {
-		u, err := url.Parse(dsn)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not parse $REDSHIFT_DATABASE_DSN\n")
-			os.Exit(1)
-		}
-		dbname = u.Path
-	} else {
-		for _, f := range strings.Fields(dsn) {
-			kv := strings.SplitN(f, "=", 2)
-			if len(kv) != 2 || kv[0] == "dbname" {
-				dbname = kv[1]
-				break
-			}
-		}
+	dbname, err := dsnDBName(dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not parse $REDSHIFT_DATABASE_DSN\n")
+		os.Exit(1)
 	}
 	if dbname == "" {
 		fmt.Fprintf(os.Stderr, "Could not find db name in $REDSHIFT_DATABASE_DSN\n")
 		os.Exit(1)
 	}
 
-	db, err := sql.Open("postgres", strings.Replace(dsn, dbname, "dev", 1))
+	// connect to the default db to drop ours
+	devDSN, err := setDSNDBName(dsn, "dev")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not parse $REDSHIFT_DATABASE_DSN\n")
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("postgres", devDSN)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Could not connect to Redshift: %s\n", err)
 		os.Exit(1)
@@ -112,3 +87,49 @@ func destroy() {
 		os.Exit(1)
 	}
 }
+
+// dsnDBName returns the database named by a URL or keyword/value DSN, or ""
+// if it doesn't name one.
+func dsnDBName(dsn string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimPrefix(u.Path, "/"), nil
+	}
+
+	for _, f := range strings.Fields(dsn) {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) == 2 && kv[0] == "dbname" {
+			return kv[1], nil
+		}
+	}
+	return "", nil
+}
+
+// setDSNDBName returns the DSN with its database replaced by dbname.
+func setDSNDBName(dsn, dbname string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		u.Path = "/" + dbname
+		return u.String(), nil
+	}
+
+	var fields []string
+	found := false
+	for _, f := range strings.Fields(dsn) {
+		if kv := strings.SplitN(f, "=", 2); len(kv) == 2 && kv[0] == "dbname" {
+			f = "dbname=" + dbname
+			found = true
+		}
+		fields = append(fields, f)
+	}
+	if !found {
+		fields = append(fields, "dbname="+dbname)
+	}
+	return strings.Join(fields, " "), nil
+}